@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"lrprev-extract-go/internal/cli"
+	"lrprev-extract-go/internal/database"
+	"lrprev-extract-go/internal/discover"
+	"lrprev-extract-go/internal/inventory"
+	"lrprev-extract-go/internal/pool"
+	"lrprev-extract-go/pkg/extractor"
+	"lrprev-extract-go/pkg/metadata"
+	"lrprev-extract-go/pkg/naming"
+	"lrprev-extract-go/pkg/output"
+	"lrprev-extract-go/pkg/report"
+)
+
+// runExport selects images in the catalog and extracts their previews, the
+// reverse of the default flow which starts from preview files.
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	lightroomDB := fs.String("l", "", "Path to the lightroom catalog (.lrcat)")
+	previewsDir := fs.String("d", "", "Path to the Previews.lrdata directory (default: next to the catalog)")
+	previewsDB := fs.String("previews-db", "", "Path to previews.db (default: found in the Previews.lrdata directory)")
+	outputDirectory := fs.String("o", "", "Path to output directory")
+	folder := fs.String("folder", "", "Only images whose folder path starts with this")
+	collection := fs.String("collection", "", "Only images in this collection")
+	minRating := fs.Int("min-rating", 0, "Only images rated at least this many stars")
+	pick := fs.String("pick", "", "Only images with this flag: picked, rejected or unflagged")
+	from := fs.String("from", "", "Only images captured on or after this date (YYYY-MM-DD)")
+	to := fs.String("to", "", "Only images captured on or before this date (YYYY-MM-DD)")
+	keyword := fs.String("keyword", "", "Only images tagged with this keyword")
+	includeSize := fs.Bool("include-size", false, "Include image size information in the output file name")
+	writeMetadata := fs.Bool("metadata", false, "Write EXIF and XMP metadata from the catalog into each JPEG")
+	writeSidecar := fs.Bool("xmp-sidecar", false, "Write an .xmp sidecar with the catalog metadata next to each JPEG")
+	orient := fs.String("orient", extractor.OrientNone, "Apply the preview orientation: none, exif (set the EXIF Orientation tag) or rotate (rotate losslessly)")
+	onConflict := fs.String("on-conflict", "", "What to do when an output file already exists: overwrite, skip, suffix or identical (skip if byte-identical, otherwise suffix) (default: overwrite, or suffix with -template)")
+	template := fs.String("template", "", "Output path template relative to -o, e.g. '{capture:2006/01/02}/{basename}_{width}x{height}.jpg'")
+	levelsFlag := fs.String("levels", "", "Pyramid levels to extract: 'all' or a comma separated list such as '1,3' (default: largest only)")
+	var workers int
+	fs.IntVar(&workers, "j", runtime.NumCPU(), "Number of files to process concurrently (shorthand for -workers)")
+	fs.IntVar(&workers, "workers", runtime.NumCPU(), "Number of files to process concurrently")
+	dryRun := fs.Bool("dry-run", false, "Resolve every preview, catalog path, output file and conflict and print the plan, writing nothing")
+	planFormat := fs.String("plan-format", planText, "Format of the -dry-run plan: text or json")
+	reportFormat := fs.String("report", report.FormatPlain, "How to show progress: plain (log lines) or json (one JSON event per line)")
+	fs.Usage = func() {
+		fmt.Println("Usage:\n  lrprev-extract export -l <catalog.lrcat> -o <output> [filters]")
+		fmt.Println("\nOptions:")
+		fs.PrintDefaults()
+		fmt.Println("\nExample:")
+		fmt.Println("  lrprev-extract export -l catalog.lrcat -o out -collection '2025 Wedding' -min-rating 4 -pick picked")
+	}
+	_ = fs.Parse(args)
+
+	if *lightroomDB == "" || *outputDirectory == "" {
+		fs.Usage()
+		return cli.ExitUsage
+	}
+
+	filter := database.ImageFilter{
+		Folder:     *folder,
+		Collection: *collection,
+		MinRating:  *minRating,
+		Pick:       strings.ToLower(*pick),
+		Keyword:    *keyword,
+	}
+	if filter.Pick != database.PickAny {
+		if err := cli.CheckChoice("pick", filter.Pick, database.PickPicked, database.PickRejected, database.PickUnflagged); err != nil {
+			usageFatalf("%v", err)
+		}
+	}
+	var err error
+	if filter.CapturedFrom, err = parseDate(*from); err != nil {
+		usageFatalf("Invalid -from value: %v", err)
+	}
+	if filter.CapturedTo, err = parseDate(*to); err != nil {
+		usageFatalf("Invalid -to value: %v", err)
+	}
+	if !filter.CapturedFrom.IsZero() && !filter.CapturedTo.IsZero() && filter.CapturedFrom.After(filter.CapturedTo) {
+		usageFatalf("Invalid date range: -from %s is after -to %s", *from, *to)
+	}
+
+	allLevels, levels, err := cli.ParseLevels(*levelsFlag)
+	if err != nil {
+		usageFatalf("Invalid -levels value: %v", err)
+	}
+	if err := cli.CheckChoice("orient", *orient, extractor.OrientNone, extractor.OrientEXIF, extractor.OrientRotate); err != nil {
+		usageFatalf("%v", err)
+	}
+	var nameTemplate *naming.Template
+	if *template != "" {
+		if nameTemplate, err = naming.Parse(*template); err != nil {
+			usageFatalf("%v", err)
+		}
+	}
+	if *onConflict == "" {
+		*onConflict = extractor.ConflictPolicy(nameTemplate)
+	}
+	if err := cli.CheckChoice("on-conflict", *onConflict, output.Policies...); err != nil {
+		usageFatalf("%v", err)
+	}
+	if err := cli.CheckChoice("report", *reportFormat, report.FormatPlain, report.FormatJSON); err != nil {
+		usageFatalf("%v", err)
+	}
+	if err := cli.CheckChoice("plan-format", *planFormat, planText, planJSON); err != nil {
+		usageFatalf("%v", err)
+	}
+	rep, _ := report.New(*reportFormat, reportOutput(*dryRun))
+	writer, err := newWriter(*onConflict, *dryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts := extractor.Options{
+		IncludeSize:   *includeSize,
+		AllLevels:     allLevels,
+		Levels:        levels,
+		WriteMetadata: *writeMetadata,
+		WriteSidecar:  *writeSidecar,
+		Orient:        *orient,
+		Template:      nameTemplate,
+		Output:        writer,
+		Reporter:      rep,
+	}
+	if err := opts.CheckTemplate(); err != nil {
+		usageFatalf("%v", err)
+	}
+
+	if *previewsDir == "" {
+		*previewsDir = defaultPreviewsDir(*lightroomDB)
+	}
+
+	catalog, err := database.OpenCatalog(*lightroomDB)
+	if err != nil {
+		log.Fatalf("Failed to open Lightroom catalog: %v", err)
+	}
+	defer catalog.Close()
+
+	images, err := catalog.FindImages(filter)
+	if err != nil {
+		log.Fatalf("Failed to query catalog: %v", err)
+	}
+	rep.Logf(report.Info, "", "Found %d matching images in the catalog", len(images))
+
+	found, err := discover.Find(*previewsDir, discover.Options{})
+	if err != nil {
+		log.Fatalf("Failed to find previews: %v", err)
+	}
+	opts.Previews = openPreviewIndex(*previewsDB, *previewsDir)
+	previews := inventory.NewIndex(found.Files, opts.Previews)
+
+	var files []string
+	byFile := make(map[string]database.Image)
+	missing := 0
+	for _, image := range images {
+		file := previews.Find(image)
+		if file == "" {
+			missing++
+			rep.Logf(report.Warning, "", "No preview found for %s", filepath.Join(image.Location.Dir, image.Location.BaseName))
+			continue
+		}
+		files = append(files, file)
+		byFile[file] = image
+	}
+
+	failed := 0
+	pool.Run(files, workers, func(file string) error {
+		target, err := catalogTarget(catalog, byFile[file], *outputDirectory, opts)
+		if err != nil {
+			return err
+		}
+		return extractor.ExtractTo(file, target, opts)
+	}, func(r pool.Result[string]) {
+		rep.Progress(r.Index+1, len(files))
+		if r.Err != nil {
+			failed++
+		}
+		rep.Processed(r.Item, writer.Written(r.Item), r.Err)
+	})
+
+	finish(rep, writer, report.Summary{
+		Message: fmt.Sprintf("Export complete: %d images matched, %d extracted, %d failed, %d without preview",
+			len(images), len(files)-failed, failed, missing),
+		Counts: map[string]int{"matched": len(images), "extracted": len(files) - failed, "failed": failed, "missing": missing},
+	}, *planFormat)
+	return exitStatus(failed, false)
+}
+
+// catalogTarget places an image's output under the original's folder in
+// outputDir, reading the metadata and template fields opts needs.
+func catalogTarget(catalog *database.Catalog, image database.Image, outputDir string, opts extractor.Options) (extractor.Target, error) {
+	target := extractor.Target{
+		Dir:      filepath.Join(outputDir, image.Location.Dir),
+		BaseName: image.Location.BaseName,
+		Root:     outputDir,
+		Fields: naming.Fields{
+			UUID:     image.UUID,
+			BaseName: image.Location.BaseName,
+			Folder:   image.Location.Dir,
+			Rating:   image.Rating,
+		},
+	}
+	target.Fields.CaptureTime, _ = metadata.ParseCaptureTime(image.CaptureTime)
+	if opts.NeedsMetadata() || opts.Template != nil {
+		m, err := catalog.Metadata(image.UUID)
+		if errors.Is(err, metadata.ErrDevelop) {
+			opts.Reporter.Logf(report.Warning, image.Path, "Writing metadata without develop settings: %v", err)
+			err = nil
+		}
+		if err != nil {
+			return target, fmt.Errorf("error reading image metadata: %v", err)
+		}
+		target.Metadata = &m
+		target.Fields.Camera = m.Model
+	}
+	if opts.Template != nil {
+		info, err := catalog.ImageInfo(image.UUID)
+		if err != nil {
+			return target, fmt.Errorf("error reading image details: %v", err)
+		}
+		target.Fields.Ext = info.Extension
+		if len(info.Collections) > 0 {
+			target.Fields.Collection = info.Collections[0]
+		}
+	}
+	return target, nil
+}
+
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// defaultPreviewsDir returns where Lightroom keeps the previews of a catalog:
+// "<name> Previews.lrdata" next to "<name>.lrcat".
+func defaultPreviewsDir(catalogPath string) string {
+	name := strings.TrimSuffix(filepath.Base(catalogPath), filepath.Ext(catalogPath))
+	return filepath.Join(filepath.Dir(catalogPath), name+" Previews.lrdata")
+}
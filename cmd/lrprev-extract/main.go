@@ -1,46 +1,152 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"runtime"
+	"sort"
+	"syscall"
+	"time"
 
 	"lrprev-extract-go/internal/cli"
-	"lrprev-extract-go/internal/extractor"
+	"lrprev-extract-go/internal/discover"
+	"lrprev-extract-go/internal/journal"
+	"lrprev-extract-go/internal/pool"
+	"lrprev-extract-go/internal/watch"
+	"lrprev-extract-go/pkg/extractor"
+	"lrprev-extract-go/pkg/lrprev"
+	"lrprev-extract-go/pkg/naming"
+	"lrprev-extract-go/pkg/output"
+	"lrprev-extract-go/pkg/report"
 
 	"github.com/rivo/tview"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		os.Exit(runExport(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "sync" {
+		os.Exit(runSync(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "smart" {
+		os.Exit(runSmart(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "report" {
+		os.Exit(runReport(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "recover" {
+		os.Exit(runRecover(os.Args[2:]))
+	}
+	os.Exit(run())
+}
+
+// run extracts the previews named by the flags and returns the exit code.
+func run() int {
+
 	inputDir := flag.String("d", "", "Path to your lightroom directory (.lrdata)")
 	inputFile := flag.String("f", "", "Path to your file (.lrprev)")
 	outputDirectory := flag.String("o", "", "Path to output directory")
 	lightroomDB := flag.String("l", "", "Path to the lightroom catalog (.lrcat)")
 	includeSize := flag.Bool("include-size", false, "Include image size information in the output file name")
+	levelsFlag := flag.String("levels", "", "Pyramid levels to extract: 'all' or a comma separated list such as '1,3' (default: largest only)")
+	writeMetadata := flag.Bool("metadata", false, "Write EXIF and XMP metadata from the catalog (-l) into each JPEG")
+	writeSidecar := flag.Bool("xmp-sidecar", false, "Write an .xmp sidecar with the catalog metadata (-l) next to each JPEG")
+	orient := flag.String("orient", extractor.OrientNone, "Apply the preview orientation: none, exif (set the EXIF Orientation tag) or rotate (rotate losslessly)")
+	onConflict := flag.String("on-conflict", "", "What to do when an output file already exists: overwrite, skip, suffix or identical (skip if byte-identical, otherwise suffix) (default: overwrite, or suffix with -template)")
+	template := flag.String("template", "", "Output path template relative to -o, e.g. '{capture:2006/01/02}/{basename}_{width}x{height}.jpg'")
+	previewsDB := flag.String("previews-db", "", "Path to previews.db (default: found next to the input in Previews.lrdata)")
+	skipOrphans := flag.Bool("skip-orphans", false, "Do not extract previews that no catalog image refers to")
+	watchMode := flag.Bool("watch", false, "After processing -d, keep watching it and extract previews as Lightroom writes them")
+	watchQuiet := flag.Duration("watch-quiet", watch.DefaultQuiet, "How long a preview must go unchanged before -watch extracts it")
+	dryRun := flag.Bool("dry-run", false, "Resolve every preview, catalog path, output file and conflict and print the plan, writing nothing")
+	planFormat := flag.String("plan-format", planText, "Format of the -dry-run plan: text or json")
+	resume := flag.Bool("resume", true, "Skip previews the journal in the output directory records as extracted; -resume=false starts over")
+	var include, exclude cli.StringList
+	flag.Var(&include, "include", "Only process previews matching this glob (repeatable, e.g. 'A/**' or '*.lrprev')")
+	flag.Var(&exclude, "exclude", "Skip previews or directories matching this glob (repeatable)")
+	var workers int
+	flag.IntVar(&workers, "j", runtime.NumCPU(), "Number of files to process concurrently (shorthand for -workers)")
+	flag.IntVar(&workers, "workers", runtime.NumCPU(), "Number of files to process concurrently")
+	reportFormat := flag.String("report", "", "How to show progress: tui, plain (log lines) or json (one JSON event per line) (default: tui, or plain with -non-interactive)")
+	nonInteractive := flag.Bool("non-interactive", false, "Never prompt and do not start the TUI: missing -d/-f or -o is an error and other options keep their defaults (default: on when stdin is not a terminal)")
 	help := flag.Bool("help", false, "Show help information")
 	flag.Parse()
 
 	if *help {
 		printHelp()
-		return
+		return cli.ExitOK
 	}
-
-	if *inputDir == "" && *inputFile == "" {
-		*inputDir = cli.PromptForInput("Enter the path to your lightroom directory (.lrdata) or file (.lrprev): ")
+	interactive := !*nonInteractive && cli.IsTerminal(os.Stdin)
+	if *reportFormat == "" {
+		*reportFormat = report.FormatPlain
+		if interactive && !*dryRun {
+			*reportFormat = report.FormatTUI
+		}
 	}
-
-	if *outputDirectory == "" {
-		*outputDirectory = cli.PromptForInput("Enter the path to the output directory: ")
+	if err := cli.CheckChoice("report", *reportFormat, report.FormatTUI, report.FormatPlain, report.FormatJSON); err != nil {
+		usageFatalf("%v", err)
+	}
+	if *reportFormat == report.FormatTUI && !interactive {
+		usageFatalf("-report tui needs a terminal and cannot be used in non-interactive mode")
+	}
+	if *dryRun && (*reportFormat == report.FormatTUI || *watchMode) {
+		usageFatalf("-dry-run cannot be combined with -report tui or -watch")
+	}
+	if err := cli.CheckChoice("plan-format", *planFormat, planText, planJSON); err != nil {
+		usageFatalf("%v", err)
 	}
 
-	if *lightroomDB == "" {
-		*lightroomDB = cli.PromptForInput("Enter the path to the lightroom catalog (.lrcat) [optional]: ")
+	allLevels, levels, err := cli.ParseLevels(*levelsFlag)
+	if err != nil {
+		usageFatalf("Invalid -levels value: %v", err)
 	}
+	if err := cli.CheckChoice("orient", *orient, extractor.OrientNone, extractor.OrientEXIF, extractor.OrientRotate); err != nil {
+		usageFatalf("%v", err)
+	}
+	var nameTemplate *naming.Template
+	if *template != "" {
+		if nameTemplate, err = naming.Parse(*template); err != nil {
+			usageFatalf("%v", err)
+		}
+	}
+	if *onConflict == "" {
+		*onConflict = extractor.ConflictPolicy(nameTemplate)
+	}
+	if err := cli.CheckChoice("on-conflict", *onConflict, output.Policies...); err != nil {
+		usageFatalf("%v", err)
+	}
+	writer, err := newWriter(*onConflict, *dryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if interactive {
+		if *inputDir == "" && *inputFile == "" {
+			*inputDir = cli.PromptForInput("Enter the path to your lightroom directory (.lrdata) or file (.lrprev): ")
+		}
+
+		if *outputDirectory == "" {
+			*outputDirectory = cli.PromptForInput("Enter the path to the output directory: ")
+		}
+
+		if *lightroomDB == "" {
+			*lightroomDB = cli.PromptForInput("Enter the path to the lightroom catalog (.lrcat) [optional]: ")
+		}
 
-	if !*includeSize {
-		*includeSize = cli.PromptForBool("Include image size information in the output file name? (y/n): ")
+		if !*includeSize && !allLevels && levels == nil {
+			*includeSize = cli.PromptForBool("Include image size information in the output file name? (y/n): ")
+		}
+	} else if (*inputDir == "" && *inputFile == "") || *outputDirectory == "" {
+		usageFatalf("-d or -f and -o are required in non-interactive mode; see -help")
+	}
+	if (*writeMetadata || *writeSidecar) && *lightroomDB == "" {
+		usageFatalf("-metadata and -xmp-sidecar read the catalog and require -l")
 	}
 
 	inputPath := *inputDir
@@ -48,7 +154,44 @@ func main() {
 		inputPath = *inputFile
 	}
 
-	err := os.MkdirAll(*outputDirectory, os.ModePerm)
+	var app *tview.Application
+	var tui *report.TUI
+	var rep report.Reporter
+	if *reportFormat == report.FormatTUI {
+		app = tview.NewApplication()
+		tui = report.NewTUI(app)
+		rep = tui
+	} else {
+		rep, _ = report.New(*reportFormat, reportOutput(*dryRun))
+	}
+
+	opts := extractor.Options{
+		IncludeSize:   *includeSize,
+		AllLevels:     allLevels,
+		Levels:        levels,
+		WriteMetadata: *writeMetadata,
+		WriteSidecar:  *writeSidecar,
+		Orient:        *orient,
+		Template:      nameTemplate,
+		Output:        writer,
+		Reporter:      rep,
+	}
+	if err := opts.CheckTemplate(); err != nil {
+		usageFatalf("%v", err)
+	}
+
+	if *lightroomDB != "" {
+		catalog, err := lrprev.OpenCatalog(*lightroomDB)
+		if err != nil {
+			log.Fatalf("Failed to open Lightroom catalog: %v", err)
+		}
+		defer catalog.Close()
+		opts.Catalog = catalog
+	}
+
+	opts.Previews = openPreviewIndex(*previewsDB, inputPath)
+
+	err = writer.MkdirAll(*outputDirectory)
 	if err != nil {
 		log.Fatalf("Failed to create output directory: %v", err)
 	}
@@ -57,79 +200,343 @@ func main() {
 	if err != nil {
 		log.Fatalf("Error accessing input path: %v", err)
 	}
+	if *watchMode && !fileInfo.IsDir() {
+		usageFatalf("-watch requires a directory (-d)")
+	}
 
-	app := tview.NewApplication()
-	flex := tview.NewFlex().SetDirection(tview.FlexRow)
-
-	// Create a text view for logs
-	logView := tview.NewTextView().
-		SetDynamicColors(true).
-		SetScrollable(true).
-		SetChangedFunc(func() {
-			app.Draw()
-		})
+	var jrnl *journal.Journal
+	if fileInfo.IsDir() {
+		if *dryRun {
+			jrnl, err = journal.Load(*outputDirectory, journalSettings(*lightroomDB, *levelsFlag, *template, opts))
+		} else {
+			jrnl, err = journal.Open(*outputDirectory, journalSettings(*lightroomDB, *levelsFlag, *template, opts))
+		}
+		if err != nil {
+			log.Fatalf("Failed to open journal: %v", err)
+		}
+		defer jrnl.Close()
+		if !*resume {
+			if err := jrnl.Reset(); err != nil {
+				log.Fatalf("Failed to reset journal: %v", err)
+			}
+		}
+	}
 
-	// Create a gauge for progress
-	gauge := tview.NewTextView().
-		SetDynamicColors(true).
-		SetTextAlign(tview.AlignCenter)
+	processed, failed, skipped := 0, 0, 0
+	// broken is set when the run could not start, e.g. the input vanished.
+	broken := false
+	record := func(file string, err error) {
+		if err != nil {
+			failed++
+		} else {
+			processed++
+		}
+		rep.Processed(file, writer.Written(file), err)
+	}
 
-	// Add items to the flex container
-	flex.AddItem(gauge, 1, 0, false)
-	flex.AddItem(logView, 0, 1, false)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	go func() {
+	work := func() {
 		if fileInfo.IsDir() {
-			files, err := filepath.Glob(filepath.Join(inputPath, "**/*.lrprev"))
+			found, err := discover.Find(inputPath, discover.Options{Include: include, Exclude: exclude})
 			if err != nil {
-				fmt.Fprintf(logView, "[red]Error finding .lrprev files: %v\n", err)
-				app.Stop()
+				rep.Logf(report.Error, "", "Error finding .lrprev files: %v", err)
+				broken = true
 				return
 			}
+			files := found.Files
 
-			totalFiles := len(files)
-			for i, file := range files {
-				progress := int(float64(i+1) / float64(totalFiles) * 100)
-				gauge.Clear()
-				fmt.Fprintf(gauge, "[yellow]Progress: [white]%d%%", progress)
-				app.Draw()
-
-				err := processFile(file, *outputDirectory, *lightroomDB, *includeSize, logView)
-				if err != nil {
-					fmt.Fprintf(logView, "[red]Error processing file %s: %v\n", file, err)
+			if opts.Catalog != nil {
+				rep.Logf(report.Info, "", "Loading Lightroom catalog")
+				if err := opts.Catalog.Preload(); err != nil {
+					rep.Logf(report.Error, "", "Error loading catalog: %v", err)
 				}
 			}
-		} else {
-			gauge.Clear()
-			fmt.Fprintf(gauge, "[yellow]Progress: [white]0%%")
-			err = processFile(inputPath, *outputDirectory, *lightroomDB, *includeSize, logView)
-			if err != nil {
-				fmt.Fprintf(logView, "[red]Error processing file: %v\n", err)
+
+			if opts.Previews != nil {
+				var orphans []string
+				files, orphans = findOrphans(files, opts, rep)
+				if len(orphans) > 0 {
+					rep.Logf(report.Warning, "", "Found %d orphaned previews that no image refers to", len(orphans))
+					for _, orphan := range orphans {
+						rep.Logf(report.Warning, orphan, "Orphaned preview: %s", orphan)
+					}
+				}
+				if !*skipOrphans {
+					files = append(files, orphans...)
+					sort.Strings(files)
+				}
+			}
+			rep.Logf(report.Info, "", "Found %d .lrprev files", len(files))
+			if len(found.Skipped) > 0 {
+				rep.Logf(report.Warning, "", "Skipped %d entries: %s", len(found.Skipped), found.SkipSummary())
+			}
+
+			files, done := jrnl.Pending(files)
+			skipped = len(done)
+			if len(done) > 0 {
+				rep.Logf(report.Info, "", "Skipping %d previews already extracted according to %s", len(done), jrnl.Path())
 			}
-			fmt.Fprintf(gauge, "[yellow]Progress: [white]100%%")
+
+			totalFiles := len(files)
+			pool.Run(files, workers, func(file string) error {
+				return processFile(file, *outputDirectory, *lightroomDB, opts)
+			}, func(r pool.Result[string]) {
+				rep.Progress(r.Index+1, totalFiles)
+				record(r.Item, r.Err)
+				if err := jrnl.Record(r.Item, writer.Written(r.Item), r.Err); err != nil {
+					rep.Logf(report.Error, r.Item, "Error updating journal: %v", err)
+				}
+			})
+		} else {
+			rep.Progress(0, 1)
+			rep.Logf(report.Info, inputPath, "Processing file: %s", inputPath)
+			record(inputPath, processFile(inputPath, *outputDirectory, *lightroomDB, opts))
+			rep.Progress(1, 1)
+		}
+
+		finish(rep, writer, report.Summary{
+			Message: fmt.Sprintf("Processing complete: %d extracted, %d failed, %d already extracted", processed, failed, skipped),
+			Counts:  map[string]int{"extracted": processed, "failed": failed, "skipped": skipped},
+		}, *planFormat)
+
+		if *watchMode {
+			watchDirectory(ctx, inputPath, *outputDirectory, *lightroomDB, *watchQuiet, include, exclude, opts, jrnl, writer, record)
 		}
+	}
+
+	if tui == nil {
+		if *watchMode {
+			// Stop watching on Ctrl+C or when a service manager stops the tool.
+			ctx, cancel = signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+		}
+		work()
+		return exitStatus(failed, broken)
+	}
 
-		fmt.Fprintln(logView, "[green]Processing complete!")
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		work()
 		app.Stop()
 	}()
 
-	if err := app.SetRoot(flex, true).Run(); err != nil {
+	if err := app.SetRoot(tui.Root(), true).Run(); err != nil {
 		log.Fatalf("Error running application: %v", err)
 	}
+	if *watchMode {
+		// Let the file being extracted finish before the journal closes.
+		cancel()
+		<-finished
+	}
+	select {
+	case <-finished:
+		return exitStatus(failed, broken)
+	default:
+		// The TUI was closed before the run finished.
+		return cli.ExitError
+	}
+}
+
+// Formats of the -dry-run plan.
+const (
+	planText = "text"
+	planJSON = "json"
+)
+
+// newWriter returns the Writer of a run, which only plans its files for
+// -dry-run.
+func newWriter(policy string, dryRun bool) (*output.Writer, error) {
+	if dryRun {
+		return output.NewDryRunWriter(policy)
+	}
+	return output.NewWriter(policy)
+}
+
+// reportOutput is where progress goes: standard error for dry runs, so that
+// standard output carries only the plan.
+func reportOutput(dryRun bool) io.Writer {
+	if dryRun {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// finish reports the conflicts and summary of a run and, for a dry run,
+// prints the plan to standard output.
+func finish(rep report.Reporter, writer *output.Writer, summary report.Summary, planFormat string) {
+	logConflicts(rep, writer)
+	if writer.DryRun() {
+		summary.Message = "Dry run, nothing written. " + summary.Message
+	}
+	rep.Complete(summary)
+	if !writer.DryRun() {
+		return
+	}
+
+	plan := writer.Plan()
+	var err error
+	if planFormat == planJSON {
+		err = plan.WriteJSON(os.Stdout)
+	} else {
+		err = plan.WriteText(os.Stdout)
+	}
+	if err != nil {
+		log.Printf("Failed to write plan: %v", err)
+	}
+}
+
+// exitStatus is the exit code of a run in which failed previews could not be
+// extracted, or which could not start when broken is set.
+func exitStatus(failed int, broken bool) int {
+	switch {
+	case broken:
+		return cli.ExitError
+	case failed > 0:
+		return cli.ExitPartial
+	}
+	return cli.ExitOK
+}
+
+// usageFatalf reports an invalid or missing flag and exits with
+// cli.ExitUsage.
+func usageFatalf(format string, args ...interface{}) {
+	log.Printf(format, args...)
+	os.Exit(cli.ExitUsage)
+}
+
+// openPreviewIndex opens the -previews-db index, or else the previews.db
+// found for the previews at path. Only an index given explicitly has to
+// open; a found one that does not is skipped with a warning.
+func openPreviewIndex(explicit, path string) *lrprev.PreviewIndex {
+	if explicit != "" {
+		previews, err := lrprev.OpenPreviewIndex(explicit)
+		if err != nil {
+			log.Fatalf("Failed to open preview index: %v", err)
+		}
+		return previews
+	}
+
+	found, ok := lrprev.FindPreviewIndex(path)
+	if !ok {
+		return nil
+	}
+	previews, err := lrprev.OpenPreviewIndex(found)
+	if err != nil {
+		log.Printf("Warning: ignoring preview index %s: %v", found, err)
+		return nil
+	}
+	return previews
+}
+
+// watchDirectory extracts previews Lightroom writes under dir until ctx is
+// done, recording each in the journal.
+func watchDirectory(ctx context.Context, dir, outputDir, dbPath string, quiet time.Duration, include, exclude []string, opts extractor.Options, jrnl *journal.Journal, writer *output.Writer, record func(file string, err error)) {
+	rep := opts.Reporter
+	if opts.Catalog != nil {
+		// Previews of newly imported images are not in the preloaded catalog.
+		opts.Catalog.Unload()
+	}
+	rep.Logf(report.Info, "", "Watching %s for new previews (Ctrl+C to stop)", dir)
+
+	err := watch.Watch(ctx, dir, watch.Options{
+		Quiet:   quiet,
+		Include: include,
+		Exclude: exclude,
+		Logf: func(format string, args ...interface{}) {
+			rep.Logf(report.Warning, "", format, args...)
+		},
+	}, func(file string) {
+		// A re-rendered preview replaces what it wrote before.
+		writer.Release(file)
+		err := processFile(file, outputDir, dbPath, opts)
+		record(file, err)
+		if err := jrnl.Record(file, writer.Written(file), err); err != nil {
+			rep.Logf(report.Error, file, "Error updating journal: %v", err)
+		}
+	})
+	if err != nil {
+		rep.Logf(report.Error, "", "Error watching %s: %v", dir, err)
+	}
 }
 
-func processFile(filePath, outputDir, dbPath string, includeSize bool, logView *tview.TextView) error {
-	fmt.Fprintf(logView, "Processing file: %s\n", filePath)
-	return extractor.ExtractLargestJPEGFromLRPREV(filePath, outputDir, dbPath, includeSize)
+func processFile(filePath, outputDir, dbPath string, opts extractor.Options) error {
+	return extractor.Extract(filePath, outputDir, dbPath, opts)
+}
+
+// findOrphans splits files into previews referenced by an image and orphans,
+// using previews.db and, when a catalog is open, its list of images.
+func findOrphans(files []string, opts extractor.Options, rep report.Reporter) ([]string, []string) {
+	var imageIDs map[int64]bool
+	if opts.Catalog != nil {
+		ids, err := opts.Catalog.ImageIDs()
+		if err != nil {
+			rep.Logf(report.Error, "", "Error reading catalog images: %v", err)
+		} else {
+			imageIDs = ids
+		}
+	}
+
+	var referenced, orphans []string
+	for _, file := range files {
+		uuid, err := extractor.PreviewUUID(file, opts)
+		if err == nil && opts.Previews.IsOrphan(uuid, imageIDs) {
+			orphans = append(orphans, file)
+		} else {
+			referenced = append(referenced, file)
+		}
+	}
+	return referenced, orphans
+}
+
+// journalSettings describes the options that change what is written, so a
+// rerun with different options does not skip previews.
+func journalSettings(lightroomDB, levels, template string, opts extractor.Options) string {
+	return fmt.Sprintf("catalog=%s levels=%s include-size=%t metadata=%t xmp-sidecar=%t orient=%s template=%s",
+		lightroomDB, levels, opts.IncludeSize, opts.WriteMetadata, opts.WriteSidecar, opts.Orient, template)
+}
+
+// logConflicts adds the output collisions of the run to the log.
+func logConflicts(rep report.Reporter, writer *output.Writer) {
+	conflicts := writer.Conflicts()
+	if len(conflicts) == 0 {
+		return
+	}
+	rep.Logf(report.Warning, "", "%s", writer.Summary())
+	for _, c := range conflicts {
+		rep.Logf(report.Warning, c.Source, "Conflict: %s", c)
+	}
 }
 
 func printHelp() {
 	fmt.Println("lrprev-extract-go: Extract JPEG images from Lightroom preview files")
 	fmt.Println("\nUsage:")
 	fmt.Println("  lrprev-extract [options]")
+	fmt.Println("  lrprev-extract export [options]   Extract previews of catalog images matching filters")
+	fmt.Println("  lrprev-extract sync [options]     Bring an output tree up to date with changed previews")
+	fmt.Println("  lrprev-extract smart [options]    Extract Smart Previews, optionally decoded to JPEG or TIFF")
+	fmt.Println("  lrprev-extract report [options]   Report the best recovery source left for each catalog image")
+	fmt.Println("  lrprev-extract recover [options]  Rebuild missing originals from their best preview under another root")
 	fmt.Println("\nOptions:")
 	flag.PrintDefaults()
+	fmt.Println("\nExit codes: 0 success, 1 error, 2 invalid or missing flags, 3 some previews failed")
 	fmt.Println("\nExamples:")
 	fmt.Println("  lrprev-extract -d /path/to/lightroom/directory -o /path/to/output")
 	fmt.Println("  lrprev-extract -f /path/to/file.lrprev -o /path/to/output -l /path/to/catalog.lrcat")
+	fmt.Println("  lrprev-extract -d /path/to/lightroom/directory -o /path/to/output -levels all")
+	fmt.Println("  lrprev-extract -d /path/to/lightroom/directory -o /path/to/output -j 8")
+	fmt.Println("  lrprev-extract -d /path/to/lightroom/directory -o /path/to/output -orient rotate")
+	fmt.Println("  lrprev-extract -d /path/to/lightroom/directory -o /path/to/output -on-conflict identical")
+	fmt.Println("  lrprev-extract -d /path/to/Previews.lrdata -o /path/to/output -l catalog.lrcat -watch")
+	fmt.Println("  lrprev-extract -d /path/to/Previews.lrdata -o /path/to/output -non-interactive")
+	fmt.Println("  lrprev-extract -d /path/to/Previews.lrdata -o /path/to/output -report json > events.jsonl")
+	fmt.Println("  lrprev-extract sync -d /path/to/Previews.lrdata -o /path/to/output -l catalog.lrcat -delete")
+	fmt.Println("  lrprev-extract export -l catalog.lrcat -o /path/to/output -collection '2025 Wedding' -min-rating 4 -pick picked")
+	fmt.Println("  lrprev-extract smart -l catalog.lrcat -o /path/to/output -convert tiff")
+	fmt.Println("  lrprev-extract report -l catalog.lrcat -format json -missing > missing.json")
+	fmt.Println("  lrprev-extract recover -l catalog.lrcat -o /path/to/rebuilt")
+	fmt.Println("  lrprev-extract -d /path/to/Previews.lrdata -o /path/to/output -l catalog.lrcat -dry-run")
+	fmt.Println("  lrprev-extract -d /path/to/Previews.lrdata -o /path/to/output -include 'A/**' -exclude '*-old.lrprev'")
 }
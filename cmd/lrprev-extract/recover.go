@@ -0,0 +1,164 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"runtime"
+
+	"lrprev-extract-go/internal/cli"
+	"lrprev-extract-go/internal/database"
+	"lrprev-extract-go/internal/inventory"
+	"lrprev-extract-go/internal/pool"
+	"lrprev-extract-go/pkg/extractor"
+	"lrprev-extract-go/pkg/output"
+	"lrprev-extract-go/pkg/report"
+)
+
+// runRecover rebuilds the part of a library whose originals are gone: each
+// missing original is replaced by its best preview, written to the
+// original's path under another root.
+func runRecover(args []string) int {
+	fs := flag.NewFlagSet("recover", flag.ExitOnError)
+	lightroomDB := fs.String("l", "", "Path to the lightroom catalog (.lrcat)")
+	outputRoot := fs.String("o", "", "Root to rebuild the missing originals' folders under")
+	previewsDir := fs.String("d", "", "Path to the Previews.lrdata directory (default: next to the catalog)")
+	smartDir := fs.String("s", "", "Path to the Smart Previews.lrdata directory (default: next to the catalog)")
+	previewsDB := fs.String("previews-db", "", "Path to previews.db (default: found in the Previews.lrdata directory)")
+	convert := fs.String("convert", extractor.SmartJPEG, "How to write images recovered from smart previews: jpeg or tiff (decode the full smart preview), or embedded (its small JPEG preview)")
+	writeMetadata := fs.Bool("metadata", false, "Write EXIF and XMP metadata from the catalog into each JPEG")
+	writeSidecar := fs.Bool("xmp-sidecar", false, "Write an .xmp sidecar with the catalog metadata next to each image")
+	orient := fs.String("orient", extractor.OrientNone, "Apply the preview orientation: none, exif (set the Orientation tag) or rotate")
+	onConflict := fs.String("on-conflict", output.Identical, "What to do when an output file already exists: overwrite, skip, suffix or identical (skip if byte-identical, otherwise suffix)")
+	var workers int
+	fs.IntVar(&workers, "j", runtime.NumCPU(), "Number of images to process concurrently (shorthand for -workers)")
+	fs.IntVar(&workers, "workers", runtime.NumCPU(), "Number of images to process concurrently")
+	dryRun := fs.Bool("dry-run", false, "Resolve every preview, catalog path, output file and conflict and print the plan, writing nothing")
+	planFormat := fs.String("plan-format", planText, "Format of the -dry-run plan: text or json")
+	reportFormat := fs.String("report", report.FormatPlain, "How to show progress: plain (log lines) or json (one JSON event per line)")
+	fs.Usage = func() {
+		fmt.Println("Usage:\n  lrprev-extract recover -l <catalog.lrcat> -o <root> [options]")
+		fmt.Println("\nOptions:")
+		fs.PrintDefaults()
+		fmt.Println("\nExamples:")
+		fmt.Println("  lrprev-extract recover -l catalog.lrcat -o /Volumes/Rebuilt")
+		fmt.Println("  lrprev-extract recover -l catalog.lrcat -o /Volumes/Rebuilt -convert tiff -xmp-sidecar")
+	}
+	_ = fs.Parse(args)
+
+	if *lightroomDB == "" || *outputRoot == "" {
+		fs.Usage()
+		return cli.ExitUsage
+	}
+
+	if err := cli.CheckChoice("convert", *convert, extractor.SmartEmbedded, extractor.SmartJPEG, extractor.SmartTIFF); err != nil {
+		usageFatalf("%v", err)
+	}
+	if err := cli.CheckChoice("orient", *orient, extractor.OrientNone, extractor.OrientEXIF, extractor.OrientRotate); err != nil {
+		usageFatalf("%v", err)
+	}
+	if err := cli.CheckChoice("on-conflict", *onConflict, output.Policies...); err != nil {
+		usageFatalf("%v", err)
+	}
+	if err := cli.CheckChoice("report", *reportFormat, report.FormatPlain, report.FormatJSON); err != nil {
+		usageFatalf("%v", err)
+	}
+	if err := cli.CheckChoice("plan-format", *planFormat, planText, planJSON); err != nil {
+		usageFatalf("%v", err)
+	}
+	rep, _ := report.New(*reportFormat, reportOutput(*dryRun))
+	writer, err := newWriter(*onConflict, *dryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts := extractor.Options{
+		WriteMetadata: *writeMetadata,
+		WriteSidecar:  *writeSidecar,
+		Orient:        *orient,
+		Output:        writer,
+		Reporter:      rep,
+		Smart:         *convert,
+	}
+
+	if *previewsDir == "" {
+		*previewsDir = defaultPreviewsDir(*lightroomDB)
+	}
+	if *smartDir == "" {
+		*smartDir = defaultSmartPreviewsDir(*lightroomDB)
+	}
+	inventoryOpts := inventory.Options{PreviewsDir: *previewsDir, SmartPreviewsDir: *smartDir, Workers: workers}
+	previews := openPreviewIndex(*previewsDB, *previewsDir)
+	inventoryOpts.Previews = previews
+	opts.Previews = previews
+
+	catalog, err := database.OpenCatalog(*lightroomDB)
+	if err != nil {
+		log.Fatalf("Failed to open Lightroom catalog: %v", err)
+	}
+	defer catalog.Close()
+	images, err := catalog.FindImages(database.ImageFilter{})
+	if err != nil {
+		log.Fatalf("Failed to query catalog: %v", err)
+	}
+
+	rep.Logf(report.Info, "", "Checking %d catalog images for missing originals", len(images))
+	entries, err := inventory.Build(images, inventoryOpts)
+	if err != nil {
+		log.Fatalf("Failed to find previews: %v", err)
+	}
+	// Virtual copies share their master's original, which is recovered once
+	// from the best preview of the whole group.
+	entries = inventory.Masters(entries)
+	copies := len(images) - len(entries)
+	missing := inventory.Missing(entries)
+
+	var recoverable []inventory.Entry
+	for _, e := range missing {
+		if e.Best == inventory.SourceNone {
+			rep.Logf(report.Warning, "", "No preview left for %s", e.Original)
+			continue
+		}
+		recoverable = append(recoverable, e)
+	}
+	unrecoverable := len(missing) - len(recoverable)
+	rep.Logf(report.Info, "", "Found %d missing originals, %d with a preview to recover from", len(missing), len(recoverable))
+
+	if err := writer.MkdirAll(*outputRoot); err != nil {
+		log.Fatalf("Failed to create output directory: %v", err)
+	}
+
+	failed := 0
+	pool.Run(recoverable, workers, func(e inventory.Entry) error {
+		target, err := catalogTarget(catalog, e.Image(), *outputRoot, opts)
+		if err != nil {
+			return err
+		}
+		if e.Best == inventory.SourceSmartPreview {
+			err := extractor.ExtractSmartPreviewTo(e.BestPath, target, opts)
+			if err == nil || e.Preview == "" {
+				return err
+			}
+			rep.Logf(report.Warning, e.BestPath, "Falling back to the preview: %v", err)
+			return extractor.ExtractTo(e.Preview, target, opts)
+		}
+		return extractor.ExtractTo(e.BestPath, target, opts)
+	}, func(r pool.Result[inventory.Entry]) {
+		e := r.Item
+		written := writer.Written(e.BestPath)
+		if e.Best == inventory.SourceSmartPreview && e.Preview != "" {
+			written = append(written, writer.Written(e.Preview)...)
+		}
+		rep.Progress(r.Index+1, len(recoverable))
+		if r.Err != nil {
+			failed++
+		}
+		rep.Processed(e.BestPath, written, r.Err)
+	})
+
+	finish(rep, writer, report.Summary{
+		Message: fmt.Sprintf("Recovery complete: %d missing originals, %d recovered, %d failed, %d without preview, %d virtual copies skipped",
+			len(missing), len(recoverable)-failed, failed, unrecoverable, copies),
+		Counts: map[string]int{"missing": len(missing), "recovered": len(recoverable) - failed, "failed": failed, "unrecoverable": unrecoverable, "virtual_copies": copies},
+	}, *planFormat)
+	return exitStatus(failed, false)
+}
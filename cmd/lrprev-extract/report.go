@@ -0,0 +1,104 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"runtime"
+
+	"lrprev-extract-go/internal/cli"
+	"lrprev-extract-go/internal/database"
+	"lrprev-extract-go/internal/inventory"
+)
+
+const (
+	reportCSV  = "csv"
+	reportJSON = "json"
+)
+
+// runReport lists, for every catalog image, whether its original is still on
+// disk and which previews are left to recover it from.
+func runReport(args []string) int {
+	fs := flag.NewFlagSet("report", flag.ExitOnError)
+	lightroomDB := fs.String("l", "", "Path to the lightroom catalog (.lrcat)")
+	previewsDir := fs.String("d", "", "Path to the Previews.lrdata directory (default: next to the catalog)")
+	smartDir := fs.String("s", "", "Path to the Smart Previews.lrdata directory (default: next to the catalog)")
+	previewsDB := fs.String("previews-db", "", "Path to previews.db (default: found in the Previews.lrdata directory)")
+	format := fs.String("format", reportCSV, "Report format: csv or json")
+	outputFile := fs.String("o", "", "Write the report to this file (default: standard output)")
+	missing := fs.Bool("missing", false, "Only list images whose original is missing")
+	var workers int
+	fs.IntVar(&workers, "j", runtime.NumCPU(), "Number of images to check concurrently (shorthand for -workers)")
+	fs.IntVar(&workers, "workers", runtime.NumCPU(), "Number of images to check concurrently")
+	fs.Usage = func() {
+		fmt.Println("Usage:\n  lrprev-extract report -l <catalog.lrcat> [options]")
+		fmt.Println("\nOptions:")
+		fs.PrintDefaults()
+		fmt.Println("\nExamples:")
+		fmt.Println("  lrprev-extract report -l catalog.lrcat -o recovery.csv")
+		fmt.Println("  lrprev-extract report -l catalog.lrcat -format json -missing")
+	}
+	_ = fs.Parse(args)
+
+	if *lightroomDB == "" {
+		fs.Usage()
+		return cli.ExitUsage
+	}
+	if err := cli.CheckChoice("format", *format, reportCSV, reportJSON); err != nil {
+		usageFatalf("%v", err)
+	}
+
+	if *previewsDir == "" {
+		*previewsDir = defaultPreviewsDir(*lightroomDB)
+	}
+	if *smartDir == "" {
+		*smartDir = defaultSmartPreviewsDir(*lightroomDB)
+	}
+	opts := inventory.Options{PreviewsDir: *previewsDir, SmartPreviewsDir: *smartDir, Workers: workers}
+	opts.Previews = openPreviewIndex(*previewsDB, *previewsDir)
+
+	catalog, err := database.OpenCatalog(*lightroomDB)
+	if err != nil {
+		log.Fatalf("Failed to open Lightroom catalog: %v", err)
+	}
+	defer catalog.Close()
+	images, err := catalog.FindImages(database.ImageFilter{})
+	if err != nil {
+		log.Fatalf("Failed to query catalog: %v", err)
+	}
+
+	entries, err := inventory.Build(images, opts)
+	if err != nil {
+		log.Fatalf("Failed to find previews: %v", err)
+	}
+	counts := inventory.Counts(entries)
+	if *missing {
+		entries = inventory.Missing(entries)
+	}
+
+	var out io.Writer = os.Stdout
+	if *outputFile != "" {
+		f, err := os.Create(*outputFile)
+		if err != nil {
+			log.Fatalf("Failed to create report: %v", err)
+		}
+		defer f.Close()
+		out = f
+	}
+	if *format == reportJSON {
+		err = inventory.WriteJSON(out, entries)
+	} else {
+		err = inventory.WriteCSV(out, entries)
+	}
+	if err != nil {
+		log.Printf("Failed to write report: %v", err)
+		return cli.ExitError
+	}
+
+	fmt.Fprintf(os.Stderr, "%d images: %d originals on disk, %d recoverable from a preview, %d from a smart preview, %d with no source\n",
+		len(images), counts[inventory.SourceOriginal], counts[inventory.SourcePreview],
+		counts[inventory.SourceSmartPreview], counts[inventory.SourceNone])
+	return cli.ExitOK
+}
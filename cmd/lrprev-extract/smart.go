@@ -0,0 +1,158 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"lrprev-extract-go/internal/cli"
+	"lrprev-extract-go/internal/discover"
+	"lrprev-extract-go/internal/pool"
+	"lrprev-extract-go/pkg/extractor"
+	"lrprev-extract-go/pkg/lrprev"
+	"lrprev-extract-go/pkg/naming"
+	"lrprev-extract-go/pkg/output"
+	"lrprev-extract-go/pkg/report"
+)
+
+// runSmart extracts Smart Previews, which are often the only full size copy
+// left of an offline original.
+func runSmart(args []string) int {
+	fs := flag.NewFlagSet("smart", flag.ExitOnError)
+	lightroomDB := fs.String("l", "", "Path to the lightroom catalog (.lrcat)")
+	smartDir := fs.String("d", "", "Path to the Smart Previews.lrdata directory (default: next to the catalog)")
+	outputDirectory := fs.String("o", "", "Path to output directory")
+	convert := fs.String("convert", extractor.SmartEmbedded, "What to write: embedded (the JPEG preview inside the DNG), jpeg or tiff (decode the full smart preview)")
+	includeSize := fs.Bool("include-size", false, "Include image size information in the output file name")
+	writeMetadata := fs.Bool("metadata", false, "Write EXIF and XMP metadata from the catalog (-l) into each JPEG")
+	writeSidecar := fs.Bool("xmp-sidecar", false, "Write an .xmp sidecar with the catalog metadata (-l) next to each image")
+	orient := fs.String("orient", extractor.OrientNone, "Apply the smart preview orientation: none, exif (set the Orientation tag) or rotate")
+	onConflict := fs.String("on-conflict", "", "What to do when an output file already exists: overwrite, skip, suffix or identical (skip if byte-identical, otherwise suffix) (default: overwrite, or suffix with -template)")
+	template := fs.String("template", "", "Output path template relative to -o, e.g. '{capture:2006/01/02}/{basename}_{width}x{height}.jpg'")
+	var include, exclude cli.StringList
+	fs.Var(&include, "include", "Only process smart previews matching this glob (repeatable)")
+	fs.Var(&exclude, "exclude", "Skip smart previews matching this glob (repeatable)")
+	var workers int
+	fs.IntVar(&workers, "j", runtime.NumCPU(), "Number of files to process concurrently (shorthand for -workers)")
+	fs.IntVar(&workers, "workers", runtime.NumCPU(), "Number of files to process concurrently")
+	dryRun := fs.Bool("dry-run", false, "Resolve every preview, catalog path, output file and conflict and print the plan, writing nothing")
+	planFormat := fs.String("plan-format", planText, "Format of the -dry-run plan: text or json")
+	reportFormat := fs.String("report", report.FormatPlain, "How to show progress: plain (log lines) or json (one JSON event per line)")
+	fs.Usage = func() {
+		fmt.Println("Usage:\n  lrprev-extract smart -l <catalog.lrcat> -o <output> [options]")
+		fmt.Println("\nOptions:")
+		fs.PrintDefaults()
+		fmt.Println("\nExamples:")
+		fmt.Println("  lrprev-extract smart -l catalog.lrcat -o out")
+		fmt.Println("  lrprev-extract smart -l catalog.lrcat -d 'catalog Smart Previews.lrdata' -o out -convert tiff")
+	}
+	_ = fs.Parse(args)
+
+	if (*lightroomDB == "" && *smartDir == "") || *outputDirectory == "" {
+		fs.Usage()
+		return cli.ExitUsage
+	}
+	if (*writeMetadata || *writeSidecar) && *lightroomDB == "" {
+		usageFatalf("-metadata and -xmp-sidecar read the catalog and require -l")
+	}
+
+	if err := cli.CheckChoice("convert", *convert, extractor.SmartEmbedded, extractor.SmartJPEG, extractor.SmartTIFF); err != nil {
+		usageFatalf("%v", err)
+	}
+	if err := cli.CheckChoice("orient", *orient, extractor.OrientNone, extractor.OrientEXIF, extractor.OrientRotate); err != nil {
+		usageFatalf("%v", err)
+	}
+	var nameTemplate *naming.Template
+	if *template != "" {
+		var err error
+		if nameTemplate, err = naming.Parse(*template); err != nil {
+			usageFatalf("%v", err)
+		}
+	}
+	if *onConflict == "" {
+		*onConflict = extractor.ConflictPolicy(nameTemplate)
+	}
+	if err := cli.CheckChoice("on-conflict", *onConflict, output.Policies...); err != nil {
+		usageFatalf("%v", err)
+	}
+	if err := cli.CheckChoice("report", *reportFormat, report.FormatPlain, report.FormatJSON); err != nil {
+		usageFatalf("%v", err)
+	}
+	if err := cli.CheckChoice("plan-format", *planFormat, planText, planJSON); err != nil {
+		usageFatalf("%v", err)
+	}
+	rep, _ := report.New(*reportFormat, reportOutput(*dryRun))
+	writer, err := newWriter(*onConflict, *dryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts := extractor.Options{
+		IncludeSize:   *includeSize,
+		WriteMetadata: *writeMetadata,
+		WriteSidecar:  *writeSidecar,
+		Orient:        *orient,
+		Template:      nameTemplate,
+		Output:        writer,
+		Reporter:      rep,
+		Smart:         *convert,
+	}
+
+	if *smartDir == "" {
+		*smartDir = defaultSmartPreviewsDir(*lightroomDB)
+	}
+	if *lightroomDB != "" {
+		catalog, err := lrprev.OpenCatalog(*lightroomDB)
+		if err != nil {
+			log.Fatalf("Failed to open Lightroom catalog: %v", err)
+		}
+		defer catalog.Close()
+		opts.Catalog = catalog
+	}
+
+	if err := writer.MkdirAll(*outputDirectory); err != nil {
+		log.Fatalf("Failed to create output directory: %v", err)
+	}
+
+	found, err := discover.Find(*smartDir, discover.Options{Include: include, Exclude: exclude, Extension: ".dng"})
+	if err != nil {
+		log.Fatalf("Failed to find smart previews: %v", err)
+	}
+	files := found.Files
+	rep.Logf(report.Info, "", "Found %d smart previews", len(files))
+	if len(found.Skipped) > 0 {
+		rep.Logf(report.Warning, "", "Skipped %d entries: %s", len(found.Skipped), found.SkipSummary())
+	}
+	if opts.Catalog != nil {
+		rep.Logf(report.Info, "", "Loading Lightroom catalog")
+		if err := opts.Catalog.Preload(); err != nil {
+			rep.Logf(report.Error, "", "Error loading catalog: %v", err)
+		}
+	}
+
+	failed := 0
+	pool.Run(files, workers, func(file string) error {
+		return extractor.ExtractSmartPreview(file, *outputDirectory, "", opts)
+	}, func(r pool.Result[string]) {
+		rep.Progress(r.Index+1, len(files))
+		if r.Err != nil {
+			failed++
+		}
+		rep.Processed(r.Item, writer.Written(r.Item), r.Err)
+	})
+
+	finish(rep, writer, report.Summary{
+		Message: fmt.Sprintf("Smart preview extraction complete: %d extracted, %d failed", len(files)-failed, failed),
+		Counts:  map[string]int{"extracted": len(files) - failed, "failed": failed},
+	}, *planFormat)
+	return exitStatus(failed, false)
+}
+
+// defaultSmartPreviewsDir returns where Lightroom keeps the smart previews of
+// a catalog: "<name> Smart Previews.lrdata" next to "<name>.lrcat".
+func defaultSmartPreviewsDir(catalogPath string) string {
+	name := strings.TrimSuffix(filepath.Base(catalogPath), filepath.Ext(catalogPath))
+	return filepath.Join(filepath.Dir(catalogPath), name+" Smart Previews.lrdata")
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+
+	"lrprev-extract-go/internal/cli"
+	"lrprev-extract-go/internal/discover"
+	"lrprev-extract-go/internal/journal"
+	"lrprev-extract-go/pkg/extractor"
+	"lrprev-extract-go/pkg/lrprev"
+	"lrprev-extract-go/pkg/naming"
+	"lrprev-extract-go/pkg/output"
+	"lrprev-extract-go/pkg/report"
+)
+
+// runSync brings an output tree up to date with a preview directory, using
+// the journal of earlier runs to find what was added, re-rendered or deleted.
+func runSync(args []string) int {
+	fs := flag.NewFlagSet("sync", flag.ExitOnError)
+	inputDir := fs.String("d", "", "Path to your lightroom directory (.lrdata)")
+	outputDirectory := fs.String("o", "", "Path to output directory")
+	lightroomDB := fs.String("l", "", "Path to the lightroom catalog (.lrcat)")
+	previewsDB := fs.String("previews-db", "", "Path to previews.db (default: found next to the input in Previews.lrdata)")
+	deleteRemoved := fs.Bool("delete", false, "Delete the outputs of previews that no longer exist")
+	includeSize := fs.Bool("include-size", false, "Include image size information in the output file name")
+	levelsFlag := fs.String("levels", "", "Pyramid levels to extract: 'all' or a comma separated list such as '1,3' (default: largest only)")
+	writeMetadata := fs.Bool("metadata", false, "Write EXIF and XMP metadata from the catalog (-l) into each JPEG")
+	writeSidecar := fs.Bool("xmp-sidecar", false, "Write an .xmp sidecar with the catalog metadata (-l) next to each JPEG")
+	orient := fs.String("orient", extractor.OrientNone, "Apply the preview orientation: none, exif (set the EXIF Orientation tag) or rotate (rotate losslessly)")
+	template := fs.String("template", "", "Output path template relative to -o, e.g. '{capture:2006/01/02}/{basename}_{width}x{height}.jpg'")
+	var include, exclude cli.StringList
+	fs.Var(&include, "include", "Only sync previews matching this glob (repeatable, e.g. 'A/**' or '*.lrprev')")
+	fs.Var(&exclude, "exclude", "Skip previews or directories matching this glob (repeatable)")
+	var workers int
+	fs.IntVar(&workers, "j", runtime.NumCPU(), "Number of files to process concurrently (shorthand for -workers)")
+	fs.IntVar(&workers, "workers", runtime.NumCPU(), "Number of files to process concurrently")
+	reportFormat := fs.String("report", report.FormatPlain, "How to show progress: plain (log lines) or json (one JSON event per line)")
+	fs.Usage = func() {
+		fmt.Println("Usage:\n  lrprev-extract sync -d <Previews.lrdata> -o <output> [-l <catalog.lrcat>] [-delete]")
+		fmt.Println("\nOptions:")
+		fs.PrintDefaults()
+		fmt.Println("\nExample:")
+		fmt.Println("  lrprev-extract sync -d 'catalog Previews.lrdata' -o out -l catalog.lrcat -delete")
+	}
+	_ = fs.Parse(args)
+
+	if *inputDir == "" || *outputDirectory == "" {
+		fs.Usage()
+		return cli.ExitUsage
+	}
+	if (*writeMetadata || *writeSidecar) && *lightroomDB == "" {
+		usageFatalf("-metadata and -xmp-sidecar read the catalog and require -l")
+	}
+
+	allLevels, levels, err := cli.ParseLevels(*levelsFlag)
+	if err != nil {
+		usageFatalf("Invalid -levels value: %v", err)
+	}
+	if err := cli.CheckChoice("orient", *orient, extractor.OrientNone, extractor.OrientEXIF, extractor.OrientRotate); err != nil {
+		usageFatalf("%v", err)
+	}
+	var nameTemplate *naming.Template
+	if *template != "" {
+		if nameTemplate, err = naming.Parse(*template); err != nil {
+			usageFatalf("%v", err)
+		}
+	}
+	if err := cli.CheckChoice("report", *reportFormat, report.FormatPlain, report.FormatJSON); err != nil {
+		usageFatalf("%v", err)
+	}
+	rep, _ := report.New(*reportFormat, os.Stdout)
+	// Sync mirrors the previews, so re-rendered ones replace their outputs.
+	writer, err := output.NewWriter(output.Overwrite)
+	if err != nil {
+		log.Fatal(err)
+	}
+	opts := extractor.Options{
+		IncludeSize:   *includeSize,
+		AllLevels:     allLevels,
+		Levels:        levels,
+		WriteMetadata: *writeMetadata,
+		WriteSidecar:  *writeSidecar,
+		Orient:        *orient,
+		Template:      nameTemplate,
+		Output:        writer,
+		Reporter:      rep,
+	}
+	if err := opts.CheckTemplate(); err != nil {
+		usageFatalf("%v", err)
+	}
+
+	if *lightroomDB != "" {
+		catalog, err := lrprev.OpenCatalog(*lightroomDB)
+		if err != nil {
+			log.Fatalf("Failed to open Lightroom catalog: %v", err)
+		}
+		defer catalog.Close()
+		if err := catalog.Preload(); err != nil {
+			log.Fatalf("Failed to load Lightroom catalog: %v", err)
+		}
+		opts.Catalog = catalog
+	}
+	opts.Previews = openPreviewIndex(*previewsDB, *inputDir)
+
+	if err := os.MkdirAll(*outputDirectory, os.ModePerm); err != nil {
+		log.Fatalf("Failed to create output directory: %v", err)
+	}
+	jrnl, err := journal.Open(*outputDirectory, journalSettings(*lightroomDB, *levelsFlag, *template, opts))
+	if err != nil {
+		log.Fatalf("Failed to open journal: %v", err)
+	}
+	defer jrnl.Close()
+
+	found, err := discover.Find(*inputDir, discover.Options{Include: include, Exclude: exclude})
+	if err != nil {
+		log.Fatalf("Failed to find previews: %v", err)
+	}
+	result, err := jrnl.Sync(*inputDir, found.Files, journal.SyncOptions{
+		Extract: func(file string) ([]string, error) {
+			err := extractor.Extract(file, *outputDirectory, *lightroomDB, opts)
+			return writer.Written(file), err
+		},
+		Workers:  workers,
+		Delete:   *deleteRemoved,
+		Reporter: rep,
+	})
+	if err != nil {
+		log.Fatalf("Failed to compare previews: %v", err)
+	}
+
+	printSyncReport(rep, result, *deleteRemoved)
+	return exitStatus(len(result.Failed), false)
+}
+
+func printSyncReport(rep report.Reporter, result journal.SyncResult, deleteRemoved bool) {
+	changes, failed, deleted := result.Changes, result.Failed, result.Deleted
+	for _, file := range changes.Added {
+		rep.Logf(report.Info, file, "Added: %s", file)
+	}
+	for _, file := range changes.Updated {
+		rep.Logf(report.Info, file, "Updated: %s", file)
+	}
+	for _, file := range changes.Removed {
+		rep.Logf(report.Info, file, "Removed: %s", file)
+	}
+	for _, file := range failed {
+		rep.Logf(report.Error, file, "Failed: %s", file)
+	}
+	for _, path := range deleted {
+		rep.Logf(report.Info, "", "Deleted: %s", path)
+	}
+	if len(changes.Removed) > 0 && !deleteRemoved {
+		rep.Logf(report.Warning, "", "Outputs of removed previews were kept; rerun with -delete to remove them")
+	}
+	rep.Complete(report.Summary{
+		Message: fmt.Sprintf("Sync complete: %d added, %d updated, %d removed, %d unchanged, %d failed",
+			len(changes.Added), len(changes.Updated), len(changes.Removed), len(changes.Unchanged), len(failed)),
+		Counts: map[string]int{
+			"added":     len(changes.Added),
+			"updated":   len(changes.Updated),
+			"removed":   len(changes.Removed),
+			"unchanged": len(changes.Unchanged),
+			"failed":    len(failed),
+			"deleted":   len(deleted),
+		},
+	})
+}
@@ -4,11 +4,30 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
+
+	"golang.org/x/term"
+)
+
+// Exit codes of the lrprev-extract commands.
+const (
+	ExitOK = 0
+	// ExitError means the run failed or was stopped before it finished.
+	ExitError = 1
+	// ExitUsage means a required flag is missing or a flag value is invalid.
+	ExitUsage = 2
+	// ExitPartial means the run finished but some previews failed.
+	ExitPartial = 3
 )
 
 var reader = bufio.NewReader(os.Stdin)
 
+// IsTerminal reports whether f is a terminal, where prompts can be answered.
+func IsTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
 func PromptForInput(prompt string) string {
 	for {
 		fmt.Print(prompt)
@@ -45,3 +64,52 @@ func ValidatePath(path string) error {
 	}
 	return nil
 }
+
+// ParseLevels parses the -levels flag: "" selects the largest level only,
+// "all" every level, otherwise a comma separated list such as "1,3".
+func ParseLevels(value string) (bool, []int, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return false, nil, nil
+	}
+	if strings.EqualFold(value, "all") {
+		return true, nil, nil
+	}
+
+	var levels []int
+	for _, part := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 1 {
+			return false, nil, fmt.Errorf("invalid level '%s': levels must be positive numbers or 'all'", part)
+		}
+		levels = append(levels, n)
+	}
+	return false, levels, nil
+}
+
+// CheckChoice returns an error naming the accepted values when value is not
+// one of choices.
+func CheckChoice(flagName, value string, choices ...string) error {
+	for _, choice := range choices {
+		if value == choice {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid -%s value %q: must be one of %s", flagName, value, strings.Join(choices, ", "))
+}
+
+// StringList is a flag.Value that collects repeated flags and comma separated values.
+type StringList []string
+
+func (s *StringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *StringList) Set(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			*s = append(*s, part)
+		}
+	}
+	return nil
+}
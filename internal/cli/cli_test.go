@@ -3,6 +3,7 @@ package cli
 import (
 	"os"
 	"path/filepath"
+	"reflect"
 	"testing"
 )
 
@@ -34,6 +35,68 @@ func TestValidatePath(t *testing.T) {
 	}
 }
 
+func TestParseLevels(t *testing.T) {
+	tests := []struct {
+		value   string
+		all     bool
+		levels  []int
+		wantErr bool
+	}{
+		{"", false, nil, false},
+		{"all", true, nil, false},
+		{"ALL", true, nil, false},
+		{"1,3", false, []int{1, 3}, false},
+		{" 2 , 4 ", false, []int{2, 4}, false},
+		{"0", false, nil, true},
+		{"1,x", false, nil, true},
+	}
+
+	for _, tt := range tests {
+		all, levels, err := ParseLevels(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLevels(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if all != tt.all || !reflect.DeepEqual(levels, tt.levels) {
+			t.Errorf("ParseLevels(%q) = %v, %v, want %v, %v", tt.value, all, levels, tt.all, tt.levels)
+		}
+	}
+}
+
+func TestStringList(t *testing.T) {
+	var list StringList
+	_ = list.Set("a/**, *.lrprev")
+	_ = list.Set("b")
+	if !reflect.DeepEqual([]string(list), []string{"a/**", "*.lrprev", "b"}) {
+		t.Errorf("unexpected list: %v", list)
+	}
+	if list.String() != "a/**,*.lrprev,b" {
+		t.Errorf("unexpected string: %s", list.String())
+	}
+}
+
+func TestCheckChoice(t *testing.T) {
+	if err := CheckChoice("orient", "exif", "none", "exif", "rotate"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	err := CheckChoice("orient", "sideways", "none", "exif", "rotate")
+	if err == nil || err.Error() != `invalid -orient value "sideways": must be one of none, exif, rotate` {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
 // Note: Testing PromptForInput and PromptForBool would require mocking user input,
 // which is beyond the scope of this simple test file. In a real-world scenario,
 // you might want to use a mocking library or dependency injection to test these functions.
+
+func TestIsTerminal(t *testing.T) {
+	f, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	defer f.Close()
+
+	if IsTerminal(f) {
+		t.Errorf("IsTerminal reported a regular file as a terminal")
+	}
+}
@@ -0,0 +1,321 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// imageLocationQuery resolves images rather than files, so virtual copies,
+// which share their master's AgLibraryFile row, get their own copyName.
+const imageLocationQuery = `
+		SELECT image.id_global as uuid, root.absolutePath, agfolder.pathFromRoot, agfile.baseName, IFNULL(image.copyName, '')
+		FROM Adobe_images image
+		INNER JOIN AgLibraryFile agfile ON agfile.id_local = image.rootFile
+		INNER JOIN AgLibraryFolder agfolder ON agfolder.id_local = agfile.folder
+		INNER JOIN AgLibraryRootFolder root ON root.id_local = agfolder.rootFolder
+	`
+
+// lookupBatchSize stays below SQLite's default limit of 999 bound parameters.
+const lookupBatchSize = 500
+
+type Location struct {
+	UUID string
+	Dir  string
+	// BaseName is the original's name without extension. For a virtual copy
+	// it ends in the copy name, e.g. "IMG_0001_Copy 1".
+	BaseName string
+	CopyName string
+}
+
+// Catalog is a read-only handle on a Lightroom catalog that is opened once per
+// run and shared by all workers. Lookups go through prepared statements, or
+// through an in-memory map once LoadAll has been called. UUIDs are matched
+// against image id_globals first and file id_globals second.
+type Catalog struct {
+	db     *sql.DB
+	byUUID *sql.Stmt
+
+	// byImage is nil when the catalog has no Adobe_images table.
+	byImage *sql.Stmt
+
+	queries imageQueries
+
+	// byImageID is prepared on first use, since only runs with a preview
+	// index resolve images by id.
+	imageOnce    sync.Once
+	byImageID    *sql.Stmt
+	byImageIDErr error
+
+	mu     sync.RWMutex
+	cache  map[string]Location
+	loaded bool
+}
+
+func OpenCatalog(dbPath string) (*Catalog, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("error opening catalog: %v", err)
+	}
+
+	db, err := OpenDatabase(readOnlyDSN(dbPath))
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, err := NewCatalog(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return catalog, nil
+}
+
+// NewCatalog prepares the lookup and per-image metadata statements on an
+// already opened database. The Catalog takes ownership of db.
+func NewCatalog(db *sql.DB) (*Catalog, error) {
+	byUUID, err := db.Prepare(originalFileQuery + `WHERE agfile.id_global = ?`)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing catalog query: %v", err)
+	}
+	byImage, err := db.Prepare(imageLocationQuery + `WHERE image.id_global = ?`)
+	if err != nil && !isMissingTable(err) {
+		byUUID.Close()
+		return nil, fmt.Errorf("error preparing catalog query: %v", err)
+	}
+	return &Catalog{db: db, byUUID: byUUID, byImage: byImage, queries: prepareImageQueries(db), cache: make(map[string]Location)}, nil
+}
+
+func readOnlyDSN(dbPath string) string {
+	u := url.URL{Path: dbPath}
+	return "file:" + u.EscapedPath() + "?mode=ro"
+}
+
+func (c *Catalog) DB() *sql.DB {
+	return c.db
+}
+
+func (c *Catalog) Lookup(uuid string) (Location, error) {
+	c.mu.RLock()
+	location, ok := c.cache[uuid]
+	loaded := c.loaded
+	c.mu.RUnlock()
+	if ok {
+		return location, nil
+	}
+	if loaded {
+		return Location{}, fmt.Errorf("no entry found for UUID: %s", uuid)
+	}
+
+	location, err := c.lookup(uuid)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Location{}, fmt.Errorf("no entry found for UUID: %s", uuid)
+		}
+		return Location{}, fmt.Errorf("database query failed: %v", err)
+	}
+
+	c.mu.Lock()
+	c.cache[uuid] = location
+	c.mu.Unlock()
+	return location, nil
+}
+
+func (c *Catalog) lookup(uuid string) (Location, error) {
+	if c.byImage != nil {
+		location, err := scanImageLocation(c.byImage.QueryRow(uuid))
+		if err != sql.ErrNoRows {
+			return location, err
+		}
+	}
+	return scanLocation(c.byUUID.QueryRow(uuid))
+}
+
+// LookupImageID resolves an image by its Adobe_images.id_local, as referenced
+// from previews.db.
+func (c *Catalog) LookupImageID(id int64) (Location, error) {
+	c.imageOnce.Do(func() {
+		c.byImageID, c.byImageIDErr = c.db.Prepare(imageLocationQuery + `WHERE image.id_local = ?`)
+	})
+	if c.byImageIDErr != nil {
+		return Location{}, fmt.Errorf("error preparing catalog query: %v", c.byImageIDErr)
+	}
+
+	location, err := scanImageLocation(c.byImageID.QueryRow(id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return Location{}, fmt.Errorf("no entry found for image id: %d", id)
+		}
+		return Location{}, fmt.Errorf("database query failed: %v", err)
+	}
+	return location, nil
+}
+
+// ImageIDs returns the id_local of every image in the catalog.
+func (c *Catalog) ImageIDs() (map[int64]bool, error) {
+	rows, err := c.db.Query(`SELECT id_local FROM Adobe_images`)
+	if err != nil {
+		return nil, fmt.Errorf("database query failed: %v", err)
+	}
+	defer rows.Close()
+
+	ids := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("database query failed: %v", err)
+		}
+		ids[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database query failed: %v", err)
+	}
+	return ids, nil
+}
+
+// LookupMany resolves uuids in batches and returns the ones found. UUIDs
+// missing from the catalog are simply absent from the result.
+func (c *Catalog) LookupMany(uuids []string) (map[string]Location, error) {
+	result := make(map[string]Location, len(uuids))
+
+	var missing []string
+	c.mu.RLock()
+	for _, uuid := range uuids {
+		if location, ok := c.cache[uuid]; ok {
+			result[uuid] = location
+		} else if !c.loaded {
+			missing = append(missing, uuid)
+		}
+	}
+	c.mu.RUnlock()
+
+	for start := 0; start < len(missing); start += lookupBatchSize {
+		end := start + lookupBatchSize
+		if end > len(missing) {
+			end = len(missing)
+		}
+		batch := missing[start:end]
+
+		args := make([]interface{}, len(batch))
+		for i, uuid := range batch {
+			args[i] = uuid
+		}
+		in := `IN (?` + strings.Repeat(",?", len(batch)-1) + `)`
+
+		found := make(map[string]Location)
+		if c.byImage != nil {
+			var err error
+			if found, err = c.queryLocations(imageLocationQuery+`WHERE image.id_global `+in, scanImageLocation, args...); err != nil {
+				return nil, err
+			}
+		}
+		if len(found) < len(batch) {
+			files, err := c.queryLocations(originalFileQuery+`WHERE agfile.id_global `+in, scanLocation, args...)
+			if err != nil {
+				return nil, err
+			}
+			for uuid, location := range files {
+				if _, ok := found[uuid]; !ok {
+					found[uuid] = location
+				}
+			}
+		}
+		for uuid, location := range found {
+			result[uuid] = location
+		}
+	}
+	return result, nil
+}
+
+// LoadAll reads every file location into memory with a single query. After
+// it returns, lookups no longer touch the database.
+func (c *Catalog) LoadAll() error {
+	if _, err := c.queryLocations(originalFileQuery, scanLocation); err != nil {
+		return err
+	}
+	if c.byImage != nil {
+		if _, err := c.queryLocations(imageLocationQuery, scanImageLocation); err != nil {
+			return err
+		}
+	}
+
+	c.mu.Lock()
+	c.loaded = true
+	c.mu.Unlock()
+
+	return nil
+}
+
+// Unload keeps the locations read so far, but lets lookups of unknown UUIDs
+// query the database again.
+func (c *Catalog) Unload() {
+	c.mu.Lock()
+	c.loaded = false
+	c.mu.Unlock()
+}
+
+func (c *Catalog) queryLocations(query string, scan func(scanner) (Location, error), args ...interface{}) (map[string]Location, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("database query failed: %v", err)
+	}
+	defer rows.Close()
+
+	found := make(map[string]Location)
+	for rows.Next() {
+		location, err := scan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("database query failed: %v", err)
+		}
+		found[location.UUID] = location
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database query failed: %v", err)
+	}
+
+	c.mu.Lock()
+	for uuid, location := range found {
+		c.cache[uuid] = location
+	}
+	c.mu.Unlock()
+	return found, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanLocation(row scanner) (Location, error) {
+	var uuid, absolutePath, pathFromRoot, baseName string
+	if err := row.Scan(&uuid, &absolutePath, &pathFromRoot, &baseName); err != nil {
+		return Location{}, err
+	}
+	return Location{UUID: uuid, Dir: originalDir(absolutePath, pathFromRoot), BaseName: baseName}, nil
+}
+
+func scanImageLocation(row scanner) (Location, error) {
+	var uuid, absolutePath, pathFromRoot, baseName, copyName string
+	if err := row.Scan(&uuid, &absolutePath, &pathFromRoot, &baseName, &copyName); err != nil {
+		return Location{}, err
+	}
+	return Location{
+		UUID:     uuid,
+		Dir:      originalDir(absolutePath, pathFromRoot),
+		BaseName: copyBaseName(baseName, copyName),
+		CopyName: copyName,
+	}, nil
+}
+
+func (c *Catalog) Close() error {
+	c.byUUID.Close()
+	if c.byImage != nil {
+		c.byImage.Close()
+	}
+	if c.byImageID != nil {
+		c.byImageID.Close()
+	}
+	c.queries.Close()
+	return c.db.Close()
+}
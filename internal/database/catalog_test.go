@@ -0,0 +1,206 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+// createCatalog writes a minimal catalog with count files named IMG_0000..
+func createCatalog(t *testing.T, count int) string {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "test catalog.lrcat")
+	db, err := sql.Open("sqlite3", dbPath)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE TABLE AgLibraryFile (id_local INTEGER PRIMARY KEY, id_global TEXT, folder INTEGER, baseName TEXT);
+		CREATE TABLE AgLibraryFolder (id_local INTEGER, rootFolder INTEGER, pathFromRoot TEXT);
+		CREATE TABLE AgLibraryRootFolder (id_local INTEGER, absolutePath TEXT);
+		INSERT INTO AgLibraryFolder VALUES (1, 1, '2024/wedding/');
+		INSERT INTO AgLibraryRootFolder VALUES (1, '/photos/');
+	`)
+	assert.NoError(t, err)
+
+	tx, err := db.Begin()
+	assert.NoError(t, err)
+	for i := 0; i < count; i++ {
+		_, err = tx.Exec(`INSERT INTO AgLibraryFile (id_global, folder, baseName) VALUES (?, 1, ?)`,
+			fmt.Sprintf("UUID-%04d", i), fmt.Sprintf("IMG_%04d", i))
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, tx.Commit())
+	return dbPath
+}
+
+func TestCatalogLookup(t *testing.T) {
+	catalog, err := OpenCatalog(createCatalog(t, 3))
+	assert.NoError(t, err)
+	defer catalog.Close()
+
+	location, err := catalog.Lookup("UUID-0001")
+	assert.NoError(t, err)
+	assert.Equal(t, Location{UUID: "UUID-0001", Dir: filepath.Join("photos", "2024", "wedding"), BaseName: "IMG_0001"}, location)
+
+	_, err = catalog.Lookup("missing")
+	assert.EqualError(t, err, "no entry found for UUID: missing")
+
+	_, err = catalog.DB().Exec(`DELETE FROM AgLibraryFile`)
+	assert.Error(t, err, "catalog must be opened read-only")
+}
+
+func TestCatalogLookupMany(t *testing.T) {
+	catalog, err := OpenCatalog(createCatalog(t, 1200))
+	assert.NoError(t, err)
+	defer catalog.Close()
+
+	var uuids []string
+	for i := 0; i < 1200; i += 2 {
+		uuids = append(uuids, fmt.Sprintf("UUID-%04d", i))
+	}
+	uuids = append(uuids, "missing")
+
+	found, err := catalog.LookupMany(uuids)
+	assert.NoError(t, err)
+	assert.Len(t, found, 600)
+	assert.Equal(t, "IMG_1198", found["UUID-1198"].BaseName)
+	_, ok := found["missing"]
+	assert.False(t, ok)
+}
+
+func TestCatalogLoadAll(t *testing.T) {
+	catalog, err := OpenCatalog(createCatalog(t, 10))
+	assert.NoError(t, err)
+	defer catalog.Close()
+
+	assert.NoError(t, catalog.LoadAll())
+
+	// Once loaded, lookups are served from memory
+	_, err = catalog.DB().Exec(`DROP TABLE AgLibraryFile`)
+	assert.Error(t, err)
+	assert.NoError(t, catalog.db.Close())
+
+	location, err := catalog.Lookup("UUID-0009")
+	assert.NoError(t, err)
+	assert.Equal(t, "IMG_0009", location.BaseName)
+
+	found, err := catalog.LookupMany([]string{"UUID-0002", "missing"})
+	assert.NoError(t, err)
+	assert.Len(t, found, 1)
+
+	_, err = catalog.Lookup("missing")
+	assert.Error(t, err)
+}
+
+func TestCatalogUnload(t *testing.T) {
+	path := createCatalog(t, 2)
+	catalog, err := OpenCatalog(path)
+	assert.NoError(t, err)
+	defer catalog.Close()
+	assert.NoError(t, catalog.LoadAll())
+
+	db, err := sql.Open("sqlite3", path)
+	assert.NoError(t, err)
+	defer db.Close()
+	_, err = db.Exec(`INSERT INTO AgLibraryFile (id_global, folder, baseName) VALUES ('UUID-NEW', 1, 'IMG_NEW')`)
+	assert.NoError(t, err)
+
+	_, err = catalog.Lookup("UUID-NEW")
+	assert.Error(t, err)
+
+	catalog.Unload()
+	location, err := catalog.Lookup("UUID-NEW")
+	assert.NoError(t, err)
+	assert.Equal(t, "IMG_NEW", location.BaseName)
+}
+
+// createVirtualCopyCatalog adds a master image and one virtual copy of
+// IMG_0000 to a catalog from createCatalog.
+func createVirtualCopyCatalog(t *testing.T) string {
+	t.Helper()
+	dbPath := createCatalog(t, 2)
+	db, err := sql.Open("sqlite3", dbPath)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE TABLE Adobe_images (id_local INTEGER PRIMARY KEY, id_global TEXT, rootFile INTEGER, copyName TEXT);
+		INSERT INTO Adobe_images VALUES (10, 'IMAGE-MASTER', 1, NULL);
+		INSERT INTO Adobe_images VALUES (11, 'IMAGE-COPY', 1, 'Copy 1');
+	`)
+	assert.NoError(t, err)
+	return dbPath
+}
+
+func TestCatalogVirtualCopies(t *testing.T) {
+	catalog, err := OpenCatalog(createVirtualCopyCatalog(t))
+	assert.NoError(t, err)
+	defer catalog.Close()
+
+	master, err := catalog.Lookup("IMAGE-MASTER")
+	assert.NoError(t, err)
+	assert.Equal(t, "IMG_0000", master.BaseName)
+
+	virtual, err := catalog.Lookup("IMAGE-COPY")
+	assert.NoError(t, err)
+	assert.Equal(t, Location{UUID: "IMAGE-COPY", Dir: master.Dir, BaseName: "IMG_0000_Copy 1", CopyName: "Copy 1"}, virtual)
+
+	// File UUIDs still resolve to the file itself
+	file, err := catalog.Lookup("UUID-0001")
+	assert.NoError(t, err)
+	assert.Equal(t, "IMG_0001", file.BaseName)
+
+	location, err := catalog.LookupImageID(11)
+	assert.NoError(t, err)
+	assert.Equal(t, "IMG_0000_Copy 1", location.BaseName)
+
+	found, err := catalog.LookupMany([]string{"IMAGE-COPY", "UUID-0001", "missing"})
+	assert.NoError(t, err)
+	assert.Len(t, found, 2)
+	assert.Equal(t, "IMG_0000_Copy 1", found["IMAGE-COPY"].BaseName)
+	assert.Equal(t, "IMG_0001", found["UUID-0001"].BaseName)
+
+	// The file UUID of a master with virtual copies picks the master's metadata
+	id, err := catalog.imageID("UUID-0000")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), id)
+}
+
+func TestCatalogVirtualCopiesLoadAll(t *testing.T) {
+	catalog, err := OpenCatalog(createVirtualCopyCatalog(t))
+	assert.NoError(t, err)
+	defer catalog.Close()
+	assert.NoError(t, catalog.LoadAll())
+
+	for uuid, want := range map[string]string{
+		"IMAGE-MASTER": "IMG_0000",
+		"IMAGE-COPY":   "IMG_0000_Copy 1",
+		"UUID-0000":    "IMG_0000",
+		"UUID-0001":    "IMG_0001",
+	} {
+		location, err := catalog.Lookup(uuid)
+		assert.NoError(t, err, uuid)
+		assert.Equal(t, want, location.BaseName, uuid)
+	}
+}
+
+func TestNewCatalogPrepareError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectPrepare("SELECT agfile.id_global as uuid").WillReturnError(fmt.Errorf("no such table: AgLibraryFile"))
+
+	_, err = NewCatalog(db)
+	assert.EqualError(t, err, "error preparing catalog query: no such table: AgLibraryFile")
+}
+
+func TestOpenCatalogMissingFile(t *testing.T) {
+	_, err := OpenCatalog(filepath.Join(t.TempDir(), "missing.lrcat"))
+	assert.Error(t, err)
+}
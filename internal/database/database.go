@@ -4,10 +4,20 @@ import (
 	"database/sql"
 	"fmt"
 	"path/filepath"
+	"strings"
+
+	"lrprev-extract-go/pkg/naming"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
+const originalFileQuery = `
+		SELECT agfile.id_global as uuid, root.absolutePath, agfolder.pathFromRoot, agfile.baseName
+		FROM AgLibraryFile agfile
+		INNER JOIN AgLibraryFolder agfolder ON agfolder.id_local = agfile.folder
+		INNER JOIN AgLibraryRootFolder root ON root.id_local = agfolder.rootFolder
+	`
+
 func OpenDatabase(dbPath string) (*sql.DB, error) {
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
@@ -26,17 +36,21 @@ func GetOriginalFilePath(dbPath, uuid string) (string, string, error) {
 	return getOriginalFilePath(db, uuid)
 }
 
+// getOriginalFilePath resolves uuid as an image first, so virtual copies get
+// their copy name, and as a file second.
 func getOriginalFilePath(db *sql.DB, uuid string) (string, string, error) {
-	query := `
-		SELECT agfile.id_global as uuid, root.absolutePath, agfolder.pathFromRoot, agfile.baseName
-		FROM AgLibraryFile agfile
-		INNER JOIN AgLibraryFolder agfolder ON agfolder.id_local = agfile.folder
-		INNER JOIN AgLibraryRootFolder root ON root.id_local = agfolder.rootFolder
-		WHERE agfile.id_global = ?
-	`
+	location, err := scanImageLocation(db.QueryRow(imageLocationQuery+`WHERE image.id_global = ?`, uuid))
+	if err == nil {
+		return location.Dir, location.BaseName, nil
+	}
+	if err != sql.ErrNoRows && !isMissingTable(err) {
+		return "", "", fmt.Errorf("database query failed: %v", err)
+	}
+
+	query := originalFileQuery + `WHERE agfile.id_global = ?`
 
 	var absolutePath, pathFromRoot, baseName string
-	err := db.QueryRow(query, uuid).Scan(&uuid, &absolutePath, &pathFromRoot, &baseName)
+	err = db.QueryRow(query, uuid).Scan(&uuid, &absolutePath, &pathFromRoot, &baseName)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return "", "", fmt.Errorf("no entry found for UUID: %s", uuid)
@@ -44,7 +58,31 @@ func getOriginalFilePath(db *sql.DB, uuid string) (string, string, error) {
 		return "", "", fmt.Errorf("database query failed: %v", err)
 	}
 
-	// Remove first slash from the absolutePath
-	fullPath := filepath.Join(absolutePath[1:], pathFromRoot)
-	return fullPath, baseName, nil
+	return originalDir(absolutePath, pathFromRoot), baseName, nil
+}
+
+// copyBaseName appends a virtual copy's name to the original's, e.g.
+// "IMG_0001_Copy 1", so each copy is written to its own file.
+func copyBaseName(baseName, copyName string) string {
+	copyName = strings.TrimSpace(naming.Sanitize(copyName))
+	if copyName == "" {
+		return baseName
+	}
+	return baseName + "_" + copyName
+}
+
+// originalDir joins a root folder and folder path, dropping the leading slash
+// so the result can be nested under an output directory.
+func originalDir(absolutePath, pathFromRoot string) string {
+	return filepath.Join(strings.TrimPrefix(absolutePath, "/"), pathFromRoot)
+}
+
+// originalPath returns the absolute path of an original file from its
+// catalog parts, e.g. "/Users/me/Pictures/" + "2025/" + "IMG_0001" + "CR2".
+func originalPath(absolutePath, pathFromRoot, baseName, extension string) string {
+	name := baseName
+	if extension != "" {
+		name += "." + extension
+	}
+	return filepath.Join(filepath.FromSlash(absolutePath), filepath.FromSlash(pathFromRoot), name)
 }
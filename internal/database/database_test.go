@@ -8,6 +8,13 @@ import (
 	"github.com/DATA-DOG/go-sqlmock"
 )
 
+// expectNoImage makes the Adobe_images lookup miss so the file lookup runs.
+func expectNoImage(mock sqlmock.Sqlmock, uuid string) {
+	mock.ExpectQuery("SELECT image.id_global as uuid, root.absolutePath, agfolder.pathFromRoot, agfile.baseName, IFNULL\\(image.copyName, ''\\)").
+		WithArgs(uuid).
+		WillReturnError(sql.ErrNoRows)
+}
+
 func TestGetOriginalFilePathSuccess(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -15,6 +22,7 @@ func TestGetOriginalFilePathSuccess(t *testing.T) {
 	}
 	defer db.Close()
 
+	expectNoImage(mock, "test-uuid")
 	mock.ExpectQuery("SELECT agfile.id_global as uuid, root.absolutePath, agfolder.pathFromRoot, agfile.baseName").
 		WithArgs("test-uuid").
 		WillReturnRows(sqlmock.NewRows([]string{"uuid", "absolutePath", "pathFromRoot", "baseName"}).
@@ -48,6 +56,7 @@ func TestGetOriginalFilePathNoEntry(t *testing.T) {
 	}
 	defer db.Close()
 
+	expectNoImage(mock, "non-existent-uuid")
 	mock.ExpectQuery("SELECT agfile.id_global as uuid, root.absolutePath, agfolder.pathFromRoot, agfile.baseName").
 		WithArgs("non-existent-uuid").
 		WillReturnError(sql.ErrNoRows)
@@ -75,6 +84,7 @@ func TestGetOriginalFilePathDatabaseError(t *testing.T) {
 	}
 	defer db.Close()
 
+	expectNoImage(mock, "test-uuid")
 	mock.ExpectQuery("SELECT agfile.id_global as uuid, root.absolutePath, agfolder.pathFromRoot, agfile.baseName").
 		WithArgs("test-uuid").
 		WillReturnError(errors.New("database connection error"))
@@ -102,6 +112,7 @@ func TestGetOriginalFilePathQueryError(t *testing.T) {
 	}
 	defer db.Close()
 
+	expectNoImage(mock, "test-uuid")
 	mock.ExpectQuery("SELECT agfile.id_global as uuid, root.absolutePath, agfolder.pathFromRoot, agfile.baseName").
 		WithArgs("test-uuid").
 		WillReturnError(errors.New("query execution error"))
@@ -121,3 +132,61 @@ func TestGetOriginalFilePathQueryError(t *testing.T) {
 		t.Errorf("there were unfulfilled expectations: %s", err)
 	}
 }
+
+func TestGetOriginalFilePathVirtualCopy(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT image.id_global as uuid").
+		WithArgs("copy-uuid").
+		WillReturnRows(sqlmock.NewRows([]string{"uuid", "absolutePath", "pathFromRoot", "baseName", "copyName"}).
+			AddRow("copy-uuid", "/absolute/path", "path/from/root", "IMG_0001", "Copy 1/B&W"))
+
+	fullPath, baseName, err := getOriginalFilePath(db, "copy-uuid")
+
+	if err != nil {
+		t.Errorf("error was not expected while getting original file path: %s", err)
+	}
+	if fullPath != "absolute/path/path/from/root" {
+		t.Errorf("expected full path %s, got %s", "absolute/path/path/from/root", fullPath)
+	}
+	if baseName != "IMG_0001_Copy 1_B&W" {
+		t.Errorf("expected base name %s, got %s", "IMG_0001_Copy 1_B&W", baseName)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestGetOriginalFilePathNoImagesTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("an error '%s' was not expected when opening a stub database connection", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT image.id_global as uuid").
+		WithArgs("test-uuid").
+		WillReturnError(errors.New("no such table: Adobe_images"))
+	mock.ExpectQuery("SELECT agfile.id_global as uuid, root.absolutePath, agfolder.pathFromRoot, agfile.baseName").
+		WithArgs("test-uuid").
+		WillReturnRows(sqlmock.NewRows([]string{"uuid", "absolutePath", "pathFromRoot", "baseName"}).
+			AddRow("test-uuid", "/absolute/path", "path/from/root", "test.jpg"))
+
+	_, baseName, err := getOriginalFilePath(db, "test-uuid")
+
+	if err != nil {
+		t.Errorf("error was not expected while getting original file path: %s", err)
+	}
+	if baseName != "test.jpg" {
+		t.Errorf("expected base name %s, got %s", "test.jpg", baseName)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+
+	"lrprev-extract-go/internal/lua"
+	"lrprev-extract-go/pkg/metadata"
+)
+
+// developSummaryKeys are the develop settings reported in sidecars, in the
+// order of Lightroom's Basic panel followed by crop.
+var developSummaryKeys = []string{
+	"ProcessVersion",
+	"WhiteBalance",
+	"Temperature",
+	"Tint",
+	"Exposure2012",
+	"Contrast2012",
+	"Highlights2012",
+	"Shadows2012",
+	"Whites2012",
+	"Blacks2012",
+	"Texture",
+	"Clarity2012",
+	"Dehaze",
+	"Vibrance",
+	"Saturation",
+	"ConvertToGrayscale",
+	"CropAngle",
+}
+
+const developQuery = `
+		SELECT IFNULL(text, '') FROM Adobe_imageDevelopSettings WHERE image = ?
+	`
+
+// developSettings summarises the Lua develop settings stored in
+// Adobe_imageDevelopSettings. Settings left at zero are omitted.
+func (c *Catalog) developSettings(id int64) ([]metadata.Setting, error) {
+	var text string
+	err := c.queries.develop.QueryRow(id).Scan(&text)
+	if err == sql.ErrNoRows || isMissingTable(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database query failed: %v", err)
+	}
+	if text == "" {
+		return nil, nil
+	}
+
+	settings, err := parseDevelopSettings(text)
+	if err != nil {
+		return nil, fmt.Errorf("%w for image %d: %v", metadata.ErrDevelop, id, err)
+	}
+	return summariseDevelop(settings), nil
+}
+
+// parseDevelopSettings reads the "s = { ... }" chunk Lightroom stores for
+// each image.
+func parseDevelopSettings(text string) (*lua.Table, error) {
+	values, err := lua.Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if table, ok := values["s"].(*lua.Table); ok {
+		return table, nil
+	}
+	for _, value := range values {
+		if table, ok := value.(*lua.Table); ok {
+			return table, nil
+		}
+	}
+	return nil, fmt.Errorf("no settings table found")
+}
+
+func summariseDevelop(settings *lua.Table) []metadata.Setting {
+	var summary []metadata.Setting
+	for _, key := range developSummaryKeys {
+		var value string
+		switch v := settings.Fields[key].(type) {
+		case string:
+			value = v
+		case float64:
+			if v != 0 {
+				value = strconv.FormatFloat(v, 'f', -1, 64)
+			}
+		case bool:
+			if v {
+				value = "True"
+			}
+		}
+		if value != "" {
+			summary = append(summary, metadata.Setting{Name: key, Value: value})
+		}
+	}
+	return summary
+}
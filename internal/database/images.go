@@ -0,0 +1,207 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	PickAny       = ""
+	PickPicked    = "picked"
+	PickRejected  = "rejected"
+	PickUnflagged = "unflagged"
+)
+
+// ImageFilter selects catalog images. Zero values do not filter.
+type ImageFilter struct {
+	// Folder matches the start of the full folder path or of the path below
+	// the root folder, e.g. "/Users/me/Pictures/2025" or "2025/wedding".
+	Folder string
+	// Collection is the name of a (non-smart) collection.
+	Collection string
+	MinRating  int
+	Pick       string
+	// CapturedFrom and CapturedTo bound the capture date, both inclusive.
+	CapturedFrom time.Time
+	CapturedTo   time.Time
+	Keyword      string
+}
+
+// Image is a row of Adobe_images joined with the location of its file. UUID
+// is the image id_global, which is also the name of its preview.
+type Image struct {
+	ID          int64
+	UUID        string
+	Location    Location
+	Rating      int
+	Pick        int
+	CaptureTime string
+	// Path is the absolute path of the original file on the machine the
+	// catalog was used on. Virtual copies share their master's path.
+	Path string
+}
+
+const imageQuery = `
+		SELECT image.id_local, image.id_global, agfile.id_global, root.absolutePath, agfolder.pathFromRoot, agfile.baseName,
+			IFNULL(image.rating, 0), IFNULL(image.pick, 0), IFNULL(image.captureTime, ''), IFNULL(image.copyName, ''),
+			IFNULL(agfile.extension, '')
+		FROM Adobe_images image
+		INNER JOIN AgLibraryFile agfile ON agfile.id_local = image.rootFile
+		INNER JOIN AgLibraryFolder agfolder ON agfolder.id_local = agfile.folder
+		INNER JOIN AgLibraryRootFolder root ON root.id_local = agfolder.rootFolder
+	`
+
+func (f ImageFilter) where() (string, []interface{}, error) {
+	var conditions []string
+	var args []interface{}
+
+	if f.Folder != "" {
+		prefix := likePrefix(f.Folder)
+		conditions = append(conditions, `((root.absolutePath || agfolder.pathFromRoot) LIKE ? ESCAPE '\' OR agfolder.pathFromRoot LIKE ? ESCAPE '\')`)
+		args = append(args, prefix, prefix)
+	}
+	if f.Collection != "" {
+		conditions = append(conditions, `image.id_local IN (
+			SELECT ci.image FROM AgLibraryCollectionImage ci
+			INNER JOIN AgLibraryCollection c ON c.id_local = ci.collection
+			WHERE c.name = ?)`)
+		args = append(args, f.Collection)
+	}
+	if f.MinRating > 0 {
+		conditions = append(conditions, `IFNULL(image.rating, 0) >= ?`)
+		args = append(args, f.MinRating)
+	}
+	switch f.Pick {
+	case PickAny:
+	case PickPicked:
+		conditions = append(conditions, `IFNULL(image.pick, 0) > 0`)
+	case PickRejected:
+		conditions = append(conditions, `IFNULL(image.pick, 0) < 0`)
+	case PickUnflagged:
+		conditions = append(conditions, `IFNULL(image.pick, 0) = 0`)
+	default:
+		return "", nil, fmt.Errorf("invalid pick filter '%s': use picked, rejected or unflagged", f.Pick)
+	}
+	if !f.CapturedFrom.IsZero() {
+		conditions = append(conditions, `image.captureTime >= ?`)
+		args = append(args, f.CapturedFrom.Format("2006-01-02"))
+	}
+	if !f.CapturedTo.IsZero() {
+		conditions = append(conditions, `image.captureTime < ?`)
+		args = append(args, f.CapturedTo.AddDate(0, 0, 1).Format("2006-01-02"))
+	}
+	if f.Keyword != "" {
+		conditions = append(conditions, `image.id_local IN (
+			SELECT ki.image FROM AgLibraryKeywordImage ki
+			INNER JOIN AgLibraryKeyword k ON k.id_local = ki.tag
+			WHERE lower(k.name) = lower(?))`)
+		args = append(args, f.Keyword)
+	}
+
+	if len(conditions) == 0 {
+		return "", nil, nil
+	}
+	return "WHERE " + strings.Join(conditions, "\n\t\t\tAND "), args, nil
+}
+
+func likePrefix(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	return s + "%"
+}
+
+// FindImages returns the images matching filter ordered by capture time.
+func (c *Catalog) FindImages(filter ImageFilter) ([]Image, error) {
+	where, args, err := filter.where()
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := c.db.Query(imageQuery+where+`
+		ORDER BY image.captureTime, image.id_local`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("database query failed: %v", err)
+	}
+	defer rows.Close()
+
+	var images []Image
+	for rows.Next() {
+		var image Image
+		var absolutePath, pathFromRoot, extension string
+		var rating, pick sql.NullFloat64
+		err := rows.Scan(&image.ID, &image.UUID, &image.Location.UUID, &absolutePath, &pathFromRoot,
+			&image.Location.BaseName, &rating, &pick, &image.CaptureTime, &image.Location.CopyName, &extension)
+		if err != nil {
+			return nil, fmt.Errorf("database query failed: %v", err)
+		}
+		image.Path = originalPath(absolutePath, pathFromRoot, image.Location.BaseName, extension)
+		image.Location.Dir = originalDir(absolutePath, pathFromRoot)
+		image.Location.BaseName = copyBaseName(image.Location.BaseName, image.Location.CopyName)
+		image.Rating = int(rating.Float64)
+		image.Pick = int(pick.Float64)
+		images = append(images, image)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database query failed: %v", err)
+	}
+	return images, nil
+}
+
+// ImageInfo holds catalog details used to name output files.
+type ImageInfo struct {
+	// Extension is the original's file extension without the dot, e.g. "CR2".
+	Extension string
+	// Collections lists the names of the (non-smart) collections holding the
+	// image, sorted.
+	Collections []string
+}
+
+// Naming queries, prepared by NewCatalog.
+const (
+	extensionQuery = `
+		SELECT IFNULL(agfile.extension, '')
+		FROM Adobe_images image
+		INNER JOIN AgLibraryFile agfile ON agfile.id_local = image.rootFile
+		WHERE image.id_local = ?
+	`
+	collectionsQuery = `
+		SELECT DISTINCT c.name
+		FROM AgLibraryCollectionImage ci
+		INNER JOIN AgLibraryCollection c ON c.id_local = ci.collection
+		WHERE ci.image = ? AND c.name IS NOT NULL
+		ORDER BY c.name
+	`
+)
+
+// ImageInfo returns naming details for the image of a preview UUID.
+func (c *Catalog) ImageInfo(uuid string) (ImageInfo, error) {
+	var info ImageInfo
+	id, err := c.imageID(uuid)
+	if err != nil {
+		return info, err
+	}
+
+	err = c.queries.extension.QueryRow(id).Scan(&info.Extension)
+	if err != nil && err != sql.ErrNoRows {
+		return info, fmt.Errorf("database query failed: %v", err)
+	}
+
+	rows, err := c.queries.collections.Query(id)
+	if isMissingTable(err) {
+		return info, nil
+	}
+	if err != nil {
+		return info, fmt.Errorf("database query failed: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return info, fmt.Errorf("database query failed: %v", err)
+		}
+		info.Collections = append(info.Collections, name)
+	}
+	return info, rows.Err()
+}
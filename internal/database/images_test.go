@@ -0,0 +1,150 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createLibrary writes a catalog with four images across two folders, a
+// collection and a keyword.
+func createLibrary(t *testing.T) string {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "library.lrcat")
+	db, err := sql.Open("sqlite3", dbPath)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE TABLE AgLibraryRootFolder (id_local INTEGER PRIMARY KEY, absolutePath TEXT);
+		CREATE TABLE AgLibraryFolder (id_local INTEGER PRIMARY KEY, rootFolder INTEGER, pathFromRoot TEXT);
+		CREATE TABLE AgLibraryFile (id_local INTEGER PRIMARY KEY, id_global TEXT, folder INTEGER, baseName TEXT, extension TEXT);
+		CREATE TABLE Adobe_images (id_local INTEGER PRIMARY KEY, id_global TEXT, rootFile INTEGER, rating REAL, pick REAL,
+			captureTime TEXT, copyName TEXT, orientation TEXT, colorLabels TEXT);
+		CREATE TABLE AgLibraryCollection (id_local INTEGER PRIMARY KEY, name TEXT, creationId TEXT);
+		CREATE TABLE AgLibraryCollectionImage (id_local INTEGER PRIMARY KEY, collection INTEGER, image INTEGER);
+		CREATE TABLE AgLibraryKeyword (id_local INTEGER PRIMARY KEY, name TEXT, parent INTEGER);
+		CREATE TABLE AgLibraryKeywordImage (id_local INTEGER PRIMARY KEY, image INTEGER, tag INTEGER);
+
+		INSERT INTO AgLibraryRootFolder VALUES (1, '/photos/');
+		INSERT INTO AgLibraryFolder VALUES (1, 1, '2025/wedding/');
+		INSERT INTO AgLibraryFolder VALUES (2, 1, '2024/holiday/');
+		INSERT INTO AgLibraryFile VALUES (1, 'FILE-1', 1, 'IMG_0001', 'CR3');
+		INSERT INTO AgLibraryFile VALUES (2, 'FILE-2', 1, 'IMG_0002', 'CR3');
+		INSERT INTO AgLibraryFile VALUES (3, 'FILE-3', 2, 'IMG_0003', 'NEF');
+		INSERT INTO AgLibraryFile VALUES (4, 'FILE-4', 2, 'IMG_0004', 'NEF');
+		INSERT INTO Adobe_images VALUES (11, 'IMAGE-1', 1, 4, 1, '2025-06-14T15:32:11', NULL, 'AB', '');
+		INSERT INTO Adobe_images VALUES (12, 'IMAGE-2', 2, 5, 0, '2025-06-14T16:01:00', NULL, 'BC', 'Red');
+		INSERT INTO Adobe_images VALUES (13, 'IMAGE-3', 3, NULL, -1, '2024-08-01T09:00:00', NULL, 'AB', '');
+		INSERT INTO Adobe_images VALUES (14, 'IMAGE-4', 4, 4, 1, '2024-08-02T10:00:00', NULL, 'AB', '');
+		INSERT INTO AgLibraryCollection VALUES (1, '2025 Wedding', 'com.adobe.ag.library.collection');
+		INSERT INTO AgLibraryCollectionImage VALUES (1, 1, 11);
+		INSERT INTO AgLibraryCollectionImage VALUES (2, 1, 12);
+		INSERT INTO AgLibraryKeyword VALUES (1, 'Beach', NULL);
+		INSERT INTO AgLibraryKeywordImage VALUES (1, 14, 1);
+	`)
+	assert.NoError(t, err)
+	return dbPath
+}
+
+func date(s string) time.Time {
+	t, _ := time.Parse("2006-01-02", s)
+	return t
+}
+
+func TestCatalogFindImages(t *testing.T) {
+	catalog, err := OpenCatalog(createLibrary(t))
+	assert.NoError(t, err)
+	defer catalog.Close()
+
+	tests := []struct {
+		name   string
+		filter ImageFilter
+		want   []string
+	}{
+		{"all", ImageFilter{}, []string{"IMAGE-3", "IMAGE-4", "IMAGE-1", "IMAGE-2"}},
+		{"4-star picks in collection", ImageFilter{Collection: "2025 Wedding", MinRating: 4, Pick: PickPicked}, []string{"IMAGE-1"}},
+		{"rejected", ImageFilter{Pick: PickRejected}, []string{"IMAGE-3"}},
+		{"unflagged", ImageFilter{Pick: PickUnflagged}, []string{"IMAGE-2"}},
+		{"relative folder", ImageFilter{Folder: "2024/"}, []string{"IMAGE-3", "IMAGE-4"}},
+		{"absolute folder", ImageFilter{Folder: "/photos/2025"}, []string{"IMAGE-1", "IMAGE-2"}},
+		{"date range", ImageFilter{CapturedFrom: date("2024-08-02"), CapturedTo: date("2025-06-14")}, []string{"IMAGE-4", "IMAGE-1", "IMAGE-2"}},
+		{"keyword", ImageFilter{Keyword: "beach"}, []string{"IMAGE-4"}},
+		{"no match", ImageFilter{Folder: "2024_"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			images, err := catalog.FindImages(tt.filter)
+			assert.NoError(t, err)
+
+			var got []string
+			for _, image := range images {
+				got = append(got, image.UUID)
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCatalogFindImagesFields(t *testing.T) {
+	catalog, err := OpenCatalog(createLibrary(t))
+	assert.NoError(t, err)
+	defer catalog.Close()
+
+	images, err := catalog.FindImages(ImageFilter{Keyword: "Beach"})
+	assert.NoError(t, err)
+	assert.Equal(t, []Image{{
+		ID:          14,
+		UUID:        "IMAGE-4",
+		Location:    Location{UUID: "FILE-4", Dir: filepath.Join("photos", "2024", "holiday"), BaseName: "IMG_0004"},
+		Rating:      4,
+		Pick:        1,
+		CaptureTime: "2024-08-02T10:00:00",
+		Path:        filepath.Join("/photos", "2024", "holiday", "IMG_0004.NEF"),
+	}}, images)
+
+	_, err = catalog.FindImages(ImageFilter{Pick: "maybe"})
+	assert.Error(t, err)
+}
+
+func TestCatalogFindImagesVirtualCopy(t *testing.T) {
+	dbPath := createLibrary(t)
+	db, err := sql.Open("sqlite3", dbPath)
+	assert.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO Adobe_images VALUES (15, 'IMAGE-5', 4, 3, 0, '2024-08-02T10:00:00', 'B&W', 'AB', '')`)
+	assert.NoError(t, err)
+	db.Close()
+
+	catalog, err := OpenCatalog(dbPath)
+	assert.NoError(t, err)
+	defer catalog.Close()
+
+	images, err := catalog.FindImages(ImageFilter{Folder: "2024/holiday", MinRating: 3})
+	assert.NoError(t, err)
+	assert.Len(t, images, 2)
+	assert.Equal(t, "IMG_0004", images[0].Location.BaseName)
+	assert.Equal(t, "IMG_0004_B&W", images[1].Location.BaseName)
+	assert.Equal(t, "B&W", images[1].Location.CopyName)
+	assert.Equal(t, images[0].Path, images[1].Path)
+}
+
+func TestCatalogImageInfo(t *testing.T) {
+	catalog, err := OpenCatalog(createLibrary(t))
+	assert.NoError(t, err)
+	defer catalog.Close()
+
+	info, err := catalog.ImageInfo("IMAGE-1")
+	assert.NoError(t, err)
+	assert.Equal(t, ImageInfo{Extension: "CR3", Collections: []string{"2025 Wedding"}}, info)
+
+	info, err = catalog.ImageInfo("FILE-3")
+	assert.NoError(t, err)
+	assert.Equal(t, ImageInfo{Extension: "NEF"}, info)
+
+	_, err = catalog.ImageInfo("missing")
+	assert.EqualError(t, err, "no image found for UUID: missing")
+}
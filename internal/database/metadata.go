@@ -0,0 +1,261 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"lrprev-extract-go/pkg/metadata"
+)
+
+// isMissingTable reports errors from catalogs that lack an optional table,
+// such as catalogs created by older Lightroom versions.
+func isMissingTable(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "no such table")
+}
+
+// Metadata queries, prepared by NewCatalog.
+const (
+	imageIDQuery = `
+		SELECT image.id_local
+		FROM Adobe_images image
+		LEFT JOIN AgLibraryFile agfile ON agfile.id_local = image.rootFile
+		WHERE image.id_global = ? OR agfile.id_global = ?
+		ORDER BY image.id_global = ? DESC, IFNULL(image.copyName, '') <> '', image.id_local
+		LIMIT 1
+	`
+	imageRowQuery = `
+		SELECT IFNULL(captureTime, ''), IFNULL(rating, 0), IFNULL(pick, 0), IFNULL(colorLabels, '')
+		FROM Adobe_images WHERE id_local = ?
+	`
+	creatorQuery = `
+		SELECT IFNULL(creator.value, '')
+		FROM AgHarvestedIptcMetadata iptc
+		INNER JOIN AgInternedIptcCreator creator ON creator.id_local = iptc.creatorRef
+		WHERE iptc.image = ?
+	`
+	exifQuery = `
+		SELECT IFNULL(exif.aperture, 0), IFNULL(exif.shutterSpeed, 0), IFNULL(exif.isoSpeedRating, 0),
+			IFNULL(exif.focalLength, 0), IFNULL(exif.hasGPS, 0), IFNULL(exif.gpsLatitude, 0), IFNULL(exif.gpsLongitude, 0),
+			IFNULL(camera.value, ''), IFNULL(lens.value, '')
+		FROM AgHarvestedExifMetadata exif
+		LEFT JOIN AgInternedExifCameraModel camera ON camera.id_local = exif.cameraModelRef
+		LEFT JOIN AgInternedExifLens lens ON lens.id_local = exif.lensRef
+		WHERE exif.image = ?
+	`
+	iptcTitleQuery = `
+		SELECT IFNULL(caption, ''), IFNULL(copyright, ''), IFNULL(title, '')
+		FROM AgLibraryIPTC WHERE image = ?
+	`
+	iptcQuery = `
+		SELECT IFNULL(caption, ''), IFNULL(copyright, '')
+		FROM AgLibraryIPTC WHERE image = ?
+	`
+	xmpQuery = `
+		SELECT IFNULL(xmp, '') FROM Adobe_AdditionalMetadata WHERE image = ?
+	`
+	keywordsQuery = `
+		SELECT keyword.name
+		FROM AgLibraryKeywordImage ki
+		INNER JOIN AgLibraryKeyword keyword ON keyword.id_local = ki.tag
+		WHERE ki.image = ? AND keyword.name IS NOT NULL
+		ORDER BY keyword.name
+	`
+	keywordPathsQuery = `
+		WITH RECURSIVE chain(tag, parent, name, depth) AS (
+			SELECT keyword.id_local, keyword.parent, keyword.name, 0
+			FROM AgLibraryKeywordImage ki
+			INNER JOIN AgLibraryKeyword keyword ON keyword.id_local = ki.tag
+			WHERE ki.image = ?
+			UNION ALL
+			SELECT chain.tag, keyword.parent, keyword.name, chain.depth + 1
+			FROM chain
+			INNER JOIN AgLibraryKeyword keyword ON keyword.id_local = chain.parent
+			WHERE chain.depth < 64
+		)
+		SELECT tag, name FROM chain
+		WHERE name IS NOT NULL
+		ORDER BY tag, depth DESC
+	`
+)
+
+// imageID finds the Adobe_images row for a preview UUID. Previews are named
+// after the image id_global; the file id_global is accepted as well and picks
+// the master rather than one of its virtual copies.
+func (c *Catalog) imageID(uuid string) (int64, error) {
+	var id int64
+	err := c.queries.imageID.QueryRow(uuid, uuid, uuid).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("no image found for UUID: %s", uuid)
+		}
+		return 0, fmt.Errorf("database query failed: %v", err)
+	}
+	return id, nil
+}
+
+// Metadata collects capture, camera, GPS, rating, pick, title, caption,
+// copyright, keywords and a develop summary for the image of a preview UUID.
+func (c *Catalog) Metadata(uuid string) (metadata.Metadata, error) {
+	id, err := c.imageID(uuid)
+	if err != nil {
+		return metadata.Metadata{}, err
+	}
+	return c.imageMetadata(id)
+}
+
+func (c *Catalog) imageMetadata(id int64) (metadata.Metadata, error) {
+	var m metadata.Metadata
+
+	var captureTime string
+	var rating, pick float64
+	err := c.queries.image.QueryRow(id).Scan(&captureTime, &rating, &pick, &m.Label)
+	if err != nil {
+		return m, fmt.Errorf("database query failed: %v", err)
+	}
+	m.CaptureTime, _ = metadata.ParseCaptureTime(captureTime)
+	m.Rating = int(rating)
+	m.Pick = int(pick)
+
+	if err := c.exifMetadata(id, &m); err != nil {
+		return m, err
+	}
+
+	if err := c.iptc(id, &m); err != nil {
+		return m, err
+	}
+
+	err = c.queries.creator.QueryRow(id).Scan(&m.Creator)
+	if err != nil && err != sql.ErrNoRows && !isMissingTable(err) {
+		return m, fmt.Errorf("database query failed: %v", err)
+	}
+
+	m.Keywords, err = c.keywords(id)
+	if err != nil {
+		return m, err
+	}
+	m.HierarchicalKeywords, err = c.keywordPaths(id)
+	if err != nil {
+		return m, err
+	}
+	// Develop settings only go to sidecars, so a broken blob leaves the rest
+	// of the metadata usable; callers check for metadata.ErrDevelop.
+	m.Develop, err = c.developSettings(id)
+	return m, err
+}
+
+// exifMetadata reads AgHarvestedExifMetadata, where aperture and shutter
+// speed are stored as APEX values.
+func (c *Catalog) exifMetadata(id int64, m *metadata.Metadata) error {
+	var aperture, shutterSpeed, iso, focalLength, latitude, longitude float64
+	var hasGPS bool
+	err := c.queries.exif.QueryRow(id).Scan(&aperture, &shutterSpeed, &iso, &focalLength, &hasGPS, &latitude, &longitude, &m.Model, &m.Lens)
+	if err == sql.ErrNoRows || isMissingTable(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("database query failed: %v", err)
+	}
+
+	if aperture > 0 {
+		m.FNumber = math.Round(math.Pow(2, aperture/2)*10) / 10
+	}
+	if shutterSpeed != 0 {
+		m.ExposureTime = math.Pow(2, -shutterSpeed)
+	}
+	m.ISO = int(iso)
+	m.FocalLength = focalLength
+	if hasGPS {
+		m.GPS = &metadata.GPS{Latitude: latitude, Longitude: longitude}
+	}
+	return nil
+}
+
+// iptc reads the caption, copyright and title of an image. Catalogs whose
+// AgLibraryIPTC has no title column keep it in the XMP packet of
+// Adobe_AdditionalMetadata.
+func (c *Catalog) iptc(id int64, m *metadata.Metadata) error {
+	var err error
+	if c.queries.iptcTitle {
+		err = c.queries.iptc.QueryRow(id).Scan(&m.Caption, &m.Copyright, &m.Title)
+	} else {
+		err = c.queries.iptc.QueryRow(id).Scan(&m.Caption, &m.Copyright)
+		if err == nil || err == sql.ErrNoRows || isMissingTable(err) {
+			m.Title, err = c.xmpTitle(id)
+		}
+	}
+	if err != nil && err != sql.ErrNoRows && !isMissingTable(err) {
+		return fmt.Errorf("database query failed: %v", err)
+	}
+	return nil
+}
+
+func (c *Catalog) xmpTitle(id int64) (string, error) {
+	var xmp string
+	err := c.queries.xmp.QueryRow(id).Scan(&xmp)
+	if err == sql.ErrNoRows || isMissingTable(err) {
+		return "", nil
+	}
+	return metadata.XMPTitle(xmp), err
+}
+
+func (c *Catalog) keywords(id int64) ([]string, error) {
+	rows, err := c.queries.keywords.Query(id)
+	if isMissingTable(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database query failed: %v", err)
+	}
+	defer rows.Close()
+
+	var keywords []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("database query failed: %v", err)
+		}
+		keywords = append(keywords, name)
+	}
+	return keywords, rows.Err()
+}
+
+// keywordPaths returns each keyword of an image joined with its ancestors by
+// "|", as Lightroom writes lr:hierarchicalSubject. The unnamed root keyword
+// is left out.
+func (c *Catalog) keywordPaths(id int64) ([]string, error) {
+	rows, err := c.queries.keywordPaths.Query(id)
+	if isMissingTable(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("database query failed: %v", err)
+	}
+	defer rows.Close()
+
+	var tags []int64
+	names := make(map[int64][]string)
+	for rows.Next() {
+		var tag int64
+		var name string
+		if err := rows.Scan(&tag, &name); err != nil {
+			return nil, fmt.Errorf("database query failed: %v", err)
+		}
+		if _, ok := names[tag]; !ok {
+			tags = append(tags, tag)
+		}
+		names[tag] = append(names[tag], name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("database query failed: %v", err)
+	}
+
+	paths := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		paths = append(paths, strings.Join(names[tag], "|"))
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
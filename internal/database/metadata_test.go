@@ -0,0 +1,149 @@
+package database
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"lrprev-extract-go/pkg/metadata"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func addMetadataTables(t *testing.T, dbPath string) {
+	t.Helper()
+	db, err := sql.Open("sqlite3", dbPath)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE TABLE AgHarvestedExifMetadata (id_local INTEGER PRIMARY KEY, image INTEGER, aperture REAL, cameraModelRef INTEGER,
+			focalLength REAL, gpsLatitude REAL, gpsLongitude REAL, hasGPS INTEGER, isoSpeedRating REAL, lensRef INTEGER, shutterSpeed REAL);
+		CREATE TABLE AgInternedExifCameraModel (id_local INTEGER PRIMARY KEY, value TEXT);
+		CREATE TABLE AgInternedExifLens (id_local INTEGER PRIMARY KEY, value TEXT);
+		CREATE TABLE AgLibraryIPTC (id_local INTEGER PRIMARY KEY, image INTEGER, caption TEXT, copyright TEXT);
+		CREATE TABLE AgHarvestedIptcMetadata (id_local INTEGER PRIMARY KEY, image INTEGER, creatorRef INTEGER);
+		CREATE TABLE AgInternedIptcCreator (id_local INTEGER PRIMARY KEY, value TEXT);
+		CREATE TABLE Adobe_imageDevelopSettings (id_local INTEGER PRIMARY KEY, image INTEGER, text TEXT);
+		CREATE TABLE Adobe_AdditionalMetadata (id_local INTEGER PRIMARY KEY, image INTEGER, xmp TEXT);
+
+		INSERT INTO AgInternedExifCameraModel VALUES (1, 'Canon EOS R5');
+		INSERT INTO AgInternedExifLens VALUES (1, 'RF50mm F1.2 L USM');
+		INSERT INTO AgHarvestedExifMetadata VALUES (1, 14, 2.97085, 1, 50, 41.8781, -87.6298, 1, 400, 1, 7.96578);
+		INSERT INTO AgLibraryIPTC VALUES (1, 14, 'Sunset on the beach', '© 2024 Studio');
+		INSERT INTO AgInternedIptcCreator VALUES (1, 'Jane Doe');
+		INSERT INTO AgHarvestedIptcMetadata VALUES (1, 14, 1);
+		INSERT INTO AgLibraryKeyword VALUES (3, NULL, NULL);
+		INSERT INTO AgLibraryKeyword VALUES (4, 'Places', 3);
+		INSERT INTO AgLibraryKeyword VALUES (2, 'Atlantic', 4);
+		INSERT INTO Adobe_imageDevelopSettings VALUES (1, 14, 's = { ProcessVersion = "11.0", Exposure2012 = 0.35, Contrast2012 = 0,
+			Shadows2012 = -12, ConvertToGrayscale = false, WhiteBalance = "As Shot", ToneCurvePV2012 = { 0, 0, 255, 255, }, }');
+		INSERT INTO AgLibraryKeywordImage VALUES (2, 14, 2);
+		INSERT INTO Adobe_AdditionalMetadata VALUES (1, 14, '<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+			<rdf:Description rdf:about="" xmlns:dc="http://purl.org/dc/elements/1.1/"><dc:title><rdf:Alt>
+			<rdf:li xml:lang="x-default">Golden hour</rdf:li></rdf:Alt></dc:title></rdf:Description></rdf:RDF></x:xmpmeta>');
+	`)
+	assert.NoError(t, err)
+}
+
+func TestCatalogMetadata(t *testing.T) {
+	dbPath := createLibrary(t)
+	addMetadataTables(t, dbPath)
+
+	catalog, err := OpenCatalog(dbPath)
+	assert.NoError(t, err)
+	defer catalog.Close()
+
+	m, err := catalog.Metadata("IMAGE-4")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 8, 2, 10, 0, 0, 0, time.UTC), m.CaptureTime)
+	assert.Equal(t, "Canon EOS R5", m.Model)
+	assert.Equal(t, "RF50mm F1.2 L USM", m.Lens)
+	assert.Equal(t, 2.8, m.FNumber)
+	assert.InDelta(t, 1.0/250, m.ExposureTime, 0.00001)
+	assert.Equal(t, 400, m.ISO)
+	assert.Equal(t, 50.0, m.FocalLength)
+	assert.Equal(t, &metadata.GPS{Latitude: 41.8781, Longitude: -87.6298}, m.GPS)
+	assert.Equal(t, 4, m.Rating)
+	assert.Equal(t, "Golden hour", m.Title)
+	assert.Equal(t, "Sunset on the beach", m.Caption)
+	assert.Equal(t, "© 2024 Studio", m.Copyright)
+	assert.Equal(t, "Jane Doe", m.Creator)
+	assert.Equal(t, []string{"Atlantic", "Beach"}, m.Keywords)
+	assert.Equal(t, []string{"Beach", "Places|Atlantic"}, m.HierarchicalKeywords)
+	assert.Equal(t, 1, m.Pick)
+	assert.Equal(t, []metadata.Setting{
+		{Name: "ProcessVersion", Value: "11.0"},
+		{Name: "WhiteBalance", Value: "As Shot"},
+		{Name: "Exposure2012", Value: "0.35"},
+		{Name: "Shadows2012", Value: "-12"},
+	}, m.Develop)
+
+	// The file id_global resolves to the same image
+	byFile, err := catalog.Metadata("FILE-4")
+	assert.NoError(t, err)
+	assert.Equal(t, m, byFile)
+
+	_, err = catalog.Metadata("missing")
+	assert.EqualError(t, err, "no image found for UUID: missing")
+}
+
+func TestCatalogMetadata_IPTCTitle(t *testing.T) {
+	dbPath := createLibrary(t)
+	addMetadataTables(t, dbPath)
+	db, err := sql.Open("sqlite3", dbPath)
+	assert.NoError(t, err)
+	_, err = db.Exec(`
+		ALTER TABLE AgLibraryIPTC ADD COLUMN title TEXT;
+		UPDATE AgLibraryIPTC SET title = 'First dance' WHERE image = 14;
+	`)
+	assert.NoError(t, err)
+	db.Close()
+
+	catalog, err := OpenCatalog(dbPath)
+	assert.NoError(t, err)
+	defer catalog.Close()
+
+	m, err := catalog.Metadata("IMAGE-4")
+	assert.NoError(t, err)
+	assert.Equal(t, "First dance", m.Title)
+	assert.Equal(t, "Sunset on the beach", m.Caption)
+	assert.Equal(t, "© 2024 Studio", m.Copyright)
+}
+
+func TestCatalogMetadata_MissingTables(t *testing.T) {
+	catalog, err := OpenCatalog(createLibrary(t))
+	assert.NoError(t, err)
+	defer catalog.Close()
+
+	m, err := catalog.Metadata("IMAGE-2")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, m.Rating)
+	assert.Equal(t, "Red", m.Label)
+	assert.Empty(t, m.Model)
+	assert.Nil(t, m.GPS)
+	assert.Empty(t, m.Keywords)
+	assert.Empty(t, m.Develop)
+}
+
+func TestCatalogMetadata_BadDevelopSettings(t *testing.T) {
+	dbPath := createLibrary(t)
+	addMetadataTables(t, dbPath)
+	db, err := sql.Open("sqlite3", dbPath)
+	assert.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO Adobe_imageDevelopSettings VALUES (2, 11, 's = { Exposure2012 = ')`)
+	assert.NoError(t, err)
+	db.Close()
+
+	catalog, err := OpenCatalog(dbPath)
+	assert.NoError(t, err)
+	defer catalog.Close()
+
+	m, err := catalog.Metadata("IMAGE-1")
+	assert.ErrorIs(t, err, metadata.ErrDevelop)
+	assert.ErrorContains(t, err, "for image 11")
+	assert.Empty(t, m.Develop)
+	assert.Equal(t, 4, m.Rating)
+	assert.Equal(t, 1, m.Pick)
+	assert.NotZero(t, m.CaptureTime)
+}
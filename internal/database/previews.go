@@ -0,0 +1,135 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const PreviewIndexName = "previews.db"
+
+// PreviewEntry is a row of ImageCacheEntry in a Previews.lrdata/previews.db.
+// ImageID is the id_local of the image in the catalog's Adobe_images table.
+type PreviewEntry struct {
+	ImageID        int64
+	UUID           string
+	Digest         string
+	Orientation    string
+	PyramidDigest  string
+	HasPyramidInfo bool
+}
+
+// PreviewIndex is the in-memory content of previews.db, keyed by preview UUID.
+type PreviewIndex struct {
+	entries map[string]PreviewEntry
+}
+
+func OpenPreviewIndex(dbPath string) (*PreviewIndex, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		return nil, fmt.Errorf("error opening preview index: %v", err)
+	}
+
+	db, err := OpenDatabase(readOnlyDSN(dbPath))
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	return loadPreviewIndex(db)
+}
+
+func loadPreviewIndex(db *sql.DB) (*PreviewIndex, error) {
+	rows, err := db.Query(`
+		SELECT entry.imageId, entry.uuid, entry.digest, IFNULL(entry.orientation, ''), pyramid.digest
+		FROM ImageCacheEntry entry
+		LEFT JOIN Pyramid pyramid ON pyramid.uuid = entry.uuid
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("preview index query failed: %v", err)
+	}
+	defer rows.Close()
+
+	index := &PreviewIndex{entries: make(map[string]PreviewEntry)}
+	for rows.Next() {
+		var entry PreviewEntry
+		var pyramidDigest sql.NullString
+		if err := rows.Scan(&entry.ImageID, &entry.UUID, &entry.Digest, &entry.Orientation, &pyramidDigest); err != nil {
+			return nil, fmt.Errorf("preview index query failed: %v", err)
+		}
+		entry.PyramidDigest = pyramidDigest.String
+		entry.HasPyramidInfo = pyramidDigest.Valid
+		index.entries[strings.ToUpper(entry.UUID)] = entry
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("preview index query failed: %v", err)
+	}
+	return index, nil
+}
+
+func (p *PreviewIndex) Lookup(uuid string) (PreviewEntry, bool) {
+	entry, ok := p.entries[strings.ToUpper(uuid)]
+	return entry, ok
+}
+
+// Entries returns every entry ordered by image id.
+func (p *PreviewIndex) Entries() []PreviewEntry {
+	entries := make([]PreviewEntry, 0, len(p.entries))
+	for _, entry := range p.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ImageID < entries[j].ImageID
+	})
+	return entries
+}
+
+// IsOrphan reports whether no image refers to the preview with this uuid:
+// either previews.db has no entry for it, or, when imageIDs from the catalog
+// are given, the entry points at an image that no longer exists.
+func (p *PreviewIndex) IsOrphan(uuid string, imageIDs map[int64]bool) bool {
+	entry, ok := p.Lookup(uuid)
+	if !ok {
+		return true
+	}
+	return imageIDs != nil && !imageIDs[entry.ImageID]
+}
+
+// FindPreviewIndex looks for previews.db next to path. Inside a .lrdata
+// directory it also looks in the parents up to that directory; elsewhere it
+// never leaves the directory of path.
+func FindPreviewIndex(path string) (string, bool) {
+	dir, err := filepath.Abs(path)
+	if err != nil {
+		return "", false
+	}
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+
+	top := dir
+	for candidate := dir; ; {
+		if strings.EqualFold(filepath.Ext(candidate), ".lrdata") {
+			top = candidate
+			break
+		}
+		parent := filepath.Dir(candidate)
+		if parent == candidate {
+			break
+		}
+		candidate = parent
+	}
+
+	for {
+		candidate := filepath.Join(dir, PreviewIndexName)
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, true
+		}
+		if dir == top {
+			return "", false
+		}
+		dir = filepath.Dir(dir)
+	}
+}
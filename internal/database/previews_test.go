@@ -0,0 +1,127 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createPreviewIndex(t *testing.T, dir string) string {
+	t.Helper()
+	dbPath := filepath.Join(dir, PreviewIndexName)
+	db, err := sql.Open("sqlite3", dbPath)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE TABLE ImageCacheEntry (imageId INTEGER PRIMARY KEY, uuid NOT NULL, digest NOT NULL, orientation);
+		CREATE TABLE Pyramid (uuid UNIQUE NOT NULL, digest NOT NULL);
+		INSERT INTO ImageCacheEntry VALUES (20, 'BBBB-0002', 'digest-b', NULL);
+		INSERT INTO ImageCacheEntry VALUES (10, 'AAAA-0001', 'digest-a', 'AB');
+		INSERT INTO ImageCacheEntry VALUES (30, 'CCCC-0003', 'digest-c', 'BC');
+		INSERT INTO Pyramid VALUES ('AAAA-0001', 'pyramid-a');
+	`)
+	assert.NoError(t, err)
+	return dbPath
+}
+
+func TestOpenPreviewIndex(t *testing.T) {
+	index, err := OpenPreviewIndex(createPreviewIndex(t, t.TempDir()))
+	assert.NoError(t, err)
+
+	entry, ok := index.Lookup("aaaa-0001")
+	assert.True(t, ok)
+	assert.Equal(t, PreviewEntry{
+		ImageID:        10,
+		UUID:           "AAAA-0001",
+		Digest:         "digest-a",
+		Orientation:    "AB",
+		PyramidDigest:  "pyramid-a",
+		HasPyramidInfo: true,
+	}, entry)
+
+	entries := index.Entries()
+	assert.Len(t, entries, 3)
+	assert.Equal(t, int64(10), entries[0].ImageID)
+	assert.Equal(t, int64(30), entries[2].ImageID)
+	assert.False(t, entries[1].HasPyramidInfo)
+
+	_, ok = index.Lookup("missing")
+	assert.False(t, ok)
+}
+
+func TestPreviewIndexIsOrphan(t *testing.T) {
+	index, err := OpenPreviewIndex(createPreviewIndex(t, t.TempDir()))
+	assert.NoError(t, err)
+
+	assert.False(t, index.IsOrphan("AAAA-0001", nil))
+	assert.True(t, index.IsOrphan("DDDD-0004", nil))
+
+	imageIDs := map[int64]bool{10: true, 20: true}
+	assert.False(t, index.IsOrphan("BBBB-0002", imageIDs))
+	assert.True(t, index.IsOrphan("CCCC-0003", imageIDs))
+}
+
+func TestFindPreviewIndex(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "Catalog Previews.lrdata")
+	nested := filepath.Join(root, "A", "A1B2")
+	assert.NoError(t, os.MkdirAll(nested, 0755))
+	preview := filepath.Join(nested, "A1B2-0000.lrprev")
+	assert.NoError(t, os.WriteFile(preview, []byte("x"), 0644))
+
+	_, ok := FindPreviewIndex(preview)
+	assert.False(t, ok)
+
+	want := createPreviewIndex(t, root)
+	for _, start := range []string{root, nested, preview} {
+		got, ok := FindPreviewIndex(start)
+		assert.True(t, ok, start)
+		assert.Equal(t, want, got)
+	}
+}
+
+func TestFindPreviewIndex_OutsideLrdata(t *testing.T) {
+	root := t.TempDir()
+	createPreviewIndex(t, root)
+	input := filepath.Join(root, "exports", "previews")
+	assert.NoError(t, os.MkdirAll(input, 0755))
+
+	_, ok := FindPreviewIndex(input)
+	assert.False(t, ok)
+
+	want := createPreviewIndex(t, input)
+	got, ok := FindPreviewIndex(input)
+	assert.True(t, ok)
+	assert.Equal(t, want, got)
+}
+
+func TestCatalogLookupImageID(t *testing.T) {
+	dbPath := createCatalog(t, 2)
+	db, err := sql.Open("sqlite3", dbPath)
+	assert.NoError(t, err)
+	_, err = db.Exec(`
+		CREATE TABLE Adobe_images (id_local INTEGER PRIMARY KEY, id_global TEXT, rootFile INTEGER, copyName TEXT);
+		INSERT INTO Adobe_images VALUES (10, 'IMAGE-A', 2, NULL);
+		INSERT INTO Adobe_images VALUES (11, 'IMAGE-B', 1, NULL);
+	`)
+	assert.NoError(t, err)
+	db.Close()
+
+	catalog, err := OpenCatalog(dbPath)
+	assert.NoError(t, err)
+	defer catalog.Close()
+
+	location, err := catalog.LookupImageID(10)
+	assert.NoError(t, err)
+	assert.Equal(t, "IMG_0001", location.BaseName)
+
+	_, err = catalog.LookupImageID(99)
+	assert.EqualError(t, err, "no entry found for image id: 99")
+
+	ids, err := catalog.ImageIDs()
+	assert.NoError(t, err)
+	assert.Equal(t, map[int64]bool{10: true, 11: true}, ids)
+}
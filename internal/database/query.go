@@ -0,0 +1,91 @@
+package database
+
+import "database/sql"
+
+// query is a statement prepared once by NewCatalog. Preparing fails on
+// catalogs that lack one of its tables or columns; the error is then kept and
+// returned by every use, so callers handle it as they would a failed query.
+type query struct {
+	stmt *sql.Stmt
+	err  error
+}
+
+func prepareQuery(db *sql.DB, text string) *query {
+	stmt, err := db.Prepare(text)
+	return &query{stmt: stmt, err: err}
+}
+
+func (q *query) QueryRow(args ...interface{}) scanner {
+	if q.err != nil {
+		return errorRow{q.err}
+	}
+	return q.stmt.QueryRow(args...)
+}
+
+func (q *query) Query(args ...interface{}) (*sql.Rows, error) {
+	if q.err != nil {
+		return nil, q.err
+	}
+	return q.stmt.Query(args...)
+}
+
+func (q *query) Close() {
+	if q != nil && q.stmt != nil {
+		q.stmt.Close()
+	}
+}
+
+type errorRow struct {
+	err error
+}
+
+func (r errorRow) Scan(dest ...interface{}) error {
+	return r.err
+}
+
+// imageQueries are the metadata and naming queries run for every image.
+type imageQueries struct {
+	imageID      *query
+	image        *query
+	exif         *query
+	iptc         *query
+	creator      *query
+	xmp          *query
+	keywords     *query
+	keywordPaths *query
+	develop      *query
+	extension    *query
+	collections  *query
+
+	// iptcTitle is false for catalogs whose AgLibraryIPTC has no title
+	// column; the title is then read from xmp.
+	iptcTitle bool
+}
+
+func prepareImageQueries(db *sql.DB) imageQueries {
+	q := imageQueries{
+		imageID:      prepareQuery(db, imageIDQuery),
+		image:        prepareQuery(db, imageRowQuery),
+		exif:         prepareQuery(db, exifQuery),
+		creator:      prepareQuery(db, creatorQuery),
+		xmp:          prepareQuery(db, xmpQuery),
+		keywords:     prepareQuery(db, keywordsQuery),
+		keywordPaths: prepareQuery(db, keywordPathsQuery),
+		develop:      prepareQuery(db, developQuery),
+		extension:    prepareQuery(db, extensionQuery),
+		collections:  prepareQuery(db, collectionsQuery),
+	}
+	if q.iptc = prepareQuery(db, iptcTitleQuery); q.iptc.err == nil {
+		q.iptcTitle = true
+	} else {
+		q.iptc = prepareQuery(db, iptcQuery)
+	}
+	return q
+}
+
+func (q imageQueries) Close() {
+	for _, stmt := range []*query{q.imageID, q.image, q.exif, q.iptc, q.creator, q.xmp,
+		q.keywords, q.keywordPaths, q.develop, q.extension, q.collections} {
+		stmt.Close()
+	}
+}
@@ -0,0 +1,292 @@
+package discover
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"lrprev-extract-go/pkg/lrprev"
+)
+
+const (
+	ReasonNotPreview  = "not a .lrprev file"
+	ReasonEmpty       = "empty file"
+	ReasonExcluded    = "matched an exclude pattern"
+	ReasonNotIncluded = "did not match any include pattern"
+	ReasonUnreadable  = "unreadable"
+)
+
+type Options struct {
+	// Include and Exclude are glob patterns. Patterns containing a slash are
+	// matched against the path relative to the root, others against the base
+	// name. "**" matches across directory levels.
+	Include []string
+	Exclude []string
+	// Extension selects the files to find; ".lrprev" when empty. Smart
+	// previews use ".dng".
+	Extension string
+}
+
+type Skipped struct {
+	Path   string
+	Reason string
+	Err    error
+}
+
+type Result struct {
+	Files   []string
+	Skipped []Skipped
+}
+
+// SkipCounts summarises the skipped entries by reason.
+func (r Result) SkipCounts() map[string]int {
+	counts := make(map[string]int)
+	for _, s := range r.Skipped {
+		counts[s.Reason]++
+	}
+	return counts
+}
+
+func (r Result) SkipSummary() string {
+	counts := r.SkipCounts()
+	reasons := make([]string, 0, len(counts))
+	for reason := range counts {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+
+	parts := make([]string, 0, len(reasons))
+	for _, reason := range reasons {
+		parts = append(parts, fmt.Sprintf("%d %s", counts[reason], reason))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Matcher applies the rules of Find to single paths, for callers that learn
+// about files one at a time.
+type Matcher struct {
+	root    string
+	ext     string
+	include patterns
+	exclude patterns
+}
+
+func NewMatcher(root string, opts Options) (*Matcher, error) {
+	include, err := compilePatterns(opts.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compilePatterns(opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	ext := opts.Extension
+	if ext == "" {
+		ext = ".lrprev"
+	}
+	return &Matcher{root: root, ext: ext, include: include, exclude: exclude}, nil
+}
+
+func (m *Matcher) rel(path string) string {
+	rel, err := filepath.Rel(m.root, path)
+	if err != nil {
+		rel = path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// File reports whether path is a preview file that Find would return,
+// ignoring its size.
+func (m *Matcher) File(file string) bool {
+	rel := m.rel(file)
+	if !strings.EqualFold(filepath.Ext(file), m.ext) || m.exclude.match(rel) {
+		return false
+	}
+	// Find does not descend into excluded directories.
+	for dir := path.Dir(rel); dir != "." && dir != "/" && !strings.HasPrefix(dir, ".."); dir = path.Dir(dir) {
+		if m.exclude.match(dir) {
+			return false
+		}
+	}
+	return len(m.include) == 0 || m.include.match(rel)
+}
+
+func (m *Matcher) notPreview() string {
+	if m.ext == ".lrprev" {
+		return ReasonNotPreview
+	}
+	return "not a " + m.ext + " file"
+}
+
+// Dir reports whether Find would descend into the directory path.
+func (m *Matcher) Dir(path string) bool {
+	return path == m.root || !m.exclude.match(m.rel(path))
+}
+
+// Find walks root recursively and returns every .lrprev file, or file with
+// opts.Extension, at any depth, in lexical order.
+func Find(root string, opts Options) (Result, error) {
+	m, err := NewMatcher(root, opts)
+	if err != nil {
+		return Result{}, err
+	}
+	include, exclude := m.include, m.exclude
+
+	var result Result
+	err = filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			result.Skipped = append(result.Skipped, Skipped{Path: path, Reason: ReasonUnreadable, Err: err})
+			if d != nil && d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, relErr := filepath.Rel(root, path)
+		if relErr != nil {
+			rel = path
+		}
+		rel = filepath.ToSlash(rel)
+
+		if d.IsDir() {
+			if path != root && exclude.match(rel) {
+				result.Skipped = append(result.Skipped, Skipped{Path: path, Reason: ReasonExcluded})
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case !strings.EqualFold(filepath.Ext(path), m.ext):
+			result.Skipped = append(result.Skipped, Skipped{Path: path, Reason: m.notPreview()})
+		case exclude.match(rel):
+			result.Skipped = append(result.Skipped, Skipped{Path: path, Reason: ReasonExcluded})
+		case len(include) > 0 && !include.match(rel):
+			result.Skipped = append(result.Skipped, Skipped{Path: path, Reason: ReasonNotIncluded})
+		default:
+			info, err := d.Info()
+			if err != nil {
+				result.Skipped = append(result.Skipped, Skipped{Path: path, Reason: ReasonUnreadable, Err: err})
+			} else if info.Size() == 0 {
+				result.Skipped = append(result.Skipped, Skipped{Path: path, Reason: ReasonEmpty})
+			} else {
+				result.Files = append(result.Files, path)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Result{}, fmt.Errorf("error walking %s: %v", root, err)
+	}
+	return result, nil
+}
+
+type pattern struct {
+	re       *regexp.Regexp
+	fullPath bool
+}
+
+type patterns []pattern
+
+func (ps patterns) match(rel string) bool {
+	base := rel[strings.LastIndex(rel, "/")+1:]
+	for _, p := range ps {
+		if p.fullPath && p.re.MatchString(rel) {
+			return true
+		}
+		if !p.fullPath && p.re.MatchString(base) {
+			return true
+		}
+	}
+	return false
+}
+
+func compilePatterns(globs []string) (patterns, error) {
+	var ps patterns
+	for _, glob := range globs {
+		glob = filepath.ToSlash(strings.TrimSpace(glob))
+		if glob == "" {
+			continue
+		}
+		re, err := globToRegexp(glob)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %v", glob, err)
+		}
+		ps = append(ps, pattern{re: re, fullPath: strings.Contains(glob, "/")})
+	}
+	return ps, nil
+}
+
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				i++
+				if i+1 < len(glob) && glob[i+1] == '/' {
+					// "**/" also matches zero directories
+					i++
+					sb.WriteString("(?:.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+			} else {
+				sb.WriteString("[^/]*")
+			}
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end + 1
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// IndexByUUID maps the UUID of each preview to its path, reading it from the
+// header with lrprev.FileUUID so renamed previews are found too. When a UUID
+// has several previews, such as a stale one left behind after an edit, the
+// most recently modified file wins.
+func IndexByUUID(files []string) map[string]string {
+	index := make(map[string]string, len(files))
+	modTimes := make(map[string]int64, len(files))
+	for _, file := range files {
+		uuid, err := lrprev.FileUUID(file)
+		if err != nil {
+			continue
+		}
+		uuid = strings.ToUpper(uuid)
+
+		var modTime int64
+		if info, err := os.Stat(file); err == nil {
+			modTime = info.ModTime().UnixNano()
+		}
+		if _, ok := index[uuid]; !ok || modTime > modTimes[uuid] {
+			index[uuid] = file
+			modTimes[uuid] = modTime
+		}
+	}
+	return index
+}
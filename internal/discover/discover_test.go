@@ -0,0 +1,152 @@
+package discover
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"lrprev-extract-go/pkg/lrprev"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestFind_NestedHierarchy(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"A/A1B2/A1B2C3D4-0000-0000-0000-000000000001-abc.lrprev": "x",
+		"B/B9F0/B9F01234-0000-0000-0000-000000000002-def.lrprev": "x",
+		"top.lrprev":          "x",
+		"previews.db":         "db",
+		"A/A1B2/empty.lrprev": "",
+	})
+
+	result, err := Find(root, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(root, "A", "A1B2", "A1B2C3D4-0000-0000-0000-000000000001-abc.lrprev"),
+		filepath.Join(root, "B", "B9F0", "B9F01234-0000-0000-0000-000000000002-def.lrprev"),
+		filepath.Join(root, "top.lrprev"),
+	}, result.Files)
+	assert.Equal(t, map[string]int{ReasonNotPreview: 1, ReasonEmpty: 1}, result.SkipCounts())
+	assert.Equal(t, "1 empty file, 1 not a .lrprev file", result.SkipSummary())
+}
+
+func TestFind_IncludeExclude(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"A/A1B2/A1B2-keep.lrprev":  "x",
+		"A/A1B2/A1B2-other.lrprev": "x",
+		"B/B9F0/B9F0-keep.lrprev":  "x",
+		"Trash/C000/C000.lrprev":   "x",
+	})
+
+	result, err := Find(root, Options{
+		Include: []string{"*-keep.lrprev"},
+		Exclude: []string{"B/**"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(root, "A", "A1B2", "A1B2-keep.lrprev")}, result.Files)
+	assert.Equal(t, map[string]int{ReasonExcluded: 1, ReasonNotIncluded: 2}, result.SkipCounts())
+
+	result, err = Find(root, Options{Exclude: []string{"Trash"}})
+	assert.NoError(t, err)
+	assert.Len(t, result.Files, 3)
+	assert.Equal(t, []Skipped{{Path: filepath.Join(root, "Trash"), Reason: ReasonExcluded}}, result.Skipped)
+}
+
+func TestFind_Errors(t *testing.T) {
+	_, err := Find(filepath.Join(t.TempDir(), "missing"), Options{})
+	assert.Error(t, err)
+
+	_, err = Find(t.TempDir(), Options{Include: []string{"[abc"}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid pattern")
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob  string
+		path  string
+		match bool
+	}{
+		{"*.lrprev", "a.lrprev", true},
+		{"*.lrprev", "A/a.lrprev", false},
+		{"**/*.lrprev", "a.lrprev", true},
+		{"**/*.lrprev", "A/A1B2/a.lrprev", true},
+		{"A/**", "A/A1B2/a.lrprev", true},
+		{"A/?1B2/*", "A/A1B2/a.lrprev", true},
+		{"[AB]/*", "C/x", false},
+		{"[!AB]/*", "C/x", true},
+	}
+
+	for _, tt := range tests {
+		re, err := globToRegexp(tt.glob)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.match, re.MatchString(tt.path), "%s vs %s", tt.glob, tt.path)
+	}
+}
+
+func TestIndexByUUID(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"A/A1B2/A1B2C3D4-0000-0000-0000-000000000001-old.lrprev": "x",
+		"A/A1B2/A1B2C3D4-0000-0000-0000-000000000001-new.lrprev": "x",
+		"b/b9f0/b9f01234-0000-0000-0000-000000000002-def.lrprev": "x",
+		"noid.lrprev": "x",
+	})
+	var header bytes.Buffer
+	assert.NoError(t, lrprev.WriteSection(&header, "header", []byte(`pyramid = { uuid = "C0FFEE00-0000-0000-0000-000000000003" }`), 0))
+	writeFiles(t, root, map[string]string{"copies/renamed.lrprev": header.String()})
+	old := filepath.Join(root, "A", "A1B2", "A1B2C3D4-0000-0000-0000-000000000001-old.lrprev")
+	past := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(old, past, past))
+
+	result, err := Find(root, Options{})
+	assert.NoError(t, err)
+
+	index := IndexByUUID(result.Files)
+	assert.Equal(t, map[string]string{
+		"A1B2C3D4-0000-0000-0000-000000000001": filepath.Join(root, "A", "A1B2", "A1B2C3D4-0000-0000-0000-000000000001-new.lrprev"),
+		"B9F01234-0000-0000-0000-000000000002": filepath.Join(root, "b", "b9f0", "b9f01234-0000-0000-0000-000000000002-def.lrprev"),
+		"C0FFEE00-0000-0000-0000-000000000003": filepath.Join(root, "copies", "renamed.lrprev"),
+	}, index)
+}
+
+func TestMatcher(t *testing.T) {
+	root := t.TempDir()
+	m, err := NewMatcher(root, Options{Include: []string{"A/**"}, Exclude: []string{"A/Trash"}})
+	assert.NoError(t, err)
+
+	assert.True(t, m.File(filepath.Join(root, "A", "A1B2", "a.LRPREV")))
+	assert.False(t, m.File(filepath.Join(root, "A", "previews.db")))
+	assert.False(t, m.File(filepath.Join(root, "B", "b.lrprev")))
+	assert.False(t, m.File(filepath.Join(root, "A", "Trash", "t.lrprev")))
+
+	assert.True(t, m.Dir(root))
+	assert.True(t, m.Dir(filepath.Join(root, "B")))
+	assert.False(t, m.Dir(filepath.Join(root, "A", "Trash")))
+}
+
+func TestFind_Extension(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"1/1A2B/1A2B3C4D-0000-0000-0000-000000000001.dng": "x",
+		"1/1A2B/preview.lrprev":                           "x",
+	})
+
+	result, err := Find(root, Options{Extension: ".dng"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(root, "1", "1A2B", "1A2B3C4D-0000-0000-0000-000000000001.dng")}, result.Files)
+	assert.Equal(t, "1 not a .dng file", result.SkipSummary())
+}
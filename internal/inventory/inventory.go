@@ -0,0 +1,319 @@
+// Package inventory checks what is left of each catalog image: its original
+// on disk, its preview and its smart preview, and picks the best source to
+// recover it from.
+package inventory
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"lrprev-extract-go/internal/database"
+	"lrprev-extract-go/internal/discover"
+	"lrprev-extract-go/internal/pool"
+	"lrprev-extract-go/pkg/dng"
+	"lrprev-extract-go/pkg/lrprev"
+)
+
+// Recovery sources, from best to worst when the original is missing the
+// larger of the preview and smart preview wins.
+const (
+	SourceOriginal     = "original"
+	SourcePreview      = "preview"
+	SourceSmartPreview = "smart-preview"
+	SourceNone         = "none"
+)
+
+// Options locates the previews checked against the catalog. Directories
+// that do not exist are treated as empty.
+type Options struct {
+	PreviewsDir      string
+	SmartPreviewsDir string
+	// Previews links images to preview UUIDs through previews.db when the
+	// preview is not named after the image.
+	Previews *lrprev.PreviewIndex
+	Workers  int
+}
+
+// Entry is one image of the report.
+type Entry struct {
+	ImageID        int64  `json:"image_id"`
+	UUID           string `json:"uuid"`
+	CopyName       string `json:"copy_name,omitempty"`
+	Original       string `json:"original"`
+	OriginalExists bool   `json:"original_exists"`
+	// Preview and SmartPreview are empty when the image has none.
+	Preview            string `json:"preview,omitempty"`
+	PreviewWidth       int    `json:"preview_width,omitempty"`
+	PreviewHeight      int    `json:"preview_height,omitempty"`
+	SmartPreview       string `json:"smart_preview,omitempty"`
+	SmartPreviewWidth  int    `json:"smart_preview_width,omitempty"`
+	SmartPreviewHeight int    `json:"smart_preview_height,omitempty"`
+	// Best is the Source* to recover the image from and BestPath its file.
+	Best     string `json:"best_source"`
+	BestPath string `json:"best_path,omitempty"`
+	// Errors lists previews that exist but could not be read.
+	Errors []string `json:"errors,omitempty"`
+
+	image database.Image
+}
+
+// Image returns the catalog image the entry describes.
+func (e Entry) Image() database.Image {
+	return e.image
+}
+
+// Build checks every image, reading the size of its previews, and returns
+// the entries in the order of images.
+func Build(images []database.Image, opts Options) ([]Entry, error) {
+	previews, err := index(opts.PreviewsDir, ".lrprev", opts.Previews)
+	if err != nil {
+		return nil, err
+	}
+	smartPreviews, err := index(opts.SmartPreviewsDir, ".dng", opts.Previews)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, len(images))
+	indices := make([]int, len(images))
+	for i := range indices {
+		indices[i] = i
+	}
+	pool.Run(indices, opts.Workers, func(i int) error {
+		image := images[i]
+		entries[i] = check(image, previews.Find(image), smartPreviews.Find(image))
+		return nil
+	}, nil)
+	return entries, nil
+}
+
+func index(dir, ext string, previews *lrprev.PreviewIndex) (*Index, error) {
+	if dir == "" {
+		return NewIndex(nil, previews), nil
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return NewIndex(nil, previews), nil
+	}
+	found, err := discover.Find(dir, discover.Options{Extension: ext})
+	if err != nil {
+		return nil, err
+	}
+	return NewIndex(found.Files, previews), nil
+}
+
+// Index finds the preview file of a catalog image.
+type Index struct {
+	files     map[string]string
+	byImageID map[int64]string
+}
+
+// NewIndex indexes files by uuid. previews, which may be nil, links images to
+// preview UUIDs through previews.db when the preview is not named after the
+// image.
+func NewIndex(files []string, previews *lrprev.PreviewIndex) *Index {
+	x := &Index{files: discover.IndexByUUID(files), byImageID: make(map[int64]string)}
+	if previews != nil {
+		for _, entry := range previews.Entries() {
+			x.byImageID[entry.ImageID] = strings.ToUpper(entry.UUID)
+		}
+	}
+	return x
+}
+
+// Find returns the file indexed under the uuid of the image, of its file, or
+// the one previews.db links to its id, or "" when there is none.
+func (x *Index) Find(image database.Image) string {
+	for _, uuid := range []string{strings.ToUpper(image.UUID), strings.ToUpper(image.Location.UUID), x.byImageID[image.ID]} {
+		if file, ok := x.files[uuid]; ok && uuid != "" {
+			return file
+		}
+	}
+	return ""
+}
+
+func check(image database.Image, preview, smartPreview string) Entry {
+	entry := Entry{
+		ImageID:      image.ID,
+		UUID:         image.UUID,
+		CopyName:     image.Location.CopyName,
+		Original:     image.Path,
+		Preview:      preview,
+		SmartPreview: smartPreview,
+		image:        image,
+	}
+	if info, err := os.Stat(image.Path); err == nil && info.Mode().IsRegular() {
+		entry.OriginalExists = true
+	}
+
+	var err error
+	if preview != "" {
+		if entry.PreviewWidth, entry.PreviewHeight, err = previewSize(preview); err != nil {
+			entry.Errors = append(entry.Errors, fmt.Sprintf("%s: %v", preview, err))
+			entry.Preview = ""
+		}
+	}
+	if smartPreview != "" {
+		if entry.SmartPreviewWidth, entry.SmartPreviewHeight, err = smartPreviewSize(smartPreview); err != nil {
+			entry.Errors = append(entry.Errors, fmt.Sprintf("%s: %v", smartPreview, err))
+			entry.SmartPreview = ""
+		}
+	}
+
+	entry.pickBest()
+	return entry
+}
+
+func (e *Entry) pickBest() {
+	e.BestPath = ""
+	switch {
+	case e.OriginalExists:
+		e.Best, e.BestPath = SourceOriginal, e.Original
+	case e.Preview != "" && (e.SmartPreview == "" || longEdge(e.PreviewWidth, e.PreviewHeight) >= longEdge(e.SmartPreviewWidth, e.SmartPreviewHeight)):
+		// A preview carries the develop settings, so it wins a tie.
+		e.Best, e.BestPath = SourcePreview, e.Preview
+	case e.SmartPreview != "":
+		e.Best, e.BestPath = SourceSmartPreview, e.SmartPreview
+	default:
+		e.Best = SourceNone
+	}
+}
+
+// Masters merges the virtual copies of each original into one entry, as
+// they share the original: the master's entry, or the first copy's when the
+// master is not among entries, given the largest preview and smart preview
+// of the group and its best source picked again. Entries keep the order of
+// their first image.
+func Masters(entries []Entry) []Entry {
+	groups := make(map[string]int)
+	var masters []Entry
+	for _, e := range entries {
+		i, ok := groups[e.Original]
+		if !ok {
+			groups[e.Original] = len(masters)
+			masters = append(masters, e)
+			continue
+		}
+		if masters[i].CopyName != "" && e.CopyName == "" {
+			masters[i], e = e, masters[i]
+		}
+		masters[i].merge(e)
+	}
+	for i := range masters {
+		masters[i].pickBest()
+	}
+	return masters
+}
+
+// merge takes the previews of other that are larger than the entry's own.
+func (e *Entry) merge(other Entry) {
+	if other.Preview != "" && (e.Preview == "" || longEdge(other.PreviewWidth, other.PreviewHeight) > longEdge(e.PreviewWidth, e.PreviewHeight)) {
+		e.Preview, e.PreviewWidth, e.PreviewHeight = other.Preview, other.PreviewWidth, other.PreviewHeight
+	}
+	if other.SmartPreview != "" && (e.SmartPreview == "" || longEdge(other.SmartPreviewWidth, other.SmartPreviewHeight) > longEdge(e.SmartPreviewWidth, e.SmartPreviewHeight)) {
+		e.SmartPreview, e.SmartPreviewWidth, e.SmartPreviewHeight = other.SmartPreview, other.SmartPreviewWidth, other.SmartPreviewHeight
+	}
+	e.Errors = append(e.Errors, other.Errors...)
+}
+
+func longEdge(width, height int) int {
+	return max(width, height)
+}
+
+func previewSize(path string) (int, int, error) {
+	f, err := lrprev.OpenFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	largest, ok := f.Largest()
+	if !ok {
+		return 0, 0, fmt.Errorf("no level sections")
+	}
+	if largest.Width > 0 && largest.Height > 0 {
+		return largest.Width, largest.Height, nil
+	}
+	config, err := f.LevelConfig(largest.Number)
+	if err != nil {
+		return 0, 0, err
+	}
+	return config.Width, config.Height, nil
+}
+
+func smartPreviewSize(path string) (int, int, error) {
+	f, err := dng.OpenFile(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	return f.Size()
+}
+
+// Counts returns the number of entries per best source.
+func Counts(entries []Entry) map[string]int {
+	counts := map[string]int{SourceOriginal: 0, SourcePreview: 0, SourceSmartPreview: 0, SourceNone: 0}
+	for _, e := range entries {
+		counts[e.Best]++
+	}
+	return counts
+}
+
+// Missing returns the entries whose original is no longer on disk.
+func Missing(entries []Entry) []Entry {
+	var missing []Entry
+	for _, e := range entries {
+		if !e.OriginalExists {
+			missing = append(missing, e)
+		}
+	}
+	return missing
+}
+
+var csvHeader = []string{
+	"image_id", "uuid", "copy_name", "original", "original_exists",
+	"preview", "preview_width", "preview_height",
+	"smart_preview", "smart_preview_width", "smart_preview_height",
+	"best_source", "best_path", "errors",
+}
+
+// WriteCSV writes the entries as CSV with a header row.
+func WriteCSV(w io.Writer, entries []Entry) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	size := func(n int) string {
+		if n == 0 {
+			return ""
+		}
+		return strconv.Itoa(n)
+	}
+	for _, e := range entries {
+		err := cw.Write([]string{
+			strconv.FormatInt(e.ImageID, 10), e.UUID, e.CopyName, e.Original, strconv.FormatBool(e.OriginalExists),
+			e.Preview, size(e.PreviewWidth), size(e.PreviewHeight),
+			e.SmartPreview, size(e.SmartPreviewWidth), size(e.SmartPreviewHeight),
+			e.Best, e.BestPath, strings.Join(e.Errors, "; "),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the entries as a JSON array.
+func WriteJSON(w io.Writer, entries []Entry) error {
+	if entries == nil {
+		entries = []Entry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
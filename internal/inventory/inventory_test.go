@@ -0,0 +1,248 @@
+package inventory
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"encoding/json"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"lrprev-extract-go/internal/database"
+	"lrprev-extract-go/pkg/lrprev"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func grayJPEG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)), nil))
+	return buf.Bytes()
+}
+
+func writePreview(t *testing.T, path string, width, height int) {
+	t.Helper()
+	var buf bytes.Buffer
+	assert.NoError(t, lrprev.WriteSection(&buf, "header", []byte("preview = {}"), 0))
+	assert.NoError(t, lrprev.WriteSection(&buf, "level_1", grayJPEG(t, width, height), 0))
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+}
+
+// writeSmartPreview writes a DNG holding only the IFD of a width x height
+// raw image.
+func writeSmartPreview(t *testing.T, path string, width, height int) {
+	t.Helper()
+	le := binary.LittleEndian
+	buf := []byte{'I', 'I', 42, 0, 8, 0, 0, 0}
+	buf = le.AppendUint16(buf, 3)
+	for _, e := range [][2]uint32{{254, 0}, {256, uint32(width)}, {257, uint32(height)}} {
+		buf = le.AppendUint16(buf, uint16(e[0]))
+		buf = le.AppendUint16(buf, 4)
+		buf = le.AppendUint32(buf, 1)
+		buf = le.AppendUint32(buf, e[1])
+	}
+	buf = le.AppendUint32(buf, 0)
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, os.WriteFile(path, buf, 0644))
+}
+
+// setup creates a catalog of four images under root: one whose original
+// exists, and three missing ones recoverable from a preview, a larger smart
+// preview, or nothing.
+func setup(t *testing.T) ([]database.Image, Options) {
+	t.Helper()
+	dir := t.TempDir()
+	root := filepath.Join(dir, "photos")
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "2025"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "2025", "IMG_0001.CR3"), []byte("raw"), 0644))
+
+	dbPath := filepath.Join(dir, "catalog.lrcat")
+	db, err := sql.Open("sqlite3", dbPath)
+	assert.NoError(t, err)
+	_, err = db.Exec(`
+		CREATE TABLE AgLibraryRootFolder (id_local INTEGER PRIMARY KEY, absolutePath TEXT);
+		CREATE TABLE AgLibraryFolder (id_local INTEGER PRIMARY KEY, rootFolder INTEGER, pathFromRoot TEXT);
+		CREATE TABLE AgLibraryFile (id_local INTEGER PRIMARY KEY, id_global TEXT, folder INTEGER, baseName TEXT, extension TEXT);
+		CREATE TABLE Adobe_images (id_local INTEGER PRIMARY KEY, id_global TEXT, rootFile INTEGER, rating REAL, pick REAL,
+			captureTime TEXT, copyName TEXT);
+		INSERT INTO AgLibraryRootFolder VALUES (1, '` + filepath.ToSlash(root) + `/');
+		INSERT INTO AgLibraryFolder VALUES (1, 1, '2025/');
+		INSERT INTO AgLibraryFile VALUES (1, 'FILE-1', 1, 'IMG_0001', 'CR3');
+		INSERT INTO AgLibraryFile VALUES (2, 'FILE-2', 1, 'IMG_0002', 'CR3');
+		INSERT INTO AgLibraryFile VALUES (3, 'FILE-3', 1, 'IMG_0003', 'CR3');
+		INSERT INTO AgLibraryFile VALUES (4, 'FILE-4', 1, 'IMG_0004', 'CR3');
+		INSERT INTO Adobe_images VALUES (11, 'AAAAAAAA-0000-0000-0000-000000000001', 1, 0, 0, '2025-01-01', NULL);
+		INSERT INTO Adobe_images VALUES (12, 'AAAAAAAA-0000-0000-0000-000000000002', 2, 0, 0, '2025-01-02', NULL);
+		INSERT INTO Adobe_images VALUES (13, 'AAAAAAAA-0000-0000-0000-000000000003', 3, 0, 0, '2025-01-03', NULL);
+		INSERT INTO Adobe_images VALUES (14, 'AAAAAAAA-0000-0000-0000-000000000004', 4, 0, 0, '2025-01-04', NULL);
+	`)
+	assert.NoError(t, err)
+	db.Close()
+
+	previews := filepath.Join(dir, "catalog Previews.lrdata")
+	smart := filepath.Join(dir, "catalog Smart Previews.lrdata")
+	writePreview(t, filepath.Join(previews, "A", "AAAA", "AAAAAAAA-0000-0000-0000-000000000001-abc.lrprev"), 1024, 683)
+	writePreview(t, filepath.Join(previews, "A", "AAAA", "AAAAAAAA-0000-0000-0000-000000000002-abc.lrprev"), 2048, 1365)
+	writePreview(t, filepath.Join(previews, "A", "AAAA", "AAAAAAAA-0000-0000-0000-000000000003-abc.lrprev"), 1024, 683)
+	writeSmartPreview(t, filepath.Join(smart, "A", "AAAA", "AAAAAAAA-0000-0000-0000-000000000003.dng"), 2560, 1707)
+
+	catalog, err := database.OpenCatalog(dbPath)
+	assert.NoError(t, err)
+	defer catalog.Close()
+	images, err := catalog.FindImages(database.ImageFilter{})
+	assert.NoError(t, err)
+	return images, Options{PreviewsDir: previews, SmartPreviewsDir: smart, Workers: 2}
+}
+
+func TestBuild(t *testing.T) {
+	images, opts := setup(t)
+	entries, err := Build(images, opts)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 4)
+
+	var best []string
+	for _, e := range entries {
+		best = append(best, e.Best)
+	}
+	assert.Equal(t, []string{SourceOriginal, SourcePreview, SourceSmartPreview, SourceNone}, best)
+
+	assert.True(t, entries[0].OriginalExists)
+	assert.Equal(t, entries[0].Original, entries[0].BestPath)
+	assert.Equal(t, 1024, entries[0].PreviewWidth)
+	assert.Equal(t, 2048, entries[1].PreviewWidth)
+	assert.Equal(t, 1365, entries[1].PreviewHeight)
+	assert.Equal(t, entries[1].Preview, entries[1].BestPath)
+	assert.Equal(t, 2560, entries[2].SmartPreviewWidth)
+	assert.Equal(t, entries[2].SmartPreview, entries[2].BestPath)
+	assert.False(t, entries[3].OriginalExists)
+	assert.Empty(t, entries[3].BestPath)
+	assert.Equal(t, images[3], entries[3].Image())
+
+	assert.Equal(t, map[string]int{SourceOriginal: 1, SourcePreview: 1, SourceSmartPreview: 1, SourceNone: 1}, Counts(entries))
+}
+
+func TestMissing(t *testing.T) {
+	images, opts := setup(t)
+	entries, err := Build(images, opts)
+	assert.NoError(t, err)
+
+	missing := Missing(entries)
+	assert.Len(t, missing, 3)
+	for _, e := range missing {
+		assert.False(t, e.OriginalExists)
+	}
+	assert.Equal(t, entries[1:], missing)
+	assert.Empty(t, Missing(entries[:1]))
+}
+
+func TestMasters(t *testing.T) {
+	images, opts := setup(t)
+	// A virtual copy of the fourth image, which has no preview of its own,
+	// listed before its master.
+	virtualCopy := images[3]
+	virtualCopy.ID = 15
+	virtualCopy.UUID = "AAAAAAAA-0000-0000-0000-000000000005"
+	virtualCopy.Location.BaseName = "IMG_0004_Copy 1"
+	virtualCopy.Location.CopyName = "Copy 1"
+	copyPreview := filepath.Join(opts.PreviewsDir, "A", "AAAA", "AAAAAAAA-0000-0000-0000-000000000005-abc.lrprev")
+	writePreview(t, copyPreview, 1600, 1067)
+	images = append(images[:3], virtualCopy, images[3])
+
+	entries, err := Build(images, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, SourceNone, entries[4].Best)
+
+	masters := Masters(entries)
+	assert.Len(t, masters, 4)
+	assert.Equal(t, entries[:3], masters[:3])
+	assert.Equal(t, int64(14), masters[3].ImageID)
+	assert.Empty(t, masters[3].Image().Location.CopyName)
+	assert.Equal(t, SourcePreview, masters[3].Best)
+	assert.Equal(t, copyPreview, masters[3].BestPath)
+	assert.Equal(t, 1600, masters[3].PreviewWidth)
+}
+
+func TestBuild_MissingDirectories(t *testing.T) {
+	images, opts := setup(t)
+	opts.PreviewsDir = filepath.Join(t.TempDir(), "missing")
+	opts.SmartPreviewsDir = ""
+	entries, err := Build(images, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]int{SourceOriginal: 1, SourcePreview: 0, SourceSmartPreview: 0, SourceNone: 3}, Counts(entries))
+}
+
+func TestBuild_UnreadablePreview(t *testing.T) {
+	images, opts := setup(t)
+	broken := filepath.Join(opts.PreviewsDir, "A", "AAAA", "AAAAAAAA-0000-0000-0000-000000000004-abc.lrprev")
+	assert.NoError(t, os.WriteFile(broken, []byte("garbage"), 0644))
+
+	entries, err := Build(images, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, SourceNone, entries[3].Best)
+	assert.Len(t, entries[3].Errors, 1)
+	assert.Contains(t, entries[3].Errors[0], broken)
+}
+
+func TestWrite(t *testing.T) {
+	images, opts := setup(t)
+	entries, err := Build(images, opts)
+	assert.NoError(t, err)
+
+	var csvOut bytes.Buffer
+	assert.NoError(t, WriteCSV(&csvOut, entries))
+	lines := strings.Split(strings.TrimSpace(csvOut.String()), "\n")
+	assert.Len(t, lines, 5)
+	assert.Equal(t, strings.Join(csvHeader, ","), lines[0])
+	assert.Contains(t, lines[3], ",2560,1707,smart-preview,")
+
+	var jsonOut bytes.Buffer
+	assert.NoError(t, WriteJSON(&jsonOut, entries))
+	var decoded []map[string]interface{}
+	assert.NoError(t, json.Unmarshal(jsonOut.Bytes(), &decoded))
+	assert.Len(t, decoded, 4)
+	assert.Equal(t, "preview", decoded[1]["best_source"])
+	assert.Equal(t, float64(2048), decoded[1]["preview_width"])
+	assert.NotContains(t, decoded[3], "best_path")
+
+	jsonOut.Reset()
+	assert.NoError(t, WriteJSON(&jsonOut, nil))
+	assert.Equal(t, "[]\n", jsonOut.String())
+}
+
+func TestIndex_PreviewIndex(t *testing.T) {
+	images, opts := setup(t)
+	renamed := filepath.Join(opts.PreviewsDir, "B", "BBBB", "BBBBBBBB-0000-0000-0000-000000000004-abc.lrprev")
+	writePreview(t, renamed, 640, 427)
+
+	dbPath := filepath.Join(opts.PreviewsDir, "previews.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	assert.NoError(t, err)
+	_, err = db.Exec(`
+		CREATE TABLE ImageCacheEntry (imageId INTEGER PRIMARY KEY, uuid NOT NULL, digest NOT NULL, orientation);
+		CREATE TABLE Pyramid (uuid UNIQUE NOT NULL, digest NOT NULL);
+		INSERT INTO ImageCacheEntry VALUES (14, 'BBBBBBBB-0000-0000-0000-000000000004', 'digest', NULL);
+	`)
+	assert.NoError(t, err)
+	db.Close()
+	previews, err := lrprev.OpenPreviewIndex(dbPath)
+	assert.NoError(t, err)
+
+	files := []string{renamed}
+	assert.Empty(t, NewIndex(files, nil).Find(images[3]))
+	index := NewIndex(files, previews)
+	assert.Equal(t, renamed, index.Find(images[3]))
+	assert.Empty(t, index.Find(images[2]))
+
+	opts.Previews = previews
+	entries, err := Build(images, opts)
+	assert.NoError(t, err)
+	assert.Equal(t, SourcePreview, entries[3].Best)
+	assert.Equal(t, renamed, entries[3].Preview)
+}
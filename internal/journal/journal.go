@@ -0,0 +1,311 @@
+// Package journal records which previews a run has processed, so an
+// interrupted extraction can resume where it stopped.
+package journal
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"lrprev-extract-go/pkg/lrprev"
+)
+
+// FileName is the journal kept in the output directory.
+const FileName = ".lrprev-extract-journal.jsonl"
+
+// Entry statuses.
+const (
+	StatusDone   = "done"
+	StatusFailed = "failed"
+	// StatusRemoved marks a preview that no longer exists and whose outputs
+	// were deleted.
+	StatusRemoved = "removed"
+)
+
+// Entry is one line of the journal. Later entries for the same preview
+// replace earlier ones.
+type Entry struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	// Digest is the digest from the preview header, or "sha256:" and the
+	// file's SHA-256 when the header has none.
+	Digest string `json:"digest"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Outputs lists the files written for the preview, relative to the
+	// journal's directory.
+	Outputs []string `json:"outputs,omitempty"`
+	// Settings describes the options that shape the output. Work done with
+	// other settings is not skipped.
+	Settings string    `json:"settings,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// Journal is an append-only JSONL file of Entries. It is safe for concurrent
+// use.
+type Journal struct {
+	path     string
+	settings string
+
+	mu      sync.Mutex
+	file    *os.File
+	entries map[string]Entry
+}
+
+// Open loads the journal in dir, creating it if needed. Lines that cannot be
+// parsed, such as one cut short by a crash, are ignored.
+func Open(dir, settings string) (*Journal, error) {
+	j := &Journal{
+		path:     filepath.Join(dir, FileName),
+		settings: settings,
+		entries:  make(map[string]Entry),
+	}
+
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+
+	file, err := os.OpenFile(j.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("error opening journal: %v", err)
+	}
+	j.file = file
+	return j, nil
+}
+
+// Load reads the journal in dir without opening it for writing, for dry
+// runs: Pending works as with Open, and what is recorded is kept in memory
+// only.
+func Load(dir, settings string) (*Journal, error) {
+	j := &Journal{
+		path:     filepath.Join(dir, FileName),
+		settings: settings,
+		entries:  make(map[string]Entry),
+	}
+	if err := j.load(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+func (j *Journal) load() error {
+	f, err := os.Open(j.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading journal: %v", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil || entry.Path == "" {
+			continue
+		}
+		if entry.Status == StatusRemoved {
+			delete(j.entries, entry.Path)
+			continue
+		}
+		j.entries[entry.Path] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading journal: %v", err)
+	}
+	return nil
+}
+
+// Path returns the location of the journal file.
+func (j *Journal) Path() string {
+	return j.path
+}
+
+func key(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return filepath.Clean(path)
+}
+
+// Done reports whether path was extracted with the current settings and has
+// not changed size or modification time since.
+func (j *Journal) Done(path string) bool {
+	j.mu.Lock()
+	entry, ok := j.entries[key(path)]
+	j.mu.Unlock()
+	if !ok || entry.Status != StatusDone || entry.Settings != j.settings {
+		return false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return info.Size() == entry.Size && info.ModTime().Equal(entry.ModTime)
+}
+
+// Pending splits files into those that still need work and those the journal
+// records as done.
+func (j *Journal) Pending(files []string) ([]string, []string) {
+	var pending, done []string
+	for _, file := range files {
+		if j.Done(file) {
+			done = append(done, file)
+		} else {
+			pending = append(pending, file)
+		}
+	}
+	return pending, done
+}
+
+// Record appends the outcome of processing path: done when procErr is nil,
+// failed otherwise. outputs are the files written for it.
+func (j *Journal) Record(path string, outputs []string, procErr error) error {
+	entry := Entry{
+		Path:     key(path),
+		Status:   StatusDone,
+		Settings: j.settings,
+		Time:     time.Now().UTC(),
+	}
+	for _, output := range outputs {
+		entry.Outputs = append(entry.Outputs, j.relative(output))
+	}
+	if procErr != nil {
+		entry.Status = StatusFailed
+		entry.Error = procErr.Error()
+		// Keep track of what earlier runs wrote, so it can still be pruned.
+		if previous, ok := j.Entry(path); ok {
+			entry.Outputs = mergeOutputs(previous.Outputs, entry.Outputs)
+		}
+	}
+
+	if info, err := os.Stat(path); err == nil {
+		entry.Size = info.Size()
+		entry.ModTime = info.ModTime()
+		entry.Digest, _ = Digest(path)
+	}
+	return j.append(entry)
+}
+
+// Forget records that path no longer exists, so it is dropped from the
+// journal.
+func (j *Journal) Forget(path string) error {
+	return j.append(Entry{Path: key(path), Status: StatusRemoved, Time: time.Now().UTC()})
+}
+
+func (j *Journal) append(entry Entry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("error writing journal: %v", err)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.file != nil {
+		if _, err := j.file.Write(append(line, '\n')); err != nil {
+			return fmt.Errorf("error writing journal: %v", err)
+		}
+	}
+	if entry.Status == StatusRemoved {
+		delete(j.entries, entry.Path)
+	} else {
+		j.entries[entry.Path] = entry
+	}
+	return nil
+}
+
+func (j *Journal) relative(path string) string {
+	if rel, err := filepath.Rel(filepath.Dir(j.path), key(path)); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return path
+}
+
+// OutputPath returns the path of an Entry output.
+func (j *Journal) OutputPath(output string) string {
+	if filepath.IsAbs(output) {
+		return output
+	}
+	return filepath.Join(filepath.Dir(j.path), filepath.FromSlash(output))
+}
+
+// Entries returns the latest entry of every preview in the journal.
+func (j *Journal) Entries() map[string]Entry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries := make(map[string]Entry, len(j.entries))
+	for path, entry := range j.entries {
+		entries[path] = entry
+	}
+	return entries
+}
+
+// Reset discards every entry, so the next run starts over.
+func (j *Journal) Reset() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.file != nil {
+		if err := j.file.Truncate(0); err != nil {
+			return fmt.Errorf("error resetting journal: %v", err)
+		}
+	}
+	j.entries = make(map[string]Entry)
+	return nil
+}
+
+func (j *Journal) Close() error {
+	if j.file == nil {
+		return nil
+	}
+	return j.file.Close()
+}
+
+// Digest returns the digest Lightroom stores in the preview header, which
+// changes whenever the preview is rendered again. Previews without one get
+// the SHA-256 of the file.
+func Digest(path string) (string, error) {
+	preview, err := lrprev.OpenFile(path)
+	if err == nil {
+		header, headerErr := preview.Header()
+		preview.Close()
+		if headerErr == nil && header.Digest != "" {
+			return header.Digest, nil
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error reading file: %v", err)
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", fmt.Errorf("error reading file: %v", err)
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func mergeOutputs(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var merged []string
+	for _, output := range append(append([]string(nil), a...), b...) {
+		if !seen[output] {
+			seen[output] = true
+			merged = append(merged, output)
+		}
+	}
+	return merged
+}
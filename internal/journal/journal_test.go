@@ -0,0 +1,178 @@
+package journal
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"lrprev-extract-go/pkg/lrprev"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writePreview(t *testing.T, path, digest string) {
+	t.Helper()
+	var buf bytes.Buffer
+	header := `pyramid = { digest = "` + digest + `", uuid = "UUID" }`
+	assert.NoError(t, lrprev.WriteSection(&buf, "header", []byte(header), 0))
+	assert.NoError(t, lrprev.WriteSection(&buf, "level_1", []byte{0xFF, 0xD8, 0xFF, 0xD9}, 0))
+	assert.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+}
+
+func TestJournal(t *testing.T) {
+	dir := t.TempDir()
+	done := filepath.Join(dir, "done.lrprev")
+	failed := filepath.Join(dir, "failed.lrprev")
+	fresh := filepath.Join(dir, "fresh.lrprev")
+	for _, path := range []string{done, failed, fresh} {
+		writePreview(t, path, "digest-"+filepath.Base(path))
+	}
+
+	j, err := Open(dir, "levels=all")
+	assert.NoError(t, err)
+	assert.NoError(t, j.Record(done, nil, nil))
+	assert.NoError(t, j.Record(failed, nil, errors.New("boom")))
+	assert.NoError(t, j.Close())
+
+	// A rerun skips finished work and retries failures
+	j, err = Open(dir, "levels=all")
+	assert.NoError(t, err)
+	defer j.Close()
+	pending, skipped := j.Pending([]string{done, failed, fresh})
+	assert.Equal(t, []string{failed, fresh}, pending)
+	assert.Equal(t, []string{done}, skipped)
+
+	entries := j.Entries()
+	assert.Len(t, entries, 2)
+	entry := entries[done]
+	assert.Equal(t, StatusDone, entry.Status)
+	assert.Equal(t, "digest-done.lrprev", entry.Digest)
+	assert.Equal(t, "levels=all", entry.Settings)
+	info, err := os.Stat(done)
+	assert.NoError(t, err)
+	assert.Equal(t, info.Size(), entry.Size)
+	assert.Equal(t, StatusFailed, entries[failed].Status)
+	assert.Equal(t, "boom", entries[failed].Error)
+
+	// A retried failure that succeeds replaces the failed entry
+	assert.NoError(t, j.Record(failed, nil, nil))
+	assert.True(t, j.Done(failed))
+
+	// Changed previews are extracted again
+	later := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(done, later, later))
+	assert.False(t, j.Done(done))
+}
+
+func TestJournal_Settings(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.lrprev")
+	writePreview(t, path, "digest")
+
+	j, err := Open(dir, "levels=all")
+	assert.NoError(t, err)
+	assert.NoError(t, j.Record(path, nil, nil))
+	assert.NoError(t, j.Close())
+
+	j, err = Open(dir, "levels=1")
+	assert.NoError(t, err)
+	defer j.Close()
+	assert.False(t, j.Done(path))
+}
+
+func TestJournal_Reset(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.lrprev")
+	writePreview(t, path, "digest")
+
+	j, err := Open(dir, "")
+	assert.NoError(t, err)
+	assert.NoError(t, j.Record(path, nil, nil))
+	assert.NoError(t, j.Reset())
+	assert.False(t, j.Done(path))
+	assert.NoError(t, j.Record(path, nil, nil))
+	assert.NoError(t, j.Close())
+
+	data, err := os.ReadFile(filepath.Join(dir, FileName))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, bytes.Count(data, []byte("\n")))
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	done := filepath.Join(dir, "a.lrprev")
+	pending := filepath.Join(dir, "b.lrprev")
+	writePreview(t, done, "digest")
+	writePreview(t, pending, "digest")
+
+	// Without a journal nothing is done, and none is created
+	j, err := Load(dir, "")
+	assert.NoError(t, err)
+	assert.NoError(t, j.Record(done, nil, nil))
+	assert.True(t, j.Done(done))
+	assert.NoError(t, j.Close())
+	assert.NoFileExists(t, filepath.Join(dir, FileName))
+
+	written, err := Open(dir, "")
+	assert.NoError(t, err)
+	assert.NoError(t, written.Record(done, nil, nil))
+	assert.NoError(t, written.Close())
+	before, err := os.ReadFile(filepath.Join(dir, FileName))
+	assert.NoError(t, err)
+
+	j, err = Load(dir, "")
+	assert.NoError(t, err)
+	files, skipped := j.Pending([]string{done, pending})
+	assert.Equal(t, []string{pending}, files)
+	assert.Equal(t, []string{done}, skipped)
+	assert.NoError(t, j.Record(pending, nil, nil))
+	assert.NoError(t, j.Reset())
+	assert.NoError(t, j.Close())
+	after, err := os.ReadFile(filepath.Join(dir, FileName))
+	assert.NoError(t, err)
+	assert.Equal(t, before, after)
+}
+
+func TestJournal_TruncatedLine(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.lrprev")
+	writePreview(t, path, "digest")
+
+	j, err := Open(dir, "")
+	assert.NoError(t, err)
+	assert.NoError(t, j.Record(path, nil, nil))
+	assert.NoError(t, j.Close())
+
+	// A crash can leave half a line at the end
+	f, err := os.OpenFile(filepath.Join(dir, FileName), os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteString(`{"path":"`)
+	assert.NoError(t, err)
+	f.Close()
+
+	j, err = Open(dir, "")
+	assert.NoError(t, err)
+	defer j.Close()
+	assert.True(t, j.Done(path))
+}
+
+func TestDigest(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.lrprev")
+	writePreview(t, path, "abc123")
+	digest, err := Digest(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "abc123", digest)
+
+	plain := filepath.Join(dir, "plain.lrprev")
+	assert.NoError(t, os.WriteFile(plain, []byte("data"), 0644))
+	digest, err = Digest(plain)
+	assert.NoError(t, err)
+	assert.Equal(t, "sha256:3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7", digest)
+
+	_, err = Digest(filepath.Join(dir, "missing.lrprev"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,243 @@
+package journal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"lrprev-extract-go/internal/pool"
+	"lrprev-extract-go/pkg/report"
+)
+
+// Changes classifies previews against the journal.
+type Changes struct {
+	// Added lists previews that were never extracted, or only failed.
+	Added []string
+	// Updated lists previews whose digest or settings changed since they
+	// were extracted.
+	Updated   []string
+	Unchanged []string
+	// Removed lists previews under the compared directory that the journal
+	// records but which no longer exist.
+	Removed []string
+}
+
+// Compare classifies files, the previews found under root. Previews whose
+// size or modification time changed are compared by digest; when the digest
+// is the same, only their entry is refreshed.
+func (j *Journal) Compare(root string, files []string) (Changes, error) {
+	var changes Changes
+	seen := make(map[string]bool, len(files))
+	for _, file := range files {
+		seen[key(file)] = true
+		entry, ok := j.Entry(file)
+		switch {
+		case !ok || entry.Status != StatusDone:
+			changes.Added = append(changes.Added, file)
+		case entry.Settings != j.settings:
+			changes.Updated = append(changes.Updated, file)
+		case j.Done(file):
+			changes.Unchanged = append(changes.Unchanged, file)
+		default:
+			digest, err := Digest(file)
+			if err != nil || digest != entry.Digest {
+				changes.Updated = append(changes.Updated, file)
+				continue
+			}
+			if err := j.refresh(file, entry); err != nil {
+				return changes, err
+			}
+			changes.Unchanged = append(changes.Unchanged, file)
+		}
+	}
+
+	prefix := key(root) + string(filepath.Separator)
+	for path := range j.Entries() {
+		if seen[path] || !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			changes.Removed = append(changes.Removed, path)
+		}
+	}
+	sort.Strings(changes.Removed)
+	return changes, nil
+}
+
+// SyncOptions configures Sync.
+type SyncOptions struct {
+	// Extract writes the outputs of a preview and returns the files it
+	// wrote, also when it fails.
+	Extract func(file string) ([]string, error)
+	Workers int
+	// Delete removes the outputs of previews that no longer exist.
+	Delete   bool
+	Reporter report.Reporter
+}
+
+// SyncResult is the outcome of Sync.
+type SyncResult struct {
+	Changes
+	Failed []string
+	// Deleted lists the outputs removed because their preview is gone.
+	Deleted []string
+}
+
+// Sync extracts the previews among files, found under root, that were added
+// or updated since the journal last saw them, and with opts.Delete removes
+// the outputs of those that no longer exist. An output another preview
+// still records is never removed, so a preview Lightroom re-rendered under a
+// new name keeps what its new file wrote to the same path.
+func (j *Journal) Sync(root string, files []string, opts SyncOptions) (SyncResult, error) {
+	changes, err := j.Compare(root, files)
+	if err != nil {
+		return SyncResult{}, err
+	}
+	result := SyncResult{Changes: changes}
+	rep := opts.Reporter
+
+	pending := append(append([]string(nil), changes.Added...), changes.Updated...)
+	sort.Strings(pending)
+	indices := make([]int, len(pending))
+	for i := range indices {
+		indices[i] = i
+	}
+	outputs := make([][]string, len(pending))
+	pool.Run(indices, opts.Workers, func(i int) error {
+		var err error
+		outputs[i], err = opts.Extract(pending[i])
+		return err
+	}, func(r pool.Result[int]) {
+		file, written := pending[r.Item], outputs[r.Item]
+		rep.Progress(r.Index+1, len(pending))
+		if r.Err != nil {
+			result.Failed = append(result.Failed, file)
+		} else if previous, ok := j.Entry(file); ok {
+			// Outputs whose name changed, e.g. with -include-size, are stale.
+			if _, err := j.pruneUnowned(previous.Outputs, written, map[string]bool{key(file): true}); err != nil {
+				rep.Logf(report.Error, file, "Error removing old outputs of %s: %v", file, err)
+			}
+		}
+		rep.Processed(file, written, r.Err)
+		if err := j.Record(file, written, r.Err); err != nil {
+			rep.Logf(report.Error, file, "Error updating journal: %v", err)
+		}
+	})
+
+	if !opts.Delete {
+		return result, nil
+	}
+	removed := make(map[string]bool, len(changes.Removed))
+	for _, preview := range changes.Removed {
+		removed[key(preview)] = true
+	}
+	keep := j.outputsExcept(removed)
+	for _, preview := range changes.Removed {
+		entry, _ := j.Entry(preview)
+		paths, err := j.Prune(entry.Outputs, keep)
+		result.Deleted = append(result.Deleted, paths...)
+		if err != nil {
+			rep.Logf(report.Error, preview, "Error removing outputs of %s: %v", preview, err)
+			continue
+		}
+		if err := j.Forget(preview); err != nil {
+			rep.Logf(report.Error, preview, "Error updating journal: %v", err)
+		}
+	}
+	return result, nil
+}
+
+// pruneUnowned deletes the outputs that are neither in keep nor recorded by
+// a preview outside skip.
+func (j *Journal) pruneUnowned(outputs, keep []string, skip map[string]bool) ([]string, error) {
+	kept := make(map[string]bool, len(keep))
+	for _, path := range keep {
+		kept[key(path)] = true
+	}
+	var stale []string
+	for _, output := range outputs {
+		if !kept[key(j.OutputPath(output))] {
+			stale = append(stale, output)
+		}
+	}
+	if len(stale) == 0 {
+		return nil, nil
+	}
+	return j.Prune(stale, append(append([]string(nil), keep...), j.outputsExcept(skip)...))
+}
+
+// outputsExcept returns the paths of the outputs recorded for every preview
+// not in skip.
+func (j *Journal) outputsExcept(skip map[string]bool) []string {
+	var paths []string
+	for path, entry := range j.Entries() {
+		if skip[path] {
+			continue
+		}
+		for _, output := range entry.Outputs {
+			paths = append(paths, j.OutputPath(output))
+		}
+	}
+	return paths
+}
+
+// Entry returns the latest entry for path.
+func (j *Journal) Entry(path string) (Entry, bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	entry, ok := j.entries[key(path)]
+	return entry, ok
+}
+
+// refresh records the current size and modification time of an unchanged
+// preview.
+func (j *Journal) refresh(path string, entry Entry) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("error reading file: %v", err)
+	}
+	entry.Size = info.Size()
+	entry.ModTime = info.ModTime()
+	return j.append(entry)
+}
+
+// Prune deletes the Entry outputs that are not in keep, along with
+// directories left empty below the journal's directory, and returns the
+// paths it deleted. Outputs that are already gone are skipped.
+func (j *Journal) Prune(outputs, keep []string) ([]string, error) {
+	kept := make(map[string]bool, len(keep))
+	for _, path := range keep {
+		kept[key(path)] = true
+	}
+
+	root := filepath.Dir(j.path)
+	var deleted []string
+	for _, output := range outputs {
+		path := j.OutputPath(output)
+		if kept[key(path)] {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return deleted, fmt.Errorf("error removing %s: %v", path, err)
+		}
+		deleted = append(deleted, path)
+		removeEmptyDirs(filepath.Dir(path), root)
+	}
+	return deleted, nil
+}
+
+// removeEmptyDirs removes dir and its parents while they are empty, stopping
+// at root.
+func removeEmptyDirs(dir, root string) {
+	root = key(root)
+	for dir = key(dir); dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			return
+		}
+	}
+}
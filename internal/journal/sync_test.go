@@ -0,0 +1,172 @@
+package journal
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"lrprev-extract-go/pkg/report"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompare(t *testing.T) {
+	input := t.TempDir()
+	out := t.TempDir()
+	paths := make(map[string]string)
+	for _, name := range []string{"same", "touched", "rerendered", "deleted", "failed", "new"} {
+		paths[name] = filepath.Join(input, name+".lrprev")
+		writePreview(t, paths[name], "digest-"+name)
+	}
+
+	j, err := Open(out, "")
+	assert.NoError(t, err)
+	for _, name := range []string{"same", "touched", "rerendered", "deleted"} {
+		assert.NoError(t, j.Record(paths[name], nil, nil))
+	}
+	assert.NoError(t, j.Record(paths["failed"], nil, os.ErrPermission))
+	// Entries outside the compared directory are left alone
+	other := filepath.Join(t.TempDir(), "other.lrprev")
+	writePreview(t, other, "digest-other")
+	assert.NoError(t, j.Record(other, nil, nil))
+	assert.NoError(t, os.Remove(other))
+	assert.NoError(t, j.Close())
+
+	later := time.Now().Add(time.Hour)
+	assert.NoError(t, os.Chtimes(paths["touched"], later, later))
+	writePreview(t, paths["rerendered"], "digest-changed")
+	assert.NoError(t, os.Chtimes(paths["rerendered"], later, later))
+	assert.NoError(t, os.Remove(paths["deleted"]))
+
+	j, err = Open(out, "")
+	assert.NoError(t, err)
+	defer j.Close()
+	changes, err := j.Compare(input, []string{paths["failed"], paths["new"], paths["rerendered"], paths["same"], paths["touched"]})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{paths["failed"], paths["new"]}, changes.Added)
+	assert.Equal(t, []string{paths["rerendered"]}, changes.Updated)
+	assert.Equal(t, []string{paths["same"], paths["touched"]}, changes.Unchanged)
+	assert.Equal(t, []string{paths["deleted"]}, changes.Removed)
+
+	// The touched preview's entry was refreshed
+	assert.True(t, j.Done(paths["touched"]))
+
+	// Other settings re-extract everything
+	j2, err := Open(out, "levels=all")
+	assert.NoError(t, err)
+	defer j2.Close()
+	changes, err = j2.Compare(input, []string{paths["same"]})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{paths["same"]}, changes.Updated)
+}
+
+func TestPrune(t *testing.T) {
+	input := t.TempDir()
+	out := t.TempDir()
+	preview := filepath.Join(input, "a.lrprev")
+	writePreview(t, preview, "digest")
+
+	old := filepath.Join(out, "photos", "2024", "IMG_0001_160x120.jpg")
+	kept := filepath.Join(out, "photos", "2024", "IMG_0001.xmp")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(old), os.ModePerm))
+	for _, path := range []string{old, kept} {
+		assert.NoError(t, os.WriteFile(path, []byte("data"), 0644))
+	}
+
+	j, err := Open(out, "")
+	assert.NoError(t, err)
+	defer j.Close()
+	assert.NoError(t, j.Record(preview, []string{old, kept}, nil))
+	entry, ok := j.Entry(preview)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"photos/2024/IMG_0001_160x120.jpg", "photos/2024/IMG_0001.xmp"}, entry.Outputs)
+
+	deleted, err := j.Prune(entry.Outputs, []string{kept})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{old}, deleted)
+	assert.FileExists(t, kept)
+
+	// Emptied directories go too, but never the output directory itself
+	deleted, err = j.Prune(entry.Outputs, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{kept}, deleted)
+	assert.NoDirExists(t, filepath.Join(out, "photos"))
+	assert.DirExists(t, out)
+
+	assert.NoError(t, j.Forget(preview))
+	_, ok = j.Entry(preview)
+	assert.False(t, ok)
+}
+
+func TestRecord_FailureKeepsOutputs(t *testing.T) {
+	out := t.TempDir()
+	preview := filepath.Join(t.TempDir(), "a.lrprev")
+	writePreview(t, preview, "digest")
+
+	j, err := Open(out, "")
+	assert.NoError(t, err)
+	defer j.Close()
+	assert.NoError(t, j.Record(preview, []string{filepath.Join(out, "a.jpg")}, nil))
+	assert.NoError(t, j.Record(preview, nil, os.ErrPermission))
+
+	entry, _ := j.Entry(preview)
+	assert.Equal(t, StatusFailed, entry.Status)
+	assert.Equal(t, []string{"a.jpg"}, entry.Outputs)
+}
+
+// syncOptions extracts "<name>-<digest>.lrprev" to "<name>.jpg" in out,
+// like previews named after their image uuid and render digest.
+func syncOptions(out string) SyncOptions {
+	return SyncOptions{
+		Extract: func(file string) ([]string, error) {
+			name, _, _ := strings.Cut(filepath.Base(file), "-")
+			path := filepath.Join(out, name+".jpg")
+			return []string{path}, os.WriteFile(path, []byte(filepath.Base(file)), 0644)
+		},
+		Workers:  2,
+		Delete:   true,
+		Reporter: report.NewPlain(io.Discard),
+	}
+}
+
+func TestSync_RenamedPreview(t *testing.T) {
+	input := t.TempDir()
+	out := t.TempDir()
+	old := filepath.Join(input, "A-1.lrprev")
+	gone := filepath.Join(input, "B-1.lrprev")
+	writePreview(t, old, "1")
+	writePreview(t, gone, "1")
+
+	j, err := Open(out, "")
+	assert.NoError(t, err)
+	defer j.Close()
+	result, err := j.Sync(input, []string{old, gone}, syncOptions(out))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{old, gone}, result.Added)
+	assert.FileExists(t, filepath.Join(out, "A.jpg"))
+
+	// Lightroom re-rendered A under a new digest and dropped B
+	renamed := filepath.Join(input, "A-2.lrprev")
+	assert.NoError(t, os.Rename(old, renamed))
+	writePreview(t, renamed, "2")
+	assert.NoError(t, os.Remove(gone))
+
+	result, err = j.Sync(input, []string{renamed}, syncOptions(out))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{renamed}, result.Added)
+	assert.Equal(t, []string{old, gone}, result.Removed)
+	assert.Empty(t, result.Failed)
+	assert.Equal(t, []string{filepath.Join(out, "B.jpg")}, result.Deleted)
+
+	data, err := os.ReadFile(filepath.Join(out, "A.jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, "A-2.lrprev", string(data))
+	assert.NoFileExists(t, filepath.Join(out, "B.jpg"))
+	_, ok := j.Entry(old)
+	assert.False(t, ok)
+	entry, _ := j.Entry(renamed)
+	assert.Equal(t, []string{"A.jpg"}, entry.Outputs)
+}
@@ -0,0 +1,490 @@
+package jpegtran
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	markerSOF0 = 0xC0
+	markerSOF1 = 0xC1
+	markerDHT  = 0xC4
+	markerSOI  = 0xD8
+	markerEOI  = 0xD9
+	markerSOS  = 0xDA
+	markerDQT  = 0xDB
+	markerDRI  = 0xDD
+	markerRST0 = 0xD0
+	markerRST7 = 0xD7
+)
+
+// ErrUnsupported is returned for JPEGs that cannot be transformed losslessly
+// by this package, such as progressive or arithmetic coded files.
+var ErrUnsupported = errors.New("unsupported JPEG")
+
+// block holds the 64 quantized DCT coefficients of an 8x8 block in natural
+// (row-major) order.
+type block [64]int32
+
+type component struct {
+	id     byte
+	h, v   int
+	tq     byte
+	blocks []block
+	// bw and bh are the block grid dimensions, padded to whole MCUs.
+	bw, bh int
+}
+
+type huffman struct {
+	counts  [16]byte
+	symbols []byte
+	// Decoding tables from ITU T.81 F.2.2.3.
+	maxCode [17]int32
+	valPtr  [16]int32
+	minCode [16]int32
+}
+
+type decoder struct {
+	data          []byte
+	pos           int
+	width, height int
+	hmax, vmax    int
+	mcusX, mcusY  int
+	comps         []*component
+	quant         [4]*[64]uint16
+	dc, ac        [4]*huffman
+	restart       int
+	// other holds APPn and COM segments, which are copied to the output.
+	other [][]byte
+	frame bool
+
+	bits  uint32
+	nbits int
+}
+
+// zigzag maps zig-zag order to natural order.
+var zigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+func decode(data []byte) (*decoder, error) {
+	d := &decoder{data: data}
+	if len(data) < 2 || data[0] != 0xFF || data[1] != markerSOI {
+		return nil, fmt.Errorf("not a JPEG: missing SOI marker")
+	}
+	d.pos = 2
+
+	for {
+		marker, payload, err := d.segment()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case marker == markerEOI:
+			if !d.frame {
+				return nil, fmt.Errorf("invalid JPEG: no frame")
+			}
+			return d, nil
+		case marker == markerSOF0 || marker == markerSOF1:
+			err = d.parseSOF(payload)
+		case marker >= 0xC2 && marker <= 0xCF && marker != markerDHT && marker != 0xC8 && marker != 0xCC:
+			return nil, fmt.Errorf("%w: SOF marker 0x%02X", ErrUnsupported, marker)
+		case marker == 0xCC:
+			return nil, fmt.Errorf("%w: arithmetic coding", ErrUnsupported)
+		case marker == markerDHT:
+			err = d.parseDHT(payload)
+		case marker == markerDQT:
+			err = d.parseDQT(payload)
+		case marker == markerDRI:
+			if len(payload) != 2 {
+				return nil, fmt.Errorf("invalid JPEG: bad DRI length")
+			}
+			d.restart = int(payload[0])<<8 | int(payload[1])
+		case marker == markerSOS:
+			err = d.parseSOS(payload)
+		case marker >= 0xE0 && marker <= 0xEF || marker == 0xFE:
+			d.other = append(d.other, append([]byte{0xFF, marker, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}, payload...))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// segment reads the next marker segment, skipping any entropy coded bytes
+// left over from a scan.
+func (d *decoder) segment() (byte, []byte, error) {
+	var marker byte
+	for {
+		for d.pos < len(d.data) && d.data[d.pos] != 0xFF {
+			d.pos++
+		}
+		for d.pos < len(d.data) && d.data[d.pos] == 0xFF {
+			d.pos++
+		}
+		if d.pos >= len(d.data) {
+			// Treat a missing EOI as the end of the image.
+			return markerEOI, nil, nil
+		}
+		marker = d.data[d.pos]
+		d.pos++
+		if marker != 0 && (marker < markerRST0 || marker > markerRST7) {
+			break
+		}
+	}
+	if marker == markerEOI || marker == 0x01 {
+		return marker, nil, nil
+	}
+	if d.pos+2 > len(d.data) {
+		return 0, nil, fmt.Errorf("invalid JPEG: truncated segment")
+	}
+	n := int(d.data[d.pos])<<8 | int(d.data[d.pos+1])
+	if n < 2 || d.pos+n > len(d.data) {
+		return 0, nil, fmt.Errorf("invalid JPEG: bad segment length %d", n)
+	}
+	payload := d.data[d.pos+2 : d.pos+n]
+	d.pos += n
+	return marker, payload, nil
+}
+
+func (d *decoder) parseSOF(p []byte) error {
+	if d.frame {
+		return fmt.Errorf("invalid JPEG: multiple frames")
+	}
+	if len(p) < 6 {
+		return fmt.Errorf("invalid JPEG: short SOF")
+	}
+	if p[0] != 8 {
+		return fmt.Errorf("%w: %d-bit precision", ErrUnsupported, p[0])
+	}
+	d.height = int(p[1])<<8 | int(p[2])
+	d.width = int(p[3])<<8 | int(p[4])
+	n := int(p[5])
+	if d.width == 0 || d.height == 0 {
+		return fmt.Errorf("%w: image height defined by DNL", ErrUnsupported)
+	}
+	if n < 1 || n > 4 || len(p) != 6+3*n {
+		return fmt.Errorf("invalid JPEG: bad SOF component count")
+	}
+
+	d.hmax, d.vmax = 1, 1
+	for i := 0; i < n; i++ {
+		c := &component{id: p[6+3*i], h: int(p[7+3*i] >> 4), v: int(p[7+3*i] & 15), tq: p[8+3*i]}
+		if c.h < 1 || c.h > 4 || c.v < 1 || c.v > 4 || c.tq > 3 {
+			return fmt.Errorf("invalid JPEG: bad component parameters")
+		}
+		d.hmax, d.vmax = max(d.hmax, c.h), max(d.vmax, c.v)
+		d.comps = append(d.comps, c)
+	}
+
+	d.mcusX = (d.width + 8*d.hmax - 1) / (8 * d.hmax)
+	d.mcusY = (d.height + 8*d.vmax - 1) / (8 * d.vmax)
+	for _, c := range d.comps {
+		c.bw, c.bh = d.mcusX*c.h, d.mcusY*c.v
+		c.blocks = make([]block, c.bw*c.bh)
+	}
+	d.frame = true
+	return nil
+}
+
+func (d *decoder) parseDQT(p []byte) error {
+	for len(p) > 0 {
+		pq, tq := p[0]>>4, p[0]&15
+		if tq > 3 {
+			return fmt.Errorf("invalid JPEG: bad DQT table")
+		}
+		table := new([64]uint16)
+		if pq == 0 {
+			if len(p) < 65 {
+				return fmt.Errorf("invalid JPEG: short DQT")
+			}
+			for i := 0; i < 64; i++ {
+				table[zigzag[i]] = uint16(p[1+i])
+			}
+			p = p[65:]
+		} else {
+			if len(p) < 129 {
+				return fmt.Errorf("invalid JPEG: short DQT")
+			}
+			for i := 0; i < 64; i++ {
+				table[zigzag[i]] = uint16(p[1+2*i])<<8 | uint16(p[2+2*i])
+			}
+			p = p[129:]
+		}
+		d.quant[tq] = table
+	}
+	return nil
+}
+
+func (d *decoder) parseDHT(p []byte) error {
+	for len(p) > 0 {
+		if len(p) < 17 {
+			return fmt.Errorf("invalid JPEG: short DHT")
+		}
+		tc, th := p[0]>>4, p[0]&15
+		if tc > 1 || th > 3 {
+			return fmt.Errorf("invalid JPEG: bad DHT table")
+		}
+		h := &huffman{}
+		copy(h.counts[:], p[1:17])
+		total := 0
+		for _, c := range h.counts {
+			total += int(c)
+		}
+		if len(p) < 17+total {
+			return fmt.Errorf("invalid JPEG: short DHT")
+		}
+		h.symbols = append([]byte(nil), p[17:17+total]...)
+		h.build()
+		if tc == 0 {
+			d.dc[th] = h
+		} else {
+			d.ac[th] = h
+		}
+		p = p[17+total:]
+	}
+	return nil
+}
+
+func (h *huffman) build() {
+	code, k := int32(0), int32(0)
+	for l := 0; l < 16; l++ {
+		n := int32(h.counts[l])
+		h.valPtr[l] = k
+		h.minCode[l] = code
+		code += n
+		k += n
+		if n == 0 {
+			h.maxCode[l] = -1
+		} else {
+			h.maxCode[l] = code - 1
+		}
+		code <<= 1
+	}
+	h.maxCode[16] = 0x7FFFFFFF
+}
+
+func (d *decoder) parseSOS(p []byte) error {
+	if !d.frame {
+		return fmt.Errorf("invalid JPEG: SOS before SOF")
+	}
+	if len(p) < 1 {
+		return fmt.Errorf("invalid JPEG: short SOS")
+	}
+	n := int(p[0])
+	if n < 1 || n > 4 || len(p) != 4+2*n {
+		return fmt.Errorf("invalid JPEG: bad SOS length")
+	}
+	if p[1+2*n] != 0 || p[2+2*n] != 63 || p[3+2*n] != 0 {
+		return fmt.Errorf("%w: spectral selection", ErrUnsupported)
+	}
+
+	type scanComp struct {
+		c      *component
+		dc, ac *huffman
+		pred   int32
+	}
+	scan := make([]*scanComp, n)
+	for i := 0; i < n; i++ {
+		id, tables := p[1+2*i], p[2+2*i]
+		var c *component
+		for _, fc := range d.comps {
+			if fc.id == id {
+				c = fc
+			}
+		}
+		if c == nil {
+			return fmt.Errorf("invalid JPEG: unknown component %d in scan", id)
+		}
+		dc, ac := d.dc[tables>>4&3], d.ac[tables&3]
+		if dc == nil || ac == nil {
+			return fmt.Errorf("invalid JPEG: missing Huffman table")
+		}
+		scan[i] = &scanComp{c: c, dc: dc, ac: ac}
+	}
+
+	decodeBlock := func(sc *scanComp, b *block) error {
+		t, err := d.decodeHuffman(sc.dc)
+		if err != nil {
+			return err
+		}
+		diff, err := d.receiveExtend(t)
+		if err != nil {
+			return err
+		}
+		sc.pred += diff
+		b[0] = sc.pred
+
+		for k := 1; k < 64; k++ {
+			rs, err := d.decodeHuffman(sc.ac)
+			if err != nil {
+				return err
+			}
+			r, s := int(rs>>4), rs&15
+			if s == 0 {
+				if r != 15 {
+					break
+				}
+				k += 15
+				continue
+			}
+			k += r
+			if k > 63 {
+				return fmt.Errorf("invalid JPEG: coefficient index out of range")
+			}
+			v, err := d.receiveExtend(s)
+			if err != nil {
+				return err
+			}
+			b[zigzag[k]] = v
+		}
+		return nil
+	}
+
+	// A scan of one component covers only the blocks holding image data;
+	// interleaved scans cover whole MCUs.
+	var units int
+	if n == 1 {
+		c := scan[0].c
+		cw := (d.width*c.h + d.hmax - 1) / d.hmax
+		ch := (d.height*c.v + d.vmax - 1) / d.vmax
+		bw, bh := (cw+7)/8, (ch+7)/8
+		units = bw * bh
+		err := d.decodeUnits(units, func(i int) error {
+			return decodeBlock(scan[0], &c.blocks[(i/bw)*c.bw+i%bw])
+		}, func() {
+			scan[0].pred = 0
+		})
+		return err
+	}
+
+	units = d.mcusX * d.mcusY
+	return d.decodeUnits(units, func(i int) error {
+		mx, my := i%d.mcusX, i/d.mcusX
+		for _, sc := range scan {
+			c := sc.c
+			for y := 0; y < c.v; y++ {
+				for x := 0; x < c.h; x++ {
+					bx, by := mx*c.h+x, my*c.v+y
+					if err := decodeBlock(sc, &c.blocks[by*c.bw+bx]); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		return nil
+	}, func() {
+		for _, sc := range scan {
+			sc.pred = 0
+		}
+	})
+}
+
+// decodeUnits decodes the entropy coded segment that follows an SOS,
+// handling restart markers, and leaves pos at the next marker.
+func (d *decoder) decodeUnits(units int, unit func(int) error, reset func()) error {
+	d.bits, d.nbits = 0, 0
+	for i := 0; i < units; i++ {
+		if d.restart > 0 && i > 0 && i%d.restart == 0 {
+			if err := d.readRestart(); err != nil {
+				return err
+			}
+			reset()
+		}
+		if err := unit(i); err != nil {
+			return err
+		}
+	}
+	d.bits, d.nbits = 0, 0
+	return nil
+}
+
+func (d *decoder) readRestart() error {
+	d.bits, d.nbits = 0, 0
+	for d.pos+1 < len(d.data) {
+		if d.data[d.pos] == 0xFF && d.data[d.pos+1] >= markerRST0 && d.data[d.pos+1] <= markerRST7 {
+			d.pos += 2
+			return nil
+		}
+		if d.data[d.pos] == 0xFF && d.data[d.pos+1] != 0 && d.data[d.pos+1] != 0xFF {
+			break
+		}
+		d.pos++
+	}
+	return fmt.Errorf("invalid JPEG: missing restart marker")
+}
+
+func (d *decoder) readBit() (uint32, error) {
+	if d.nbits == 0 {
+		if d.pos >= len(d.data) {
+			return 0, fmt.Errorf("invalid JPEG: truncated entropy data")
+		}
+		b := d.data[d.pos]
+		if b == 0xFF {
+			if d.pos+1 >= len(d.data) {
+				return 0, fmt.Errorf("invalid JPEG: truncated entropy data")
+			}
+			switch next := d.data[d.pos+1]; {
+			case next == 0:
+				d.pos += 2
+			default:
+				// A marker inside the data: pad with ones, as libjpeg does.
+				b = 0xFF
+				d.bits, d.nbits = uint32(b), 8
+				return d.takeBit(), nil
+			}
+		} else {
+			d.pos++
+		}
+		d.bits, d.nbits = uint32(b), 8
+	}
+	return d.takeBit(), nil
+}
+
+func (d *decoder) takeBit() uint32 {
+	d.nbits--
+	return (d.bits >> uint(d.nbits)) & 1
+}
+
+func (d *decoder) decodeHuffman(h *huffman) (byte, error) {
+	code := int32(0)
+	for l := 0; l < 16; l++ {
+		bit, err := d.readBit()
+		if err != nil {
+			return 0, err
+		}
+		code = code<<1 | int32(bit)
+		if h.maxCode[l] >= 0 && code <= h.maxCode[l] {
+			return h.symbols[h.valPtr[l]+code-h.minCode[l]], nil
+		}
+	}
+	return 0, fmt.Errorf("invalid JPEG: bad Huffman code")
+}
+
+func (d *decoder) receiveExtend(s byte) (int32, error) {
+	if s == 0 {
+		return 0, nil
+	}
+	if s > 16 {
+		return 0, fmt.Errorf("invalid JPEG: bad coefficient size %d", s)
+	}
+	v := int32(0)
+	for i := byte(0); i < s; i++ {
+		bit, err := d.readBit()
+		if err != nil {
+			return 0, err
+		}
+		v = v<<1 | int32(bit)
+	}
+	if v < 1<<(s-1) {
+		v += -1<<s + 1
+	}
+	return v, nil
+}
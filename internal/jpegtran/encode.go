@@ -0,0 +1,295 @@
+package jpegtran
+
+import (
+	"bytes"
+)
+
+// The standard Huffman tables from ITU T.81 Annex K.3. They cover every
+// symbol of an 8-bit baseline JPEG, so coefficients reordered by a transform
+// can always be encoded.
+var (
+	stdDC = [2]huffmanSpec{
+		{
+			counts:  [16]byte{0, 1, 5, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0},
+			symbols: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+		},
+		{
+			counts:  [16]byte{0, 3, 1, 1, 1, 1, 1, 1, 1, 1, 1, 0, 0, 0, 0, 0},
+			symbols: []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11},
+		},
+	}
+	stdAC = [2]huffmanSpec{
+		{
+			counts: [16]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 125},
+			symbols: []byte{
+				0x01, 0x02, 0x03, 0x00, 0x04, 0x11, 0x05, 0x12,
+				0x21, 0x31, 0x41, 0x06, 0x13, 0x51, 0x61, 0x07,
+				0x22, 0x71, 0x14, 0x32, 0x81, 0x91, 0xa1, 0x08,
+				0x23, 0x42, 0xb1, 0xc1, 0x15, 0x52, 0xd1, 0xf0,
+				0x24, 0x33, 0x62, 0x72, 0x82, 0x09, 0x0a, 0x16,
+				0x17, 0x18, 0x19, 0x1a, 0x25, 0x26, 0x27, 0x28,
+				0x29, 0x2a, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39,
+				0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48, 0x49,
+				0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58, 0x59,
+				0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68, 0x69,
+				0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78, 0x79,
+				0x7a, 0x83, 0x84, 0x85, 0x86, 0x87, 0x88, 0x89,
+				0x8a, 0x92, 0x93, 0x94, 0x95, 0x96, 0x97, 0x98,
+				0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5, 0xa6, 0xa7,
+				0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4, 0xb5, 0xb6,
+				0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3, 0xc4, 0xc5,
+				0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2, 0xd3, 0xd4,
+				0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda, 0xe1, 0xe2,
+				0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9, 0xea,
+				0xf1, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+				0xf9, 0xfa,
+			},
+		},
+		{
+			counts: [16]byte{0, 2, 1, 2, 4, 4, 3, 4, 7, 5, 4, 4, 0, 1, 2, 119},
+			symbols: []byte{
+				0x00, 0x01, 0x02, 0x03, 0x11, 0x04, 0x05, 0x21,
+				0x31, 0x06, 0x12, 0x41, 0x51, 0x07, 0x61, 0x71,
+				0x13, 0x22, 0x32, 0x81, 0x08, 0x14, 0x42, 0x91,
+				0xa1, 0xb1, 0xc1, 0x09, 0x23, 0x33, 0x52, 0xf0,
+				0x15, 0x62, 0x72, 0xd1, 0x0a, 0x16, 0x24, 0x34,
+				0xe1, 0x25, 0xf1, 0x17, 0x18, 0x19, 0x1a, 0x26,
+				0x27, 0x28, 0x29, 0x2a, 0x35, 0x36, 0x37, 0x38,
+				0x39, 0x3a, 0x43, 0x44, 0x45, 0x46, 0x47, 0x48,
+				0x49, 0x4a, 0x53, 0x54, 0x55, 0x56, 0x57, 0x58,
+				0x59, 0x5a, 0x63, 0x64, 0x65, 0x66, 0x67, 0x68,
+				0x69, 0x6a, 0x73, 0x74, 0x75, 0x76, 0x77, 0x78,
+				0x79, 0x7a, 0x82, 0x83, 0x84, 0x85, 0x86, 0x87,
+				0x88, 0x89, 0x8a, 0x92, 0x93, 0x94, 0x95, 0x96,
+				0x97, 0x98, 0x99, 0x9a, 0xa2, 0xa3, 0xa4, 0xa5,
+				0xa6, 0xa7, 0xa8, 0xa9, 0xaa, 0xb2, 0xb3, 0xb4,
+				0xb5, 0xb6, 0xb7, 0xb8, 0xb9, 0xba, 0xc2, 0xc3,
+				0xc4, 0xc5, 0xc6, 0xc7, 0xc8, 0xc9, 0xca, 0xd2,
+				0xd3, 0xd4, 0xd5, 0xd6, 0xd7, 0xd8, 0xd9, 0xda,
+				0xe2, 0xe3, 0xe4, 0xe5, 0xe6, 0xe7, 0xe8, 0xe9,
+				0xea, 0xf2, 0xf3, 0xf4, 0xf5, 0xf6, 0xf7, 0xf8,
+				0xf9, 0xfa,
+			},
+		},
+	}
+)
+
+type huffmanSpec struct {
+	counts  [16]byte
+	symbols []byte
+}
+
+// code is a Huffman code of length bits.
+type code struct {
+	bits   uint32
+	length int
+}
+
+func (s huffmanSpec) codes() [256]code {
+	var codes [256]code
+	c, k := uint32(0), 0
+	for l := 0; l < 16; l++ {
+		for i := 0; i < int(s.counts[l]); i++ {
+			codes[s.symbols[k]] = code{bits: c, length: l + 1}
+			c++
+			k++
+		}
+		c <<= 1
+	}
+	return codes
+}
+
+type bitWriter struct {
+	buf   bytes.Buffer
+	bits  uint32
+	nbits int
+}
+
+func (w *bitWriter) write(bits uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.bits = w.bits<<1 | (bits>>uint(i))&1
+		w.nbits++
+		if w.nbits == 8 {
+			b := byte(w.bits)
+			w.buf.WriteByte(b)
+			if b == 0xFF {
+				w.buf.WriteByte(0)
+			}
+			w.bits, w.nbits = 0, 0
+		}
+	}
+}
+
+// flush pads the last byte with ones.
+func (w *bitWriter) flush() {
+	if w.nbits > 0 {
+		w.write(0xFF, 8-w.nbits)
+	}
+}
+
+// magnitude returns the size category of v and its low bits as coded in the
+// entropy data.
+func magnitude(v int32) (int, uint32) {
+	a := v
+	if a < 0 {
+		a = -a
+	}
+	size := 0
+	for a > 0 {
+		size++
+		a >>= 1
+	}
+	if v < 0 {
+		v += 1<<uint(size) - 1
+	}
+	return size, uint32(v) & (1<<uint(size) - 1)
+}
+
+func (d *decoder) encode() []byte {
+	var out bytes.Buffer
+	out.Write([]byte{0xFF, markerSOI})
+	for _, segment := range d.other {
+		out.Write(segment)
+	}
+
+	writeSegment := func(marker byte, payload []byte) {
+		out.Write([]byte{0xFF, marker, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)})
+		out.Write(payload)
+	}
+
+	// 16-bit quantization tables are not allowed in baseline JPEGs.
+	sofMarker := byte(markerSOF0)
+	for i, q := range d.quant {
+		if q == nil {
+			continue
+		}
+		var payload []byte
+		wide := false
+		for _, v := range q {
+			wide = wide || v > 255
+		}
+		if wide {
+			sofMarker = markerSOF1
+			payload = append(payload, 0x10|byte(i))
+			for k := 0; k < 64; k++ {
+				payload = append(payload, byte(q[zigzag[k]]>>8), byte(q[zigzag[k]]))
+			}
+		} else {
+			payload = append(payload, byte(i))
+			for k := 0; k < 64; k++ {
+				payload = append(payload, byte(q[zigzag[k]]))
+			}
+		}
+		writeSegment(markerDQT, payload)
+	}
+
+	sof := []byte{8, byte(d.height >> 8), byte(d.height), byte(d.width >> 8), byte(d.width), byte(len(d.comps))}
+	for _, c := range d.comps {
+		sof = append(sof, c.id, byte(c.h<<4|c.v), c.tq)
+	}
+	writeSegment(sofMarker, sof)
+
+	var dht []byte
+	for class, specs := range [][2]huffmanSpec{stdDC, stdAC} {
+		for i, spec := range specs {
+			dht = append(dht, byte(class<<4|i))
+			dht = append(dht, spec.counts[:]...)
+			dht = append(dht, spec.symbols...)
+		}
+	}
+	writeSegment(markerDHT, dht)
+
+	if d.restart > 0 {
+		writeSegment(markerDRI, []byte{byte(d.restart >> 8), byte(d.restart)})
+	}
+
+	// The first component uses the luminance tables, the others the
+	// chrominance tables.
+	table := func(i int) int {
+		if i == 0 {
+			return 0
+		}
+		return 1
+	}
+	sos := []byte{byte(len(d.comps))}
+	for i, c := range d.comps {
+		sos = append(sos, c.id, byte(table(i)<<4|table(i)))
+	}
+	sos = append(sos, 0, 63, 0)
+	writeSegment(markerSOS, sos)
+
+	dcCodes := [2][256]code{stdDC[0].codes(), stdDC[1].codes()}
+	acCodes := [2][256]code{stdAC[0].codes(), stdAC[1].codes()}
+	var w bitWriter
+	preds := make([]int32, len(d.comps))
+
+	encodeBlock := func(i int, b *block) {
+		dc, ac := &dcCodes[table(i)], &acCodes[table(i)]
+		size, bits := magnitude(b[0] - preds[i])
+		preds[i] = b[0]
+		w.write(dc[size].bits, dc[size].length)
+		w.write(bits, size)
+
+		run := 0
+		for k := 1; k < 64; k++ {
+			v := b[zigzag[k]]
+			if v == 0 {
+				run++
+				continue
+			}
+			for run > 15 {
+				w.write(ac[0xF0].bits, ac[0xF0].length)
+				run -= 16
+			}
+			size, bits := magnitude(v)
+			symbol := byte(run<<4 | size)
+			w.write(ac[symbol].bits, ac[symbol].length)
+			w.write(bits, size)
+			run = 0
+		}
+		if run > 0 {
+			w.write(ac[0x00].bits, ac[0x00].length)
+		}
+	}
+
+	// restart starts a new restart interval before every restart-th unit.
+	units := 0
+	restart := func() {
+		if d.restart > 0 && units > 0 && units%d.restart == 0 {
+			w.flush()
+			w.buf.Write([]byte{0xFF, byte(markerRST0 + (units/d.restart-1)%8)})
+			for i := range preds {
+				preds[i] = 0
+			}
+		}
+		units++
+	}
+
+	if len(d.comps) == 1 {
+		c := d.comps[0]
+		bw, bh := (d.width+7)/8, (d.height+7)/8
+		for by := 0; by < bh; by++ {
+			for bx := 0; bx < bw; bx++ {
+				restart()
+				encodeBlock(0, &c.blocks[by*c.bw+bx])
+			}
+		}
+	} else {
+		for my := 0; my < d.mcusY; my++ {
+			for mx := 0; mx < d.mcusX; mx++ {
+				restart()
+				for i, c := range d.comps {
+					for y := 0; y < c.v; y++ {
+						for x := 0; x < c.h; x++ {
+							encodeBlock(i, &c.blocks[(my*c.v+y)*c.bw+mx*c.h+x])
+						}
+					}
+				}
+			}
+		}
+	}
+	w.flush()
+	out.Write(w.buf.Bytes())
+	out.Write([]byte{0xFF, markerEOI})
+	return out.Bytes()
+}
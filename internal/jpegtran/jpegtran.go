@@ -0,0 +1,159 @@
+// Package jpegtran rotates and flips baseline JPEGs losslessly by rearranging
+// their DCT coefficients, in the manner of libjpeg's jpegtran.
+package jpegtran
+
+import (
+	"fmt"
+)
+
+// transform is applied in the order transpose, then horizontal and vertical
+// flips of the transposed image.
+type transform struct {
+	transpose bool
+	flipH     bool
+	flipV     bool
+}
+
+// transforms maps EXIF orientation values to the transform that makes the
+// image upright.
+var transforms = map[int]transform{
+	2: {flipH: true},
+	3: {flipH: true, flipV: true},
+	4: {flipV: true},
+	5: {transpose: true},
+	6: {transpose: true, flipH: true},
+	7: {transpose: true, flipH: true, flipV: true},
+	8: {transpose: true, flipV: true},
+}
+
+// Transform returns the JPEG rotated or flipped so that an image tagged with
+// the given EXIF orientation is upright. Orientation 1 returns the input
+// unchanged.
+//
+// As with jpegtran -trim, partial blocks at an edge that would move to the
+// top or left are dropped, so the output may be up to 15 pixels narrower or
+// shorter than the input. Progressive, arithmetic coded and 12-bit JPEGs
+// return an error wrapping ErrUnsupported.
+func Transform(data []byte, orientation int) ([]byte, error) {
+	if orientation == 1 {
+		return data, nil
+	}
+	t, ok := transforms[orientation]
+	if !ok {
+		return nil, fmt.Errorf("invalid orientation %d", orientation)
+	}
+
+	d, err := decode(data)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range d.comps {
+		if d.quant[c.tq] == nil {
+			return nil, fmt.Errorf("invalid JPEG: missing quantization table %d", c.tq)
+		}
+	}
+
+	out := d.apply(t)
+	if out.width == 0 || out.height == 0 {
+		return nil, fmt.Errorf("%w: image smaller than one MCU", ErrUnsupported)
+	}
+	return out.encode(), nil
+}
+
+// apply returns a decoder holding the transformed coefficients.
+func (d *decoder) apply(t transform) *decoder {
+	out := &decoder{
+		width:   d.width,
+		height:  d.height,
+		hmax:    d.hmax,
+		vmax:    d.vmax,
+		other:   d.other,
+		quant:   d.quant,
+		restart: d.restart,
+	}
+	if t.transpose {
+		out.width, out.height = d.height, d.width
+		out.hmax, out.vmax = d.vmax, d.hmax
+		for i, q := range d.quant {
+			if q != nil {
+				out.quant[i] = transposeTable(q)
+			}
+		}
+	}
+
+	// Partial MCUs cannot move to the leading edge.
+	if t.flipH {
+		out.width -= out.width % (8 * out.hmax)
+	}
+	if t.flipV {
+		out.height -= out.height % (8 * out.vmax)
+	}
+	out.mcusX = (out.width + 8*out.hmax - 1) / (8 * out.hmax)
+	out.mcusY = (out.height + 8*out.vmax - 1) / (8 * out.vmax)
+
+	for _, c := range d.comps {
+		oc := &component{id: c.id, h: c.h, v: c.v, tq: c.tq}
+		if t.transpose {
+			oc.h, oc.v = c.v, c.h
+		}
+		oc.bw, oc.bh = out.mcusX*oc.h, out.mcusY*oc.v
+		oc.blocks = make([]block, oc.bw*oc.bh)
+
+		// Blocks of image data in the output component; only these are
+		// mirrored, the padding beyond them stays empty.
+		cols := (out.width*oc.h + out.hmax - 1) / out.hmax
+		rows := (out.height*oc.v + out.vmax - 1) / out.vmax
+		cols, rows = (cols+7)/8, (rows+7)/8
+
+		for by := 0; by < rows; by++ {
+			for bx := 0; bx < cols; bx++ {
+				sx, sy := bx, by
+				if t.flipH {
+					sx = cols - 1 - bx
+				}
+				if t.flipV {
+					sy = rows - 1 - by
+				}
+				if t.transpose {
+					sx, sy = sy, sx
+				}
+				if sx >= c.bw || sy >= c.bh {
+					continue
+				}
+				src := &c.blocks[sy*c.bw+sx]
+				dst := &oc.blocks[by*oc.bw+bx]
+				transformBlock(dst, src, t)
+			}
+		}
+		out.comps = append(out.comps, oc)
+	}
+	return out
+}
+
+func transformBlock(dst, src *block, t transform) {
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			coef := src[v*8+u]
+			if t.transpose {
+				coef = src[u*8+v]
+			}
+			if t.flipH && u%2 == 1 {
+				coef = -coef
+			}
+			if t.flipV && v%2 == 1 {
+				coef = -coef
+			}
+			dst[v*8+u] = coef
+		}
+	}
+}
+
+func transposeTable(q *[64]uint16) *[64]uint16 {
+	out := new([64]uint16)
+	for v := 0; v < 8; v++ {
+		for u := 0; u < 8; u++ {
+			out[v*8+u] = q[u*8+v]
+		}
+	}
+	return out
+}
@@ -0,0 +1,168 @@
+package jpegtran
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeTestImage(t *testing.T, img image.Image) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}))
+	return buf.Bytes()
+}
+
+// pattern is asymmetric so every orientation produces a different image.
+func pattern(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 255 / w), G: uint8(y * 255 / h), B: uint8((x * y) % 256), A: 255})
+		}
+	}
+	return img
+}
+
+// source returns the input pixel shown at (x, y) of an image of size w x h
+// after the transform for orientation, per the EXIF definitions.
+func source(orientation, x, y, w, h int) (int, int) {
+	switch orientation {
+	case 2:
+		return w - 1 - x, y
+	case 3:
+		return w - 1 - x, h - 1 - y
+	case 4:
+		return x, h - 1 - y
+	case 5:
+		return y, x
+	case 6:
+		return y, h - 1 - x
+	case 7:
+		return w - 1 - y, h - 1 - x
+	case 8:
+		return w - 1 - y, x
+	}
+	return x, y
+}
+
+func maxDiff(a, b color.Color) int {
+	r1, g1, b1, _ := a.RGBA()
+	r2, g2, b2, _ := b.RGBA()
+	d := 0
+	for _, pair := range [][2]uint32{{r1, r2}, {g1, g2}, {b1, b2}} {
+		diff := int(pair[0]>>8) - int(pair[1]>>8)
+		if diff < 0 {
+			diff = -diff
+		}
+		d = max(d, diff)
+	}
+	return d
+}
+
+func TestTransform(t *testing.T) {
+	for _, img := range []image.Image{pattern(48, 32), image.NewGray(image.Rect(0, 0, 24, 40))} {
+		data := encodeTestImage(t, img)
+		original, err := jpeg.Decode(bytes.NewReader(data))
+		assert.NoError(t, err)
+		w, h := original.Bounds().Dx(), original.Bounds().Dy()
+
+		for orientation := 2; orientation <= 8; orientation++ {
+			out, err := Transform(data, orientation)
+			assert.NoError(t, err, "orientation %d", orientation)
+
+			rotated, err := jpeg.Decode(bytes.NewReader(out))
+			assert.NoError(t, err, "orientation %d", orientation)
+			if orientation >= 5 {
+				assert.Equal(t, image.Rect(0, 0, h, w), rotated.Bounds(), "orientation %d", orientation)
+			} else {
+				assert.Equal(t, image.Rect(0, 0, w, h), rotated.Bounds(), "orientation %d", orientation)
+			}
+
+			worst := 0
+			b := rotated.Bounds()
+			for y := 0; y < b.Dy(); y++ {
+				for x := 0; x < b.Dx(); x++ {
+					sx, sy := source(orientation, x, y, w, h)
+					worst = max(worst, maxDiff(rotated.At(x, y), original.At(sx, sy)))
+				}
+			}
+			// Only IDCT and colour conversion rounding may differ.
+			assert.LessOrEqual(t, worst, 4, "orientation %d", orientation)
+		}
+	}
+}
+
+func TestTransform_Trim(t *testing.T) {
+	data := encodeTestImage(t, pattern(50, 37))
+
+	out, err := Transform(data, 6)
+	assert.NoError(t, err)
+	config, err := jpeg.DecodeConfig(bytes.NewReader(out))
+	assert.NoError(t, err)
+	// The partial bottom MCU row moves to the left edge and is dropped.
+	assert.Equal(t, 32, config.Width)
+	assert.Equal(t, 50, config.Height)
+
+	out, err = Transform(data, 4)
+	assert.NoError(t, err)
+	config, err = jpeg.DecodeConfig(bytes.NewReader(out))
+	assert.NoError(t, err)
+	assert.Equal(t, 50, config.Width)
+	assert.Equal(t, 32, config.Height)
+}
+
+func TestTransform_Identity(t *testing.T) {
+	data := encodeTestImage(t, pattern(16, 16))
+	out, err := Transform(data, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, data, out)
+}
+
+func TestTransform_Errors(t *testing.T) {
+	data := encodeTestImage(t, pattern(16, 16))
+	_, err := Transform(data, 9)
+	assert.EqualError(t, err, "invalid orientation 9")
+
+	_, err = Transform([]byte("not a jpeg"), 6)
+	assert.EqualError(t, err, "not a JPEG: missing SOI marker")
+
+	progressive := []byte{0xFF, 0xD8, 0xFF, 0xC2, 0x00, 0x0B, 8, 0, 16, 0, 16, 1, 1, 0x11, 0}
+	_, err = Transform(progressive, 6)
+	assert.ErrorIs(t, err, ErrUnsupported)
+
+	_, err = Transform(encodeTestImage(t, pattern(8, 8)), 6)
+	assert.ErrorIs(t, err, ErrUnsupported)
+}
+
+func TestTransform_Restart(t *testing.T) {
+	data := encodeTestImage(t, pattern(48, 32))
+	d, err := decode(data)
+	assert.NoError(t, err)
+	d.restart = 1
+	restarted := d.encode()
+	assert.True(t, bytes.Contains(restarted, []byte{0xFF, markerRST0}))
+
+	out, err := Transform(restarted, 3)
+	assert.NoError(t, err)
+	assert.True(t, bytes.Contains(out, []byte{0xFF, markerDRI}))
+	back, err := Transform(out, 3)
+	assert.NoError(t, err)
+
+	a, err := jpeg.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	b, err := jpeg.Decode(bytes.NewReader(back))
+	assert.NoError(t, err)
+	assert.Equal(t, a.Bounds(), b.Bounds())
+	worst := 0
+	for y := 0; y < 32; y++ {
+		for x := 0; x < 48; x++ {
+			worst = max(worst, maxDiff(a.At(x, y), b.At(x, y)))
+		}
+	}
+	assert.LessOrEqual(t, worst, 4)
+}
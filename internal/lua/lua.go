@@ -0,0 +1,395 @@
+package lua
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Table is a Lua table literal. Keyed entries go to Fields, positional entries
+// to Array in order of appearance.
+type Table struct {
+	Fields map[string]interface{}
+	Array  []interface{}
+}
+
+func (t *Table) String(key string) string {
+	s, _ := t.Fields[key].(string)
+	return s
+}
+
+func (t *Table) Number(key string) float64 {
+	n, _ := t.Fields[key].(float64)
+	return n
+}
+
+func (t *Table) Int(key string) int {
+	return int(t.Number(key))
+}
+
+func (t *Table) Bool(key string) bool {
+	b, _ := t.Fields[key].(bool)
+	return b
+}
+
+func (t *Table) Table(key string) *Table {
+	child, _ := t.Fields[key].(*Table)
+	return child
+}
+
+// Parse reads a chunk of "name = value" assignments (or a single "return value")
+// as written by Lightroom and returns the assigned values by name. Values are
+// string, float64, bool, nil or *Table.
+func Parse(src string) (map[string]interface{}, error) {
+	p := &parser{src: src}
+	result := make(map[string]interface{})
+
+	for {
+		p.skipSpace()
+		if p.eof() {
+			return result, nil
+		}
+
+		name, err := p.identifier()
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipSpace()
+		if name == "return" {
+			value, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			result[name] = value
+			continue
+		}
+		if name == "local" {
+			continue
+		}
+		if !p.consume('=') {
+			return nil, p.errorf("expected '=' after %s", name)
+		}
+
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		result[name] = value
+	}
+}
+
+// ParseValue parses a single Lua value such as a table constructor.
+func ParseValue(src string) (interface{}, error) {
+	p := &parser{src: src}
+	value, err := p.value()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.eof() {
+		return nil, p.errorf("unexpected trailing data")
+	}
+	return value, nil
+}
+
+type parser struct {
+	src string
+	pos int
+}
+
+func (p *parser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *parser) peek() byte {
+	if p.eof() {
+		return 0
+	}
+	return p.src[p.pos]
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("lua: %s at offset %d", fmt.Sprintf(format, args...), p.pos)
+}
+
+func (p *parser) consume(c byte) bool {
+	p.skipSpace()
+	if p.peek() == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) skipSpace() {
+	for !p.eof() {
+		c := p.src[p.pos]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == 0:
+			p.pos++
+		case strings.HasPrefix(p.src[p.pos:], "--"):
+			p.pos += 2
+			if level, ok := p.longBracketLevel(); ok {
+				if _, err := p.longString(level); err != nil {
+					p.pos = len(p.src)
+				}
+				continue
+			}
+			for !p.eof() && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
+
+func (p *parser) identifier() (string, error) {
+	p.skipSpace()
+	start := p.pos
+	if !isIdentStart(p.peek()) {
+		return "", p.errorf("expected identifier")
+	}
+	for !p.eof() && isIdentPart(p.src[p.pos]) {
+		p.pos++
+	}
+	return p.src[start:p.pos], nil
+}
+
+func (p *parser) value() (interface{}, error) {
+	p.skipSpace()
+	c := p.peek()
+	switch {
+	case c == '{':
+		return p.table()
+	case c == '"' || c == '\'':
+		return p.quotedString()
+	case c == '[':
+		level, ok := p.longBracketLevel()
+		if !ok {
+			return nil, p.errorf("unexpected '['")
+		}
+		return p.longString(level)
+	case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return p.number()
+	case isIdentStart(c):
+		word, _ := p.identifier()
+		switch word {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "nil":
+			return nil, nil
+		}
+		return nil, p.errorf("unexpected identifier %s", word)
+	case p.eof():
+		return nil, p.errorf("unexpected end of input")
+	}
+	return nil, p.errorf("unexpected character %q", c)
+}
+
+func (p *parser) table() (*Table, error) {
+	p.pos++ // '{'
+	t := &Table{Fields: make(map[string]interface{})}
+
+	for {
+		if p.consume('}') {
+			return t, nil
+		}
+
+		var key string
+		var hasKey bool
+		start := p.pos
+
+		switch c := p.peek(); {
+		case c == '[':
+			if _, ok := p.longBracketLevel(); ok {
+				break
+			}
+			p.pos++
+			k, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			if !p.consume(']') {
+				return nil, p.errorf("expected ']'")
+			}
+			if !p.consume('=') {
+				return nil, p.errorf("expected '='")
+			}
+			key, hasKey = keyString(k), true
+		case isIdentStart(c):
+			name, _ := p.identifier()
+			if p.consume('=') {
+				key, hasKey = name, true
+			} else {
+				p.pos = start
+			}
+		}
+
+		value, err := p.value()
+		if err != nil {
+			return nil, err
+		}
+		if hasKey {
+			t.Fields[key] = value
+		} else {
+			t.Array = append(t.Array, value)
+		}
+
+		if !p.consume(',') && !p.consume(';') {
+			if p.consume('}') {
+				return t, nil
+			}
+			return nil, p.errorf("expected ',' or '}'")
+		}
+	}
+}
+
+func keyString(k interface{}) string {
+	switch v := k.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return fmt.Sprint(k)
+}
+
+func (p *parser) quotedString() (string, error) {
+	quote := p.src[p.pos]
+	p.pos++
+	var sb strings.Builder
+
+	for !p.eof() {
+		c := p.src[p.pos]
+		p.pos++
+		switch c {
+		case quote:
+			return sb.String(), nil
+		case '\n':
+			return "", p.errorf("unterminated string")
+		case '\\':
+			if p.eof() {
+				return "", p.errorf("unterminated string")
+			}
+			e := p.src[p.pos]
+			p.pos++
+			switch e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 't':
+				sb.WriteByte('\t')
+			case 'r':
+				sb.WriteByte('\r')
+			case 'a':
+				sb.WriteByte('\a')
+			case 'b':
+				sb.WriteByte('\b')
+			case 'f':
+				sb.WriteByte('\f')
+			case 'v':
+				sb.WriteByte('\v')
+			case '\n':
+				sb.WriteByte('\n')
+			default:
+				if e >= '0' && e <= '9' {
+					n := int(e - '0')
+					for i := 0; i < 2 && !p.eof() && p.peek() >= '0' && p.peek() <= '9'; i++ {
+						n = n*10 + int(p.src[p.pos]-'0')
+						p.pos++
+					}
+					if n > 255 {
+						return "", p.errorf("escape sequence too large")
+					}
+					sb.WriteByte(byte(n))
+				} else {
+					sb.WriteByte(e)
+				}
+			}
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// longBracketLevel reports whether a long bracket such as [[ or [==[ starts at
+// the current position, and its level.
+func (p *parser) longBracketLevel() (int, bool) {
+	if p.peek() != '[' {
+		return 0, false
+	}
+	i := p.pos + 1
+	for i < len(p.src) && p.src[i] == '=' {
+		i++
+	}
+	if i < len(p.src) && p.src[i] == '[' {
+		return i - p.pos - 1, true
+	}
+	return 0, false
+}
+
+func (p *parser) longString(level int) (string, error) {
+	p.pos += level + 2
+	closing := "]" + strings.Repeat("=", level) + "]"
+	end := strings.Index(p.src[p.pos:], closing)
+	if end < 0 {
+		return "", p.errorf("unterminated long string")
+	}
+	s := p.src[p.pos : p.pos+end]
+	p.pos += end + len(closing)
+	return strings.TrimPrefix(s, "\n"), nil
+}
+
+func (p *parser) number() (float64, error) {
+	start := p.pos
+	if p.peek() == '-' {
+		p.pos++
+		p.skipSpace()
+	}
+	digitsStart := p.pos
+	if strings.HasPrefix(p.src[p.pos:], "0x") || strings.HasPrefix(p.src[p.pos:], "0X") {
+		p.pos += 2
+		for !p.eof() && strings.IndexByte("0123456789abcdefABCDEF", p.src[p.pos]) >= 0 {
+			p.pos++
+		}
+		n, err := strconv.ParseInt(p.src[digitsStart+2:p.pos], 16, 64)
+		if err != nil {
+			return 0, p.errorf("invalid number %s", p.src[start:p.pos])
+		}
+		if p.src[start] == '-' {
+			n = -n
+		}
+		return float64(n), nil
+	}
+
+	for !p.eof() {
+		c := p.src[p.pos]
+		if (c >= '0' && c <= '9') || c == '.' || c == 'e' || c == 'E' ||
+			((c == '+' || c == '-') && (p.src[p.pos-1] == 'e' || p.src[p.pos-1] == 'E')) {
+			p.pos++
+			continue
+		}
+		break
+	}
+
+	n, err := strconv.ParseFloat(p.src[digitsStart:p.pos], 64)
+	if err != nil {
+		return 0, p.errorf("invalid number %s", p.src[start:p.pos])
+	}
+	if p.src[start] == '-' {
+		n = -n
+	}
+	return n, nil
+}
@@ -0,0 +1,85 @@
+package lua
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	src := `-- preview header
+pyramid = {
+	colorProfile = "AgColorProfileCode 1f",
+	croppedWidth = 6000,
+	fromProxy = false,
+	ratio = -1.5e1,
+	flags = 0x1F,
+	name = 'it\'s "quoted"\n',
+	note = [[long
+string]],
+	levels = {
+		{ height = 80, width = 120, },
+		{ height = 160; width = 240 },
+	},
+	["key with spaces"] = true,
+	[3] = "three",
+	missing = nil,
+}
+version = 3
+`
+
+	values, err := Parse(src)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(3), values["version"])
+
+	pyramid, ok := values["pyramid"].(*Table)
+	assert.True(t, ok)
+	assert.Equal(t, "AgColorProfileCode 1f", pyramid.String("colorProfile"))
+	assert.Equal(t, 6000, pyramid.Int("croppedWidth"))
+	assert.False(t, pyramid.Bool("fromProxy"))
+	assert.Equal(t, -15.0, pyramid.Number("ratio"))
+	assert.Equal(t, 31, pyramid.Int("flags"))
+	assert.Equal(t, "it's \"quoted\"\n", pyramid.String("name"))
+	assert.Equal(t, "long\nstring", pyramid.String("note"))
+	assert.True(t, pyramid.Bool("key with spaces"))
+	assert.Equal(t, "three", pyramid.String("3"))
+	assert.Nil(t, pyramid.Fields["missing"])
+
+	levels := pyramid.Table("levels")
+	assert.Len(t, levels.Array, 2)
+	second := levels.Array[1].(*Table)
+	assert.Equal(t, 240, second.Int("width"))
+	assert.Equal(t, 160, second.Int("height"))
+}
+
+func TestParse_Return(t *testing.T) {
+	values, err := Parse(`return { 1, 2, "three" }`)
+	assert.NoError(t, err)
+
+	table := values["return"].(*Table)
+	assert.Equal(t, []interface{}{1.0, 2.0, "three"}, table.Array)
+}
+
+func TestParseValue(t *testing.T) {
+	value, err := ParseValue(`{ Exposure2012 = 0.35, WhiteBalance = "As Shot" }`)
+	assert.NoError(t, err)
+
+	table := value.(*Table)
+	assert.Equal(t, 0.35, table.Number("Exposure2012"))
+	assert.Equal(t, "As Shot", table.String("WhiteBalance"))
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []string{
+		`pyramid = {`,
+		`pyramid = { a = 1 b = 2 }`,
+		`pyramid`,
+		`pyramid = "unterminated`,
+		`pyramid = @`,
+	}
+
+	for _, src := range tests {
+		_, err := Parse(src)
+		assert.Error(t, err, src)
+	}
+}
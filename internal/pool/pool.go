@@ -0,0 +1,62 @@
+package pool
+
+import "sync"
+
+type Result[T any] struct {
+	Index int
+	Item  T
+	Err   error
+}
+
+// Run calls fn for every item using at most workers goroutines. onResult is
+// invoked from a single goroutine in input order, whatever order the workers
+// finish in, so callers can report progress without extra locking and get the
+// same event stream as a serial run.
+func Run[T any](items []T, workers int, fn func(item T) error, onResult func(Result[T])) {
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(items) {
+		workers = len(items)
+	}
+
+	jobs := make(chan int)
+	results := make(chan Result[T], workers)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results <- Result[T]{Index: i, Item: items[i], Err: fn(items[i])}
+			}
+		}()
+	}
+
+	go func() {
+		for i := range items {
+			jobs <- i
+		}
+		close(jobs)
+		wg.Wait()
+		close(results)
+	}()
+
+	pending := make(map[int]Result[T])
+	next := 0
+	for r := range results {
+		pending[r.Index] = r
+		for {
+			ready, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+			if onResult != nil {
+				onResult(ready)
+			}
+		}
+	}
+}
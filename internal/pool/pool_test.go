@@ -0,0 +1,76 @@
+package pool
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun_OrderedResults(t *testing.T) {
+	var items []string
+	position := make(map[string]int)
+	for i := 0; i < 50; i++ {
+		items = append(items, fmt.Sprintf("file-%02d", i))
+		position[items[i]] = i
+	}
+
+	var running, maxRunning int32
+	fn := func(item string) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		// Finish later items first to shuffle completion order
+		time.Sleep(time.Duration(len(items)-position[item]) * 20 * time.Microsecond)
+		atomic.AddInt32(&running, -1)
+		if item == "file-13" {
+			return errors.New("boom")
+		}
+		return nil
+	}
+
+	var got []Result[string]
+	Run(items, 4, fn, func(r Result[string]) {
+		got = append(got, r)
+	})
+
+	assert.Len(t, got, len(items))
+	for i, r := range got {
+		assert.Equal(t, i, r.Index)
+		assert.Equal(t, items[i], r.Item)
+		if r.Item == "file-13" {
+			assert.EqualError(t, r.Err, "boom")
+		} else {
+			assert.NoError(t, r.Err)
+		}
+	}
+	assert.LessOrEqual(t, atomic.LoadInt32(&maxRunning), int32(4))
+}
+
+func TestRun_EdgeCases(t *testing.T) {
+	called := false
+	Run(nil, 8, func(string) error { return nil }, func(Result[string]) { called = true })
+	assert.False(t, called)
+
+	var got []string
+	Run([]string{"a", "b"}, 0, func(string) error { return nil }, func(r Result[string]) {
+		got = append(got, r.Item)
+	})
+	assert.Equal(t, []string{"a", "b"}, got)
+}
+
+func TestRun_Indices(t *testing.T) {
+	squares := make([]int, 5)
+	Run([]int{0, 1, 2, 3, 4}, 3, func(i int) error {
+		squares[i] = i * i
+		return nil
+	}, nil)
+	assert.Equal(t, []int{0, 1, 4, 9, 16}, squares)
+}
@@ -0,0 +1,317 @@
+// Package watch reports .lrprev files as Lightroom finishes writing them.
+package watch
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"lrprev-extract-go/internal/discover"
+	"lrprev-extract-go/pkg/lrprev"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultQuiet is how long a preview must go unchanged before it is handled.
+const DefaultQuiet = 2 * time.Second
+
+// maxAttempts bounds how often a preview that does not parse yet is checked
+// again before it is handed over anyway.
+const maxAttempts = 10
+
+type Options struct {
+	// Quiet is how long a file must go unchanged before it is handled;
+	// DefaultQuiet when zero.
+	Quiet time.Duration
+	// Include and Exclude filter previews as in discover.Find.
+	Include []string
+	Exclude []string
+	// Logf, when set, receives progress and watcher errors.
+	Logf func(format string, args ...interface{})
+}
+
+type pending struct {
+	timer    *time.Timer
+	attempts int
+}
+
+type watcher struct {
+	root    string
+	opts    Options
+	matcher *discover.Matcher
+	fs      *fsnotify.Watcher
+	ready   chan string
+	done    chan struct{}
+
+	mu      sync.Mutex
+	pending map[string]*pending
+
+	// queue holds settled paths for the handler goroutine, so the event
+	// loop keeps draining fsnotify while a preview is being handled. wake
+	// signals that queue is not empty.
+	queue  []string
+	queued map[string]bool
+	wake   chan struct{}
+}
+
+// Watch watches root and its subdirectories, including ones created later,
+// and calls handle for every .lrprev file that is created or rewritten, once
+// it has been quiet for opts.Quiet and parses as a preview. handle is called
+// from one goroutine at a time, apart from the one watching for events. Watch
+// returns when ctx is done and the running call to handle, if any, is over.
+func Watch(ctx context.Context, root string, opts Options, handle func(path string)) error {
+	if opts.Quiet <= 0 {
+		opts.Quiet = DefaultQuiet
+	}
+	if opts.Logf == nil {
+		opts.Logf = func(string, ...interface{}) {}
+	}
+	matcher, err := discover.NewMatcher(root, discover.Options{Include: opts.Include, Exclude: opts.Exclude})
+	if err != nil {
+		return err
+	}
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("error starting watcher: %v", err)
+	}
+	defer fsw.Close()
+
+	w := &watcher{
+		root:    root,
+		opts:    opts,
+		matcher: matcher,
+		fs:      fsw,
+		ready:   make(chan string),
+		done:    make(chan struct{}),
+		pending: make(map[string]*pending),
+		queued:  make(map[string]bool),
+		wake:    make(chan struct{}, 1),
+	}
+	var worker sync.WaitGroup
+	defer func() {
+		close(w.done)
+		worker.Wait()
+	}()
+	if err := w.addTree(root, false); err != nil {
+		return err
+	}
+	defer w.stopTimers()
+
+	worker.Add(1)
+	go func() {
+		defer worker.Done()
+		w.work(handle)
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-fsw.Events:
+			if !ok {
+				return nil
+			}
+			w.event(event)
+		case err, ok := <-fsw.Errors:
+			if !ok {
+				return nil
+			}
+			opts.Logf("Watcher error: %v", err)
+		case path := <-w.ready:
+			w.enqueue(path)
+		}
+	}
+}
+
+func (w *watcher) enqueue(path string) {
+	w.mu.Lock()
+	if !w.queued[path] {
+		w.queued[path] = true
+		w.queue = append(w.queue, path)
+	}
+	w.mu.Unlock()
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (w *watcher) dequeue() (string, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.queue) == 0 {
+		return "", false
+	}
+	path := w.queue[0]
+	w.queue = w.queue[1:]
+	delete(w.queued, path)
+	return path, true
+}
+
+// work checks and hands over queued paths until the watcher is done.
+func (w *watcher) work(handle func(path string)) {
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.wake:
+		}
+		for path, ok := w.dequeue(); ok; path, ok = w.dequeue() {
+			select {
+			case <-w.done:
+				return
+			default:
+			}
+			if w.complete(path) {
+				handle(path)
+			}
+		}
+	}
+}
+
+func (w *watcher) event(event fsnotify.Event) {
+	switch {
+	case event.Has(fsnotify.Create):
+		info, err := os.Stat(event.Name)
+		if err != nil {
+			return
+		}
+		if info.IsDir() {
+			// Files may land in a new directory before it is watched.
+			if err := w.addTree(event.Name, true); err != nil {
+				w.opts.Logf("Error watching %s: %v", event.Name, err)
+			}
+			return
+		}
+		w.schedule(event.Name, true)
+	case event.Has(fsnotify.Write):
+		w.schedule(event.Name, true)
+	case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+		w.cancel(event.Name)
+	}
+}
+
+// addTree watches dir and the directories below it that are not excluded.
+// With schedule set, the previews already inside are scheduled as well.
+func (w *watcher) addTree(dir string, schedule bool) error {
+	return filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			if schedule {
+				w.schedule(path, true)
+			}
+			return nil
+		}
+		if !w.matcher.Dir(path) {
+			return filepath.SkipDir
+		}
+		if err := w.fs.Add(path); err != nil {
+			return fmt.Errorf("error watching %s: %v", path, err)
+		}
+		return nil
+	})
+}
+
+// schedule (re)starts the quiet period of path. A write resets the count of
+// attempts; a retry after a failed parse does not.
+func (w *watcher) schedule(path string, written bool) {
+	if !w.matcher.File(path) {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	p, ok := w.pending[path]
+	if !ok {
+		p = &pending{}
+		w.pending[path] = p
+	}
+	if written {
+		p.attempts = 0
+	}
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.timer = time.AfterFunc(w.opts.Quiet, func() {
+		select {
+		case w.ready <- path:
+		case <-w.done:
+		}
+	})
+}
+
+func (w *watcher) cancel(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if p, ok := w.pending[path]; ok {
+		p.timer.Stop()
+		delete(w.pending, path)
+	}
+}
+
+// complete reports whether path is ready to be handled. A preview that does
+// not parse yet is checked again after another quiet period, up to
+// maxAttempts times, after which it is handed over so the error is reported.
+func (w *watcher) complete(path string) bool {
+	w.mu.Lock()
+	p, ok := w.pending[path]
+	w.mu.Unlock()
+	if !ok {
+		return false
+	}
+
+	if err := checkPreview(path); err != nil {
+		if os.IsNotExist(err) {
+			w.cancel(path)
+			return false
+		}
+		w.mu.Lock()
+		p.attempts++
+		retry := p.attempts < maxAttempts
+		w.mu.Unlock()
+		if retry {
+			w.schedule(path, false)
+			return false
+		}
+		w.opts.Logf("Preview %s is still incomplete: %v", path, err)
+	}
+
+	// A write seen while path was queued is covered by this handling.
+	w.mu.Lock()
+	p.timer.Stop()
+	delete(w.pending, path)
+	w.mu.Unlock()
+	return true
+}
+
+// checkPreview reports an error unless path is a complete preview: its
+// sections parse and it has at least one level.
+func checkPreview(path string) error {
+	preview, err := lrprev.OpenFile(path)
+	if err != nil {
+		return err
+	}
+	defer preview.Close()
+	if _, ok := preview.Largest(); !ok {
+		return fmt.Errorf("no level sections")
+	}
+	return nil
+}
+
+func (w *watcher) stopTimers() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for path, p := range w.pending {
+		p.timer.Stop()
+		delete(w.pending, path)
+	}
+}
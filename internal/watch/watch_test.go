@@ -0,0 +1,204 @@
+package watch
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"lrprev-extract-go/pkg/lrprev"
+	"lrprev-extract-go/pkg/output"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const quiet = 50 * time.Millisecond
+
+func previewBytes(t *testing.T) []byte {
+	t.Helper()
+	return previewWithDigest(t, "")
+}
+
+func previewWithDigest(t *testing.T, digest string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	assert.NoError(t, lrprev.WriteSection(&buf, "header", []byte(`pyramid = { uuid = "UUID", digest = "`+digest+`" }`), 0))
+	assert.NoError(t, lrprev.WriteSection(&buf, "level_1", []byte{0xFF, 0xD8, 0xFF, 0xD9}, 0))
+	return buf.Bytes()
+}
+
+// start runs Watch on root and returns the channel of handled paths.
+func start(t *testing.T, root string, opts Options) <-chan string {
+	t.Helper()
+	return startWith(t, root, opts, func(string) {})
+}
+
+// startWith is start with handle called on each path before it is sent.
+func startWith(t *testing.T, root string, opts Options, handle func(path string)) <-chan string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	handled := make(chan string, 10)
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- Watch(ctx, root, opts, func(path string) {
+			handle(path)
+			handled <- path
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		assert.NoError(t, <-stopped)
+	})
+	// Give the watcher time to register root.
+	time.Sleep(quiet)
+	return handled
+}
+
+func next(t *testing.T, handled <-chan string) string {
+	t.Helper()
+	select {
+	case path := <-handled:
+		return path
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a preview")
+		return ""
+	}
+}
+
+func assertIdle(t *testing.T, handled <-chan string) {
+	t.Helper()
+	select {
+	case path := <-handled:
+		t.Fatalf("unexpected preview %s", path)
+	case <-time.After(5 * quiet):
+	}
+}
+
+func TestWatch_NewPreview(t *testing.T) {
+	root := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(root, "A"), 0755))
+	handled := start(t, root, Options{Quiet: quiet, Exclude: []string{"Trash"}})
+
+	path := filepath.Join(root, "A", "a.lrprev")
+	assert.NoError(t, os.WriteFile(path, previewBytes(t), 0644))
+	assert.Equal(t, path, next(t, handled))
+
+	// Other files and excluded directories are ignored
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "A", "previews.db"), []byte("db"), 0644))
+	assert.NoError(t, os.MkdirAll(filepath.Join(root, "Trash"), 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(root, "Trash", "t.lrprev"), previewBytes(t), 0644))
+	assertIdle(t, handled)
+}
+
+func TestWatch_NewDirectory(t *testing.T) {
+	root := t.TempDir()
+	handled := start(t, root, Options{Quiet: quiet})
+
+	// The preview may be written before the new directories are watched.
+	path := filepath.Join(root, "B", "B9F0", "b.lrprev")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	assert.NoError(t, os.WriteFile(path, previewBytes(t), 0644))
+	assert.Equal(t, path, next(t, handled))
+	assertIdle(t, handled)
+}
+
+func TestWatch_HalfWritten(t *testing.T) {
+	root := t.TempDir()
+	handled := start(t, root, Options{Quiet: quiet})
+
+	data := previewBytes(t)
+	path := filepath.Join(root, "c.lrprev")
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	defer f.Close()
+
+	// A file that stops part way through is not handed over while it does
+	// not parse.
+	_, err = f.Write(data[:len(data)/2])
+	assert.NoError(t, err)
+	assertIdle(t, handled)
+
+	_, err = f.Write(data[len(data)/2:])
+	assert.NoError(t, err)
+	assert.Equal(t, path, next(t, handled))
+}
+
+func TestWatch_Removed(t *testing.T) {
+	root := t.TempDir()
+	handled := start(t, root, Options{Quiet: 200 * time.Millisecond})
+
+	path := filepath.Join(root, "d.lrprev")
+	assert.NoError(t, os.WriteFile(path, previewBytes(t), 0644))
+	assert.NoError(t, os.Remove(path))
+	select {
+	case path := <-handled:
+		t.Fatalf("unexpected preview %s", path)
+	case <-time.After(time.Second):
+	}
+}
+
+func TestWatch_EventsWhileHandling(t *testing.T) {
+	root := t.TempDir()
+	first := filepath.Join(root, "a.lrprev")
+	release := make(chan struct{})
+	handled := startWith(t, root, Options{Quiet: 4 * quiet}, func(path string) {
+		if path == first {
+			<-release
+		}
+	})
+
+	assert.NoError(t, os.WriteFile(first, previewBytes(t), 0644))
+	time.Sleep(6 * quiet)
+	// The first preview is being handled; the second settles meanwhile, in
+	// a directory the watcher has to pick up first.
+	second := filepath.Join(root, "B", "b.lrprev")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(second), 0755))
+	assert.NoError(t, os.WriteFile(second, previewBytes(t), 0644))
+	time.Sleep(8 * quiet)
+
+	close(release)
+	assert.Equal(t, first, next(t, handled))
+	select {
+	case path := <-handled:
+		assert.Equal(t, second, path)
+	case <-time.After(2 * quiet):
+		t.Fatal("second preview was not settled while the first was handled")
+	}
+}
+
+func TestWatch_RewrittenPreview(t *testing.T) {
+	for _, policy := range output.Policies {
+		t.Run(policy, func(t *testing.T) {
+			root := t.TempDir()
+			out := t.TempDir()
+			writer, err := output.NewWriter(policy)
+			assert.NoError(t, err)
+			jpeg := filepath.Join(out, "UUID.jpg")
+			// As the watch command does: a re-rendered preview replaces its output
+			handled := startWith(t, root, Options{Quiet: quiet}, func(path string) {
+				writer.Release(path)
+				data, err := os.ReadFile(path)
+				assert.NoError(t, err)
+				_, err = writer.WriteFile(jpeg, path, data)
+				assert.NoError(t, err)
+			})
+
+			path := filepath.Join(root, "a.lrprev")
+			assert.NoError(t, os.WriteFile(path, previewWithDigest(t, "1"), 0644))
+			assert.Equal(t, path, next(t, handled))
+			assert.NoError(t, os.WriteFile(path, previewWithDigest(t, "2"), 0644))
+			assert.Equal(t, path, next(t, handled))
+
+			data, err := os.ReadFile(jpeg)
+			assert.NoError(t, err)
+			assert.Equal(t, previewWithDigest(t, "2"), data)
+			assert.Equal(t, []string{jpeg}, writer.Written(path))
+			assert.Empty(t, writer.Conflicts())
+			entries, err := os.ReadDir(out)
+			assert.NoError(t, err)
+			assert.Len(t, entries, 1)
+		})
+	}
+}
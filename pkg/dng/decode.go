@@ -0,0 +1,385 @@
+package dng
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math"
+)
+
+// xyzRGB converts linear sRGB (D65) to XYZ.
+var xyzRGB = [3][3]float64{
+	{0.412453, 0.357580, 0.180423},
+	{0.212671, 0.715160, 0.072169},
+	{0.019334, 0.119193, 0.950227},
+}
+
+// block is a tile or strip of the raw image.
+type block struct {
+	x, y          int
+	width, height int
+	offset, count int64
+}
+
+// Decode renders the full resolution image to 16-bit sRGB. It applies the
+// linearisation table, black and white levels, the as-shot white balance,
+// the camera colour matrix, the baseline exposure and the default crop, but
+// none of the catalog's develop settings, so the result is flatter than
+// Lightroom's own rendering.
+func (f *File) Decode() (*image.RGBA64, error) {
+	raw, err := f.raw()
+	if err != nil {
+		return nil, err
+	}
+	if photometric := raw.uint(tagPhotometric, 0); photometric != photometricLinearRaw {
+		return nil, fmt.Errorf("unsupported photometric interpretation %d: only linear DNGs can be decoded", photometric)
+	}
+	if samples := raw.uint(tagSamplesPerPixel, 1); samples != 3 {
+		return nil, fmt.Errorf("unsupported samples per pixel %d", samples)
+	}
+	compression := raw.uint(tagCompression, compressionNone)
+	bits := int(raw.uint(tagBitsPerSample, 8))
+	switch {
+	case compression == compressionLossyJPEG:
+	case compression == compressionNone && (bits == 8 || bits == 16):
+	default:
+		return nil, fmt.Errorf("unsupported compression %d with %d bits per sample", compression, bits)
+	}
+
+	width, height := raw.Width(), raw.Height()
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid image size %dx%d", width, height)
+	}
+	blocks, err := raw.blocks(width, height)
+	if err != nil {
+		return nil, err
+	}
+
+	dev, err := raw.develop(bits)
+	if err != nil {
+		return nil, err
+	}
+	crop := raw.crop(width, height)
+	img := image.NewRGBA64(image.Rect(0, 0, crop.Dx(), crop.Dy()))
+	set := func(x, y int, r, g, b uint16) {
+		if !(image.Point{x, y}).In(crop) {
+			return
+		}
+		img.SetRGBA64(x-crop.Min.X, y-crop.Min.Y, dev.pixel(r, g, b))
+	}
+
+	for _, b := range blocks {
+		data := io.NewSectionReader(f.r, b.offset, b.count)
+		if compression == compressionLossyJPEG {
+			err = decodeJPEGBlock(data, b, set)
+		} else {
+			err = decodeRawBlock(data, b, bits, f.order, set)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error decoding block at %d,%d: %v", b.x, b.y, err)
+		}
+	}
+	return img, nil
+}
+
+// Size returns the dimensions of the image Decode returns, before any
+// orientation is applied.
+func (f *File) Size() (int, int, error) {
+	raw, err := f.raw()
+	if err != nil {
+		return 0, 0, err
+	}
+	crop := raw.crop(raw.Width(), raw.Height())
+	return crop.Dx(), crop.Dy(), nil
+}
+
+// blocks lists the tiles of the image, or its strips when it is not tiled.
+func (d *IFD) blocks(width, height int) ([]block, error) {
+	offsetTag, countTag := uint16(tagTileOffsets), uint16(tagTileByteCounts)
+	bw, bh := int(d.uint(tagTileWidth, 0)), int(d.uint(tagTileLength, 0))
+	if !d.has(tagTileOffsets) {
+		offsetTag, countTag = tagStripOffsets, tagStripByteCounts
+		bw, bh = width, int(d.uint(tagRowsPerStrip, uint64(height)))
+	}
+	if bw <= 0 || bh <= 0 {
+		return nil, fmt.Errorf("invalid tile size %dx%d", bw, bh)
+	}
+
+	offsets, err := d.uints(offsetTag)
+	if err != nil {
+		return nil, err
+	}
+	counts, err := d.uints(countTag)
+	if err != nil {
+		return nil, err
+	}
+	across, down := (width+bw-1)/bw, (height+bh-1)/bh
+	if len(offsets) < across*down || len(counts) < across*down {
+		return nil, fmt.Errorf("image has %d blocks, expected %d", min(len(offsets), len(counts)), across*down)
+	}
+
+	blocks := make([]block, 0, across*down)
+	for i := 0; i < across*down; i++ {
+		b := block{x: i % across * bw, y: i / across * bh, width: bw, height: bh, offset: int64(offsets[i]), count: int64(counts[i])}
+		if b.offset+b.count > d.f.size {
+			return nil, fmt.Errorf("block %d extends past the end of the file", i)
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+func decodeJPEGBlock(data io.Reader, b block, set func(x, y int, r, g, b uint16)) error {
+	m, err := jpeg.Decode(data)
+	if err != nil {
+		return err
+	}
+	bounds := m.Bounds()
+	ycc, isYCbCr := m.(*image.YCbCr)
+	for y := 0; y < min(b.height, bounds.Dy()); y++ {
+		for x := 0; x < min(b.width, bounds.Dx()); x++ {
+			var r, g, bl uint8
+			if isYCbCr {
+				c := ycc.YCbCrAt(bounds.Min.X+x, bounds.Min.Y+y)
+				r, g, bl = color.YCbCrToRGB(c.Y, c.Cb, c.Cr)
+			} else {
+				c := color.RGBAModel.Convert(m.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.RGBA)
+				r, g, bl = c.R, c.G, c.B
+			}
+			set(b.x+x, b.y+y, uint16(r), uint16(g), uint16(bl))
+		}
+	}
+	return nil
+}
+
+func decodeRawBlock(data io.Reader, b block, bits int, order binary.ByteOrder, set func(x, y int, r, g, b uint16)) error {
+	bytesPerSample := bits / 8
+	row := make([]byte, b.width*3*bytesPerSample)
+	sample := func(i int) uint16 {
+		if bytesPerSample == 1 {
+			return uint16(row[i])
+		}
+		return order.Uint16(row[i*2:])
+	}
+	for y := 0; y < b.height; y++ {
+		if _, err := io.ReadFull(data, row); err != nil {
+			if y > 0 && (err == io.EOF || err == io.ErrUnexpectedEOF) {
+				// The last strip holds only the rows left in the image.
+				return nil
+			}
+			return err
+		}
+		for x := 0; x < b.width; x++ {
+			set(b.x+x, b.y+y, sample(x*3), sample(x*3+1), sample(x*3+2))
+		}
+	}
+	return nil
+}
+
+// crop returns the default crop within the active area.
+func (d *IFD) crop(width, height int) image.Rectangle {
+	bounds := image.Rect(0, 0, width, height)
+	if area, err := d.values(tagActiveArea); err == nil && len(area) == 4 {
+		bounds = image.Rect(int(area[1]), int(area[0]), int(area[3]), int(area[2])).Intersect(bounds)
+	}
+	origin, err1 := d.values(tagDefaultCropOrigin)
+	size, err2 := d.values(tagDefaultCropSize)
+	if err1 != nil || err2 != nil || len(origin) != 2 || len(size) != 2 {
+		return bounds
+	}
+	x, y := bounds.Min.X+int(math.Round(origin[0])), bounds.Min.Y+int(math.Round(origin[1]))
+	crop := image.Rect(x, y, x+int(math.Round(size[0])), y+int(math.Round(size[1]))).Intersect(bounds)
+	if crop.Empty() {
+		return bounds
+	}
+	return crop
+}
+
+// develop holds the per pixel conversion from raw samples to sRGB.
+type develop struct {
+	linear []float64
+	black  [3]float64
+	scale  [3]float64
+	matrix [3][3]float64
+	gamma  []uint16
+}
+
+func (d *IFD) develop(bits int) (*develop, error) {
+	dev := &develop{}
+
+	white := float64(uint64(1)<<bits - 1)
+	if table, err := d.values(tagLinearizationTable); err == nil && len(table) > 0 {
+		dev.linear = table
+		white = 65535
+	}
+	whites := [3]float64{white, white, white}
+	if values, err := d.values(tagWhiteLevel); err == nil {
+		spread(values, &whites)
+	}
+	if values, err := d.values(tagBlackLevel); err == nil {
+		spread(values, &dev.black)
+	}
+	for c := range dev.scale {
+		if whites[c] <= dev.black[c] {
+			return nil, fmt.Errorf("invalid white level %g for black level %g", whites[c], dev.black[c])
+		}
+		dev.scale[c] = 1 / (whites[c] - dev.black[c])
+	}
+
+	// Colour tags describe the camera rather than one image and live in IFD0.
+	ifd0 := d.f.IFDs[0]
+	rgbCam, err := ifd0.rgbCam()
+	if err != nil {
+		return nil, err
+	}
+	neutral := [3]float64{1, 1, 1}
+	if values, err := ifd0.values(tagAsShotNeutral); err == nil && len(values) == 3 && values[0] > 0 && values[1] > 0 && values[2] > 0 {
+		copy(neutral[:], values)
+	}
+	exposure := 1.0
+	if values, err := ifd0.values(tagBaselineExposure); err == nil && len(values) == 1 {
+		exposure = math.Exp2(values[0])
+	}
+	for i := range dev.matrix {
+		for j := range dev.matrix[i] {
+			dev.matrix[i][j] = rgbCam[i][j] / neutral[j] * exposure
+		}
+	}
+
+	dev.gamma = make([]uint16, 65536)
+	for i := range dev.gamma {
+		dev.gamma[i] = uint16(math.Round(srgb(float64(i)/65535) * 65535))
+	}
+	return dev, nil
+}
+
+// spread copies one value, or one per sample, into levels.
+func spread(values []float64, levels *[3]float64) {
+	switch len(values) {
+	case 1:
+		*levels = [3]float64{values[0], values[0], values[0]}
+	case 3:
+		copy(levels[:], values)
+	}
+}
+
+// rgbCam returns the matrix from white balanced camera values to linear
+// sRGB, preferring the colour matrix calibrated for D65.
+func (d *IFD) rgbCam() ([3][3]float64, error) {
+	identity := [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+	matrixTag := uint16(tagColorMatrix1)
+	if d.has(tagColorMatrix2) && (d.uint(tagCalibrationIllum2, 0) == illuminantD65 || d.uint(tagCalibrationIllum1, 0) != illuminantD65) {
+		matrixTag = tagColorMatrix2
+	}
+	values, err := d.values(matrixTag)
+	if err != nil || len(values) != 9 {
+		return identity, nil
+	}
+
+	// Map sRGB to camera space, normalised so white stays white, then invert.
+	var camRGB [3][3]float64
+	for i := 0; i < 3; i++ {
+		var sum float64
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				camRGB[i][j] += values[i*3+k] * xyzRGB[k][j]
+			}
+			sum += camRGB[i][j]
+		}
+		if sum == 0 {
+			return identity, fmt.Errorf("invalid colour matrix")
+		}
+		for j := 0; j < 3; j++ {
+			camRGB[i][j] /= sum
+		}
+	}
+	inverse, ok := invert(camRGB)
+	if !ok {
+		return identity, fmt.Errorf("invalid colour matrix")
+	}
+	return inverse, nil
+}
+
+func invert(m [3][3]float64) ([3][3]float64, bool) {
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	if math.Abs(det) < 1e-12 {
+		return m, false
+	}
+	var inv [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			a, b := (j+1)%3, (j+2)%3
+			c, d := (i+1)%3, (i+2)%3
+			inv[i][j] = (m[a][c]*m[b][d] - m[a][d]*m[b][c]) / det
+		}
+	}
+	return inv, true
+}
+
+func (dev *develop) pixel(r, g, b uint16) color.RGBA64 {
+	cam := [3]float64{float64(r), float64(g), float64(b)}
+	for c := range cam {
+		if dev.linear != nil {
+			cam[c] = dev.linear[min(int(cam[c]), len(dev.linear)-1)]
+		}
+		cam[c] = (cam[c] - dev.black[c]) * dev.scale[c]
+	}
+
+	var out [3]uint16
+	for i := range out {
+		v := dev.matrix[i][0]*cam[0] + dev.matrix[i][1]*cam[1] + dev.matrix[i][2]*cam[2]
+		out[i] = dev.gamma[int(math.Round(math.Max(0, math.Min(1, v))*65535))]
+	}
+	return color.RGBA64{R: out[0], G: out[1], B: out[2], A: 0xFFFF}
+}
+
+func srgb(v float64) float64 {
+	if v <= 0.0031308 {
+		return v * 12.92
+	}
+	return 1.055*math.Pow(v, 1/2.4) - 0.055
+}
+
+// Orient returns img transformed so that an image with the given EXIF
+// orientation is upright.
+func Orient(img *image.RGBA64, orientation int) *image.RGBA64 {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	out := image.NewRGBA64(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			out.SetRGBA64(x, y, img.RGBA64At(bounds.Min.X+sx, bounds.Min.Y+sy))
+		}
+	}
+	return out
+}
@@ -0,0 +1,152 @@
+package dng
+
+import (
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lossyDNG is a 16x8 linear DNG made of two lossy JPEG tiles, with a
+// linearisation table mapping 8-bit samples to 16 bits.
+func lossyDNG(t *testing.T, left, right color.Color, extra ...entry) []byte {
+	b := newBuilder(binary.LittleEndian)
+	leftTile := jpegOf(t, 8, 8, left)
+	rightTile := jpegOf(t, 8, 8, right)
+	leftOffset, rightOffset := b.blob(leftTile), b.blob(rightTile)
+
+	table := make([]int64, 256)
+	for i := range table {
+		table[i] = int64(i) * 257
+	}
+	raw := b.ifd(0,
+		long(tagNewSubFileType, 0), long(tagImageWidth, 16), long(tagImageLength, 8),
+		short(tagBitsPerSample, 8, 8, 8), short(tagCompression, compressionLossyJPEG),
+		short(tagPhotometric, photometricLinearRaw), short(tagSamplesPerPixel, 3),
+		long(tagTileWidth, 8), long(tagTileLength, 8),
+		long(tagTileOffsets, leftOffset, rightOffset),
+		long(tagTileByteCounts, int64(len(leftTile)), int64(len(rightTile))),
+		short(tagLinearizationTable, table...), long(tagWhiteLevel, 65535))
+	ifd0 := b.ifd(0, append([]entry{long(tagNewSubFileType, 1), long(tagSubIFDs, raw)}, extra...)...)
+	return b.bytes(ifd0)
+}
+
+// sRGB16 converts a linear value to a 16-bit sRGB sample.
+func sRGB16(linear float64) float64 {
+	return srgb(linear) * 65535
+}
+
+func TestDecode(t *testing.T) {
+	f := open(t, lossyDNG(t, color.Gray{Y: 128}, color.RGBA{R: 200, G: 50, B: 50, A: 255}))
+	img, err := f.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 16, 8), img.Bounds())
+
+	const delta = 0.02 * 65535
+	left := img.RGBA64At(2, 2)
+	assert.InDelta(t, sRGB16(128.0/255), float64(left.R), delta)
+	assert.InDelta(t, float64(left.R), float64(left.G), delta)
+	assert.InDelta(t, float64(left.R), float64(left.B), delta)
+	right := img.RGBA64At(12, 5)
+	assert.InDelta(t, sRGB16(200.0/255), float64(right.R), delta)
+	assert.InDelta(t, sRGB16(50.0/255), float64(right.G), delta)
+	assert.Equal(t, uint16(0xFFFF), right.A)
+}
+
+func TestDecode_Develop(t *testing.T) {
+	// The inverse of the sRGB to XYZ matrix, so the camera is sRGB.
+	xyzToSRGB := srational(tagColorMatrix2,
+		32406, 10000, -15372, 10000, -4986, 10000,
+		-9689, 10000, 18758, 10000, 415, 10000,
+		557, 10000, -2040, 10000, 10570, 10000)
+	colour := color.RGBA{R: 200, G: 50, B: 50, A: 255}
+	plain, err := open(t, lossyDNG(t, colour, colour)).Decode()
+	assert.NoError(t, err)
+	matrix, err := open(t, lossyDNG(t, colour, colour, xyzToSRGB, short(tagCalibrationIllum2, illuminantD65))).Decode()
+	assert.NoError(t, err)
+	const delta = 0.01 * 65535
+	assert.InDelta(t, float64(plain.RGBA64At(3, 3).R), float64(matrix.RGBA64At(3, 3).R), delta)
+	assert.InDelta(t, float64(plain.RGBA64At(3, 3).G), float64(matrix.RGBA64At(3, 3).G), delta)
+
+	// A neutral of 0.5, 1, 0.5 turns 64, 128, 64 into grey, one stop
+	// brighter with a baseline exposure of 1.
+	greenish := color.RGBA{R: 64, G: 128, B: 64, A: 255}
+	balanced, err := open(t, lossyDNG(t, greenish, greenish,
+		srational(tagAsShotNeutral, 1, 2, 1, 1, 1, 2), srational(tagBaselineExposure, 1, 1))).Decode()
+	assert.NoError(t, err)
+	c := balanced.RGBA64At(4, 4)
+	assert.InDelta(t, sRGB16(2*128.0/255), float64(c.G), 0.02*65535)
+	assert.InDelta(t, float64(c.G), float64(c.R), 0.02*65535)
+	assert.InDelta(t, float64(c.G), float64(c.B), 0.02*65535)
+}
+
+func TestDecode_Crop(t *testing.T) {
+	b := newBuilder(binary.LittleEndian)
+	pixels := make([]byte, 4*3*3*2)
+	for i := 0; i < len(pixels); i += 2 {
+		binary.LittleEndian.PutUint16(pixels[i:], uint16(i*100))
+	}
+	offset := b.blob(pixels)
+	ifd0 := b.ifd(0,
+		long(tagNewSubFileType, 0), long(tagImageWidth, 4), long(tagImageLength, 3),
+		short(tagBitsPerSample, 16, 16, 16), short(tagCompression, 1),
+		short(tagPhotometric, photometricLinearRaw), short(tagSamplesPerPixel, 3),
+		long(tagRowsPerStrip, 2), long(tagStripOffsets, offset, offset+4*2*3*2),
+		long(tagStripByteCounts, 4*2*3*2, 4*1*3*2),
+		long(tagDefaultCropOrigin, 1, 1), long(tagDefaultCropSize, 2, 2))
+	f := open(t, b.bytes(ifd0))
+	width, height, err := f.Size()
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 2}, []int{width, height})
+	img, err := f.Decode()
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 2, 2), img.Bounds())
+	// Pixel 1,1 of the source starts at sample 15, byte 30.
+	assert.InDelta(t, sRGB16(3000.0/65535), float64(img.RGBA64At(0, 0).R), 2)
+	// Pixel 2,2 is in the second strip.
+	assert.InDelta(t, sRGB16(6000.0/65535), float64(img.RGBA64At(1, 1).R), 2)
+}
+
+func TestDecode_Unsupported(t *testing.T) {
+	b := newBuilder(binary.LittleEndian)
+	ifd0 := b.ifd(0,
+		long(tagNewSubFileType, 0), long(tagImageWidth, 4), long(tagImageLength, 2),
+		short(tagPhotometric, 32803), short(tagSamplesPerPixel, 1))
+	_, err := open(t, b.bytes(ifd0)).Decode()
+	assert.ErrorContains(t, err, "unsupported photometric interpretation 32803")
+}
+
+func TestOrient(t *testing.T) {
+	// A 3x2 image numbered in reading order.
+	img := image.NewRGBA64(image.Rect(0, 0, 3, 2))
+	for i := 0; i < 6; i++ {
+		img.SetRGBA64(i%3, i/3, color.RGBA64{R: uint16(i + 1), A: 0xFFFF})
+	}
+	rows := func(m *image.RGBA64) [][]uint16 {
+		var out [][]uint16
+		for y := 0; y < m.Bounds().Dy(); y++ {
+			var row []uint16
+			for x := 0; x < m.Bounds().Dx(); x++ {
+				row = append(row, m.RGBA64At(x, y).R)
+			}
+			out = append(out, row)
+		}
+		return out
+	}
+
+	tests := map[int][][]uint16{
+		1: {{1, 2, 3}, {4, 5, 6}},
+		2: {{3, 2, 1}, {6, 5, 4}},
+		3: {{6, 5, 4}, {3, 2, 1}},
+		4: {{4, 5, 6}, {1, 2, 3}},
+		5: {{1, 4}, {2, 5}, {3, 6}},
+		6: {{4, 1}, {5, 2}, {6, 3}},
+		7: {{6, 3}, {5, 2}, {4, 1}},
+		8: {{3, 6}, {2, 5}, {1, 4}},
+	}
+	for orientation, want := range tests {
+		assert.Equal(t, want, rows(Orient(img, orientation)), "orientation %d", orientation)
+	}
+}
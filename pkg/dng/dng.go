@@ -0,0 +1,372 @@
+// Package dng reads the lossy DNG files Lightroom stores as Smart Previews.
+// It can return the embedded JPEG preview without decoding anything, or
+// decode the lossy compressed image to an sRGB image.
+//
+//	f, err := dng.OpenFile("A1B2C3D4-....dng")
+//	if err != nil { ... }
+//	defer f.Close()
+//	preview, err := f.Preview()
+//	img, err := f.Decode()
+package dng
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// TIFF tags used by the reader.
+const (
+	tagNewSubFileType     = 254
+	tagImageWidth         = 256
+	tagImageLength        = 257
+	tagBitsPerSample      = 258
+	tagCompression        = 259
+	tagPhotometric        = 262
+	tagStripOffsets       = 273
+	tagOrientation        = 274
+	tagSamplesPerPixel    = 277
+	tagRowsPerStrip       = 278
+	tagStripByteCounts    = 279
+	tagTileWidth          = 322
+	tagTileLength         = 323
+	tagTileOffsets        = 324
+	tagTileByteCounts     = 325
+	tagSubIFDs            = 330
+	tagJPEGInterchange    = 513
+	tagJPEGInterchangeLen = 514
+	tagLinearizationTable = 50712
+	tagBlackLevel         = 50714
+	tagWhiteLevel         = 50717
+	tagDefaultCropOrigin  = 50719
+	tagDefaultCropSize    = 50720
+	tagColorMatrix1       = 50721
+	tagColorMatrix2       = 50722
+	tagAsShotNeutral      = 50728
+	tagBaselineExposure   = 50730
+	tagCalibrationIllum1  = 50778
+	tagCalibrationIllum2  = 50779
+	tagActiveArea         = 50829
+)
+
+const (
+	illuminantD65          = 21
+	compressionNone        = 1
+	compressionOldJPEG     = 6
+	compressionJPEG        = 7
+	compressionLossyJPEG   = 34892
+	photometricRGB         = 2
+	photometricYCbCr       = 6
+	photometricLinearRaw   = 34892
+	reducedResolutionImage = 1
+
+	maxIFDs       = 64
+	maxIFDEntries = 4096
+)
+
+// TIFF field types and their sizes in bytes.
+var typeSizes = map[uint16]int64{
+	1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8, 13: 4,
+}
+
+var ErrNoPreview = errors.New("no embedded JPEG preview")
+
+type File struct {
+	r      io.ReaderAt
+	size   int64
+	order  binary.ByteOrder
+	closer io.Closer
+	// IFDs holds every image file directory, the main chain and the SubIFDs
+	// of each, starting with IFD0.
+	IFDs []*IFD
+}
+
+type field struct {
+	typ    uint16
+	count  int64
+	offset int64
+}
+
+// IFD is one image of the file, such as the raw data or a preview.
+type IFD struct {
+	f      *File
+	fields map[uint16]field
+}
+
+func OpenFile(path string) (*File, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	f, err := Open(file, info.Size())
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	f.closer = file
+	return f, nil
+}
+
+// Open parses the TIFF structure of a DNG read from r.
+func Open(r io.ReaderAt, size int64) (*File, error) {
+	var header [8]byte
+	if _, err := r.ReadAt(header[:], 0); err != nil {
+		return nil, fmt.Errorf("error reading TIFF header: %v", err)
+	}
+
+	f := &File{r: r, size: size}
+	switch string(header[:2]) {
+	case "II":
+		f.order = binary.LittleEndian
+	case "MM":
+		f.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("not a DNG: invalid TIFF byte order")
+	}
+	if f.order.Uint16(header[2:]) != 42 {
+		return nil, fmt.Errorf("not a DNG: invalid TIFF magic")
+	}
+
+	seen := make(map[int64]bool)
+	queue := []int64{int64(f.order.Uint32(header[4:]))}
+	for len(queue) > 0 && len(f.IFDs) < maxIFDs {
+		offset := queue[0]
+		queue = queue[1:]
+		if offset == 0 || seen[offset] {
+			continue
+		}
+		seen[offset] = true
+
+		ifd, next, err := f.readIFD(offset)
+		if err != nil {
+			if len(f.IFDs) == 0 {
+				return nil, err
+			}
+			continue
+		}
+		f.IFDs = append(f.IFDs, ifd)
+		if subs, err := ifd.uints(tagSubIFDs); err == nil {
+			for _, sub := range subs {
+				queue = append(queue, int64(sub))
+			}
+		}
+		queue = append(queue, next)
+	}
+	if len(f.IFDs) == 0 {
+		return nil, fmt.Errorf("not a DNG: no image file directories")
+	}
+	return f, nil
+}
+
+func (f *File) Close() error {
+	if f.closer == nil {
+		return nil
+	}
+	return f.closer.Close()
+}
+
+func (f *File) readIFD(offset int64) (*IFD, int64, error) {
+	var count [2]byte
+	if _, err := f.r.ReadAt(count[:], offset); err != nil {
+		return nil, 0, fmt.Errorf("error reading IFD at %d: %v", offset, err)
+	}
+	n := int64(f.order.Uint16(count[:]))
+	if n > maxIFDEntries {
+		return nil, 0, fmt.Errorf("invalid IFD at %d: %d entries", offset, n)
+	}
+
+	buf := make([]byte, n*12+4)
+	if _, err := f.r.ReadAt(buf, offset+2); err != nil {
+		return nil, 0, fmt.Errorf("error reading IFD at %d: %v", offset, err)
+	}
+
+	ifd := &IFD{f: f, fields: make(map[uint16]field, n)}
+	for i := int64(0); i < n; i++ {
+		entry := buf[i*12 : i*12+12]
+		tag := f.order.Uint16(entry)
+		fd := field{typ: f.order.Uint16(entry[2:]), count: int64(f.order.Uint32(entry[4:]))}
+		size, ok := typeSizes[fd.typ]
+		if !ok {
+			continue
+		}
+		if size*fd.count <= 4 {
+			fd.offset = offset + 2 + i*12 + 8
+		} else {
+			fd.offset = int64(f.order.Uint32(entry[8:]))
+		}
+		if fd.offset+size*fd.count > f.size {
+			continue
+		}
+		ifd.fields[tag] = fd
+	}
+	return ifd, int64(f.order.Uint32(buf[n*12:])), nil
+}
+
+func (d *IFD) has(tag uint16) bool {
+	_, ok := d.fields[tag]
+	return ok
+}
+
+// values reads a numeric field as float64s, dividing rationals out.
+func (d *IFD) values(tag uint16) ([]float64, error) {
+	fd, ok := d.fields[tag]
+	if !ok {
+		return nil, fmt.Errorf("missing tag %d", tag)
+	}
+	size := typeSizes[fd.typ]
+	buf := make([]byte, size*fd.count)
+	if _, err := d.f.r.ReadAt(buf, fd.offset); err != nil {
+		return nil, fmt.Errorf("error reading tag %d: %v", tag, err)
+	}
+
+	order := d.f.order
+	values := make([]float64, fd.count)
+	for i := range values {
+		b := buf[int64(i)*size:]
+		switch fd.typ {
+		case 1, 7:
+			values[i] = float64(b[0])
+		case 6:
+			values[i] = float64(int8(b[0]))
+		case 3:
+			values[i] = float64(order.Uint16(b))
+		case 8:
+			values[i] = float64(int16(order.Uint16(b)))
+		case 4, 13:
+			values[i] = float64(order.Uint32(b))
+		case 9:
+			values[i] = float64(int32(order.Uint32(b)))
+		case 5:
+			values[i] = ratio(float64(order.Uint32(b)), float64(order.Uint32(b[4:])))
+		case 10:
+			values[i] = ratio(float64(int32(order.Uint32(b))), float64(int32(order.Uint32(b[4:]))))
+		case 11:
+			values[i] = float64(math.Float32frombits(order.Uint32(b)))
+		case 12:
+			values[i] = math.Float64frombits(order.Uint64(b))
+		default:
+			return nil, fmt.Errorf("tag %d is not numeric", tag)
+		}
+	}
+	return values, nil
+}
+
+func ratio(num, den float64) float64 {
+	if den == 0 {
+		return 0
+	}
+	return num / den
+}
+
+func (d *IFD) uints(tag uint16) ([]uint64, error) {
+	values, err := d.values(tag)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]uint64, len(values))
+	for i, v := range values {
+		if v < 0 {
+			return nil, fmt.Errorf("tag %d has a negative value", tag)
+		}
+		out[i] = uint64(v)
+	}
+	return out, nil
+}
+
+// uint returns the first value of a field, or def when it is missing.
+func (d *IFD) uint(tag uint16, def uint64) uint64 {
+	values, err := d.uints(tag)
+	if err != nil || len(values) == 0 {
+		return def
+	}
+	return values[0]
+}
+
+func (d *IFD) Width() int {
+	return int(d.uint(tagImageWidth, 0))
+}
+
+func (d *IFD) Height() int {
+	return int(d.uint(tagImageLength, 0))
+}
+
+// Orientation returns the TIFF orientation of the image, which uses the
+// same values as EXIF, or 1 when it is missing or invalid.
+func (f *File) Orientation() int {
+	o := f.IFDs[0].uint(tagOrientation, 1)
+	if o < 1 || o > 8 {
+		return 1
+	}
+	return int(o)
+}
+
+// Preview returns the largest JPEG preview embedded in the file.
+func (f *File) Preview() (*io.SectionReader, error) {
+	var best *io.SectionReader
+	var bestPixels int
+	for _, ifd := range f.IFDs {
+		data, ok := ifd.jpeg()
+		if !ok {
+			continue
+		}
+		if pixels := ifd.Width() * ifd.Height(); best == nil || pixels > bestPixels {
+			best, bestPixels = data, pixels
+		}
+	}
+	if best == nil {
+		return nil, ErrNoPreview
+	}
+	return best, nil
+}
+
+// jpeg returns the JPEG stream of a reduced resolution preview IFD.
+func (d *IFD) jpeg() (*io.SectionReader, bool) {
+	if d.uint(tagNewSubFileType, 0)&reducedResolutionImage == 0 {
+		return nil, false
+	}
+
+	var offset, length uint64
+	switch compression := d.uint(tagCompression, 0); {
+	case d.has(tagJPEGInterchange):
+		offset, length = d.uint(tagJPEGInterchange, 0), d.uint(tagJPEGInterchangeLen, 0)
+	case compression == compressionJPEG || compression == compressionOldJPEG:
+		if photometric := d.uint(tagPhotometric, 0); photometric != photometricYCbCr && photometric != photometricRGB {
+			return nil, false
+		}
+		offsets, err := d.uints(tagStripOffsets)
+		if err != nil || len(offsets) != 1 {
+			return nil, false
+		}
+		offset, length = offsets[0], d.uint(tagStripByteCounts, 0)
+	default:
+		return nil, false
+	}
+
+	if length < 2 || offset+length > uint64(d.f.size) {
+		return nil, false
+	}
+	data := io.NewSectionReader(d.f.r, int64(offset), int64(length))
+	var soi [2]byte
+	if _, err := data.ReadAt(soi[:], 0); err != nil || soi != [2]byte{0xFF, 0xD8} {
+		return nil, false
+	}
+	return data, true
+}
+
+// raw returns the full resolution image IFD.
+func (f *File) raw() (*IFD, error) {
+	for _, ifd := range f.IFDs {
+		if ifd.uint(tagNewSubFileType, 0) == 0 && ifd.has(tagImageWidth) {
+			return ifd, nil
+		}
+	}
+	return nil, fmt.Errorf("no full resolution image found")
+}
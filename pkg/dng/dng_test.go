@@ -0,0 +1,191 @@
+package dng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// entry is a test IFD entry. Rational values are given as numerator and
+// denominator pairs.
+type entry struct {
+	tag, typ uint16
+	values   []int64
+}
+
+func short(tag uint16, values ...int64) entry { return entry{tag, 3, values} }
+func long(tag uint16, values ...int64) entry  { return entry{tag, 4, values} }
+func srational(tag uint16, values ...int64) entry {
+	return entry{tag, 10, values}
+}
+
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// builder lays out a TIFF: the header, then data blobs and IFDs in the
+// order they are added.
+type builder struct {
+	order byteOrder
+	buf   []byte
+}
+
+func newBuilder(order byteOrder) *builder {
+	b := &builder{order: order}
+	if order == binary.BigEndian {
+		b.buf = append(b.buf, 'M', 'M')
+	} else {
+		b.buf = append(b.buf, 'I', 'I')
+	}
+	b.buf = order.AppendUint16(b.buf, 42)
+	b.buf = order.AppendUint32(b.buf, 0)
+	return b
+}
+
+func (b *builder) blob(data []byte) int64 {
+	if len(b.buf)%2 == 1 {
+		b.buf = append(b.buf, 0)
+	}
+	offset := int64(len(b.buf))
+	b.buf = append(b.buf, data...)
+	return offset
+}
+
+func (b *builder) encode(e entry) []byte {
+	var out []byte
+	switch e.typ {
+	case 3:
+		for _, v := range e.values {
+			out = b.order.AppendUint16(out, uint16(v))
+		}
+	default:
+		for _, v := range e.values {
+			out = b.order.AppendUint32(out, uint32(v))
+		}
+	}
+	return out
+}
+
+func (b *builder) ifd(next int64, entries ...entry) int64 {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].tag < entries[j].tag })
+	values := make([][]byte, len(entries))
+	for i, e := range entries {
+		values[i] = b.encode(e)
+		if len(values[i]) > 4 {
+			offset := b.blob(values[i])
+			values[i] = b.order.AppendUint32(nil, uint32(offset))
+		}
+	}
+
+	offset := b.blob(nil)
+	b.buf = b.order.AppendUint16(b.buf, uint16(len(entries)))
+	for i, e := range entries {
+		count := len(e.values)
+		if e.typ == 5 || e.typ == 10 {
+			count /= 2
+		}
+		b.buf = b.order.AppendUint16(b.buf, e.tag)
+		b.buf = b.order.AppendUint16(b.buf, e.typ)
+		b.buf = b.order.AppendUint32(b.buf, uint32(count))
+		b.buf = append(b.buf, values[i]...)
+		b.buf = append(b.buf, make([]byte, 4-len(values[i]))...)
+	}
+	b.buf = b.order.AppendUint32(b.buf, uint32(next))
+	return offset
+}
+
+func (b *builder) bytes(ifd0 int64) []byte {
+	b.order.PutUint32(b.buf[4:], uint32(ifd0))
+	return b.buf
+}
+
+func open(t *testing.T, data []byte) *File {
+	t.Helper()
+	f, err := Open(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+	return f
+}
+
+func jpegOf(t *testing.T, width, height int, c color.Color) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}))
+	return buf.Bytes()
+}
+
+// previewDNG has a small uncompressed thumbnail in IFD0 and two JPEG
+// previews in SubIFDs.
+func previewDNG(t *testing.T, order byteOrder) ([]byte, []byte) {
+	b := newBuilder(order)
+	small := jpegOf(t, 16, 8, color.Gray{Y: 10})
+	large := jpegOf(t, 64, 32, color.Gray{Y: 200})
+
+	smallOffset := b.blob(small)
+	largeOffset := b.blob(large)
+	thumbOffset := b.blob(make([]byte, 4*2*3))
+	sub1 := b.ifd(0,
+		long(tagNewSubFileType, 1), long(tagImageWidth, 16), long(tagImageLength, 8),
+		short(tagCompression, 7), short(tagPhotometric, 6),
+		long(tagStripOffsets, smallOffset), long(tagStripByteCounts, int64(len(small))))
+	sub2 := b.ifd(0,
+		long(tagNewSubFileType, 1), long(tagImageWidth, 64), long(tagImageLength, 32),
+		short(tagCompression, 7), short(tagPhotometric, 6),
+		long(tagStripOffsets, largeOffset), long(tagStripByteCounts, int64(len(large))))
+	ifd0 := b.ifd(0,
+		long(tagNewSubFileType, 1), long(tagImageWidth, 4), long(tagImageLength, 2),
+		short(tagCompression, 1), short(tagPhotometric, 2), short(tagOrientation, 6),
+		long(tagStripOffsets, thumbOffset), long(tagStripByteCounts, 24),
+		long(tagSubIFDs, sub1, sub2))
+	return b.bytes(ifd0), large
+}
+
+func TestOpen(t *testing.T) {
+	for _, order := range []byteOrder{binary.LittleEndian, binary.BigEndian} {
+		data, _ := previewDNG(t, order)
+		f := open(t, data)
+		assert.Len(t, f.IFDs, 3, order.String())
+		assert.Equal(t, 4, f.IFDs[0].Width())
+		assert.Equal(t, 64, f.IFDs[2].Width())
+		assert.Equal(t, 6, f.Orientation())
+	}
+
+	_, err := Open(bytes.NewReader([]byte("not a tiff file")), 15)
+	assert.Error(t, err)
+
+	// A SubIFD pointing back at IFD0 must not loop.
+	b := newBuilder(binary.LittleEndian)
+	ifd0 := b.blob(nil)
+	b.ifd(0, long(tagImageWidth, 1), long(tagSubIFDs, ifd0))
+	f := open(t, b.bytes(ifd0))
+	assert.Len(t, f.IFDs, 1)
+}
+
+func TestPreview(t *testing.T) {
+	data, large := previewDNG(t, binary.LittleEndian)
+	f := open(t, data)
+
+	preview, err := f.Preview()
+	assert.NoError(t, err)
+	got, err := io.ReadAll(preview)
+	assert.NoError(t, err)
+	assert.Equal(t, large, got)
+
+	b := newBuilder(binary.LittleEndian)
+	ifd0 := b.ifd(0, long(tagNewSubFileType, 0), long(tagImageWidth, 4), long(tagImageLength, 2))
+	_, err = open(t, b.bytes(ifd0)).Preview()
+	assert.ErrorIs(t, err, ErrNoPreview)
+}
@@ -0,0 +1,84 @@
+package dng
+
+import (
+	"bufio"
+	"encoding/binary"
+	"image"
+	"io"
+)
+
+// EncodeTIFF writes img as an uncompressed 16-bit RGB TIFF. An orientation
+// above 1 is recorded in the Orientation tag.
+func EncodeTIFF(w io.Writer, img *image.RGBA64, orientation int) error {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	type entry struct {
+		tag, typ uint16
+		value    uint32
+	}
+	const (
+		typeShort = 3
+		typeLong  = 4
+	)
+	entries := []entry{
+		{tagImageWidth, typeLong, uint32(width)},
+		{tagImageLength, typeLong, uint32(height)},
+		{tagBitsPerSample, typeShort, 0}, // three values, stored after the IFD
+		{tagCompression, typeShort, compressionNone},
+		{tagPhotometric, typeShort, photometricRGB},
+		{tagStripOffsets, typeLong, 0},
+		{tagOrientation, typeShort, uint32(max(orientation, 1))},
+		{tagSamplesPerPixel, typeShort, 3},
+		{tagRowsPerStrip, typeLong, uint32(height)},
+		{tagStripByteCounts, typeLong, uint32(width * height * 6)},
+	}
+	ifdLen := 2 + len(entries)*12 + 4
+	bitsOffset := 8 + ifdLen
+	dataOffset := bitsOffset + 6
+	entries[2].value = uint32(bitsOffset)
+	entries[5].value = uint32(dataOffset)
+
+	bw := bufio.NewWriter(w)
+	order := binary.LittleEndian
+	buf := make([]byte, 0, dataOffset)
+	buf = append(buf, 'I', 'I')
+	buf = order.AppendUint16(buf, 42)
+	buf = order.AppendUint32(buf, 8)
+	buf = order.AppendUint16(buf, uint16(len(entries)))
+	for _, e := range entries {
+		buf = order.AppendUint16(buf, e.tag)
+		buf = order.AppendUint16(buf, e.typ)
+		if e.tag == tagBitsPerSample {
+			buf = order.AppendUint32(buf, 3)
+			buf = order.AppendUint32(buf, e.value)
+			continue
+		}
+		buf = order.AppendUint32(buf, 1)
+		if e.typ == typeShort {
+			buf = order.AppendUint16(buf, uint16(e.value))
+			buf = order.AppendUint16(buf, 0)
+		} else {
+			buf = order.AppendUint32(buf, e.value)
+		}
+	}
+	buf = order.AppendUint32(buf, 0)
+	for i := 0; i < 3; i++ {
+		buf = order.AppendUint16(buf, 16)
+	}
+	bw.Write(buf)
+
+	row := make([]byte, width*6)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := 0; x < width; x++ {
+			c := img.RGBA64At(bounds.Min.X+x, y)
+			order.PutUint16(row[x*6:], c.R)
+			order.PutUint16(row[x*6+2:], c.G)
+			order.PutUint16(row[x*6+4:], c.B)
+		}
+		if _, err := bw.Write(row); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
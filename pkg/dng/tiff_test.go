@@ -0,0 +1,34 @@
+package dng
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeTIFF(t *testing.T) {
+	img := image.NewRGBA64(image.Rect(0, 0, 3, 2))
+	img.SetRGBA64(2, 1, color.RGBA64{R: 0x1234, G: 0x5678, B: 0x9ABC, A: 0xFFFF})
+
+	var buf bytes.Buffer
+	assert.NoError(t, EncodeTIFF(&buf, img, 6))
+
+	f := open(t, buf.Bytes())
+	ifd := f.IFDs[0]
+	assert.Equal(t, 3, ifd.Width())
+	assert.Equal(t, 2, ifd.Height())
+	assert.Equal(t, 6, f.Orientation())
+	bits, err := ifd.uints(tagBitsPerSample)
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{16, 16, 16}, bits)
+
+	offset := ifd.uint(tagStripOffsets, 0)
+	assert.Equal(t, uint64(3*2*6), ifd.uint(tagStripByteCounts, 0))
+	last := buf.Bytes()[offset+5*6:]
+	assert.Equal(t, uint16(0x1234), binary.LittleEndian.Uint16(last))
+	assert.Equal(t, uint16(0x9ABC), binary.LittleEndian.Uint16(last[4:]))
+}
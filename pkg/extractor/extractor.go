@@ -0,0 +1,491 @@
+package extractor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+
+	"lrprev-extract-go/internal/jpegtran"
+	"lrprev-extract-go/pkg/lrprev"
+	"lrprev-extract-go/pkg/metadata"
+	"lrprev-extract-go/pkg/naming"
+	"lrprev-extract-go/pkg/output"
+	"lrprev-extract-go/pkg/report"
+)
+
+// Orientation modes for Options.Orient.
+const (
+	// OrientNone writes the preview as stored.
+	OrientNone = "none"
+	// OrientEXIF sets the EXIF Orientation tag without touching the image data.
+	OrientEXIF = "exif"
+	// OrientRotate rotates the image losslessly, falling back to the EXIF tag
+	// for JPEGs that cannot be transformed.
+	OrientRotate = "rotate"
+)
+
+type Options struct {
+	IncludeSize bool
+	// AllLevels writes every pyramid level; Levels writes only the listed ones.
+	// With neither set only the largest level is written.
+	AllLevels bool
+	Levels    []int
+	// Catalog is a shared catalog handle. When nil and a dbPath is given, the
+	// catalog is opened for this call only.
+	Catalog *lrprev.Catalog
+	// Previews is the previews.db index of the .lrdata being extracted. It
+	// links previews to catalog images when the UUID lookup fails.
+	Previews *lrprev.PreviewIndex
+	// WriteMetadata embeds EXIF and XMP from the catalog into each JPEG.
+	WriteMetadata bool
+	// WriteSidecar writes an .xmp sidecar with the catalog metadata next to
+	// each JPEG, leaving the JPEG bytes untouched.
+	WriteSidecar bool
+	// Orient applies the orientation recorded in the preview header; one of
+	// OrientNone (the default), OrientEXIF or OrientRotate.
+	Orient string
+	// Template renders output paths under the output directory instead of
+	// mirroring the original's folder.
+	Template *naming.Template
+	// Output writes the files under the run's conflict policy. When nil,
+	// files are written under ConflictPolicy.
+	Output *output.Writer
+	// Reporter receives the steps of each extraction. When nil they are
+	// discarded.
+	Reporter report.Reporter
+	// Smart selects what ExtractSmartPreview writes: SmartEmbedded (the
+	// default), SmartJPEG or SmartTIFF.
+	Smart string
+}
+
+func (o Options) logf(level report.Level, file, format string, args ...interface{}) {
+	r := o.Reporter
+	if r == nil {
+		r = report.Discard
+	}
+	r.Logf(level, file, format, args...)
+}
+
+// mkdirAll creates an output directory through opts.Output, so a dry run
+// creates none.
+func (o Options) mkdirAll(dir string) error {
+	if o.Output != nil {
+		return o.Output.MkdirAll(dir)
+	}
+	return os.MkdirAll(dir, os.ModePerm)
+}
+
+// Target describes where a preview is written and what is known about its
+// image.
+type Target struct {
+	Dir      string
+	BaseName string
+	Metadata *metadata.Metadata
+	// Root is the output directory that Options.Template renders under, and
+	// Fields the values it can use. Level sizes are filled in per level.
+	Root   string
+	Fields naming.Fields
+}
+
+func (o Options) multiLevel() bool {
+	return o.AllLevels || len(o.Levels) > 0
+}
+
+// CheckTemplate reports a Template that would write every level of a
+// multi-level run to the same file.
+func (o Options) CheckTemplate() error {
+	if o.Template != nil && (o.AllLevels || len(o.Levels) > 1) && !o.Template.Uses("level") {
+		return fmt.Errorf("template %q must contain {level} to extract several levels", o.Template)
+	}
+	return nil
+}
+
+// ConflictPolicy is the conflict policy to use when none is chosen. A
+// template may render several previews to the same name, so with one the
+// later files get a suffix instead of replacing the earlier ones.
+func ConflictPolicy(template *naming.Template) string {
+	if template != nil {
+		return output.Suffix
+	}
+	return output.Overwrite
+}
+
+// NeedsMetadata reports whether catalog metadata is written in any form.
+func (o Options) NeedsMetadata() bool {
+	return o.WriteMetadata || o.WriteSidecar
+}
+
+func ExtractLargestJPEGFromLRPREV(filePath, outputDir, dbPath string, includeSize bool) error {
+	return Extract(filePath, outputDir, dbPath, Options{IncludeSize: includeSize})
+}
+
+func Extract(filePath, outputDir, dbPath string, opts Options) error {
+	preview, err := openPreview(filePath, opts)
+	if err != nil {
+		return err
+	}
+	defer preview.Close()
+
+	uuid, err := previewUUID(filePath, preview.Preview, opts)
+	if err != nil {
+		return err
+	}
+
+	target := resolveTarget(filePath, uuid, outputDir, dbPath, opts)
+	return extractPreview(filePath, preview.Preview, target, opts)
+}
+
+// resolveTarget looks the UUID up in the catalog to place the output under
+// the original's folder, falling back to _path_not_found, or to outputDir
+// itself when there is no catalog.
+func resolveTarget(filePath, uuid, outputDir, dbPath string, opts Options) Target {
+	catalog := opts.Catalog
+	target := Target{Dir: outputDir, BaseName: uuid, Root: outputDir, Fields: naming.Fields{UUID: uuid, BaseName: uuid}}
+	if catalog == nil && dbPath != "" {
+		var err error
+		catalog, err = lrprev.OpenCatalog(dbPath)
+		if err != nil {
+			opts.logf(report.Warning, filePath, "Error opening catalog: %v", err)
+			target.Dir = filepath.Join(outputDir, "_path_not_found")
+			target.Fields.Folder = "_path_not_found"
+			return target
+		}
+		defer catalog.Close()
+	}
+	if catalog == nil {
+		return target
+	}
+
+	opts.logf(report.Debug, filePath, "Querying Lightroom database for original file path")
+	originalFilePath, origBaseName, err := resolveOriginal(filePath, catalog, uuid, opts)
+	if err != nil {
+		opts.logf(report.Warning, filePath, "Error getting original file path: %v", err)
+		target.Dir = filepath.Join(outputDir, "_path_not_found")
+		target.Fields.Folder = "_path_not_found"
+	} else {
+		target.Dir = filepath.Join(outputDir, originalFilePath)
+		target.BaseName = origBaseName
+		target.Fields.Folder = originalFilePath
+		target.Fields.BaseName = origBaseName
+	}
+
+	if opts.NeedsMetadata() || opts.Template != nil {
+		opts.logf(report.Debug, filePath, "Reading image metadata from catalog")
+		m, err := catalog.Metadata(uuid)
+		if errors.Is(err, metadata.ErrDevelop) {
+			opts.logf(report.Warning, filePath, "Writing metadata without develop settings: %v", err)
+			err = nil
+		}
+		if err != nil {
+			opts.logf(report.Warning, filePath, "Error reading image metadata: %v", err)
+		} else {
+			target.Metadata = &m
+			target.Fields.CaptureTime = m.CaptureTime
+			target.Fields.Camera = m.Model
+			target.Fields.Rating = m.Rating
+		}
+	}
+
+	if opts.Template != nil {
+		info, err := catalog.ImageInfo(uuid)
+		if err != nil {
+			opts.logf(report.Warning, filePath, "Error reading image details: %v", err)
+		} else {
+			target.Fields.Ext = info.Extension
+			if len(info.Collections) > 0 {
+				target.Fields.Collection = info.Collections[0]
+			}
+		}
+	}
+	return target
+}
+
+// ExtractTo writes the selected levels of a preview to target, for callers
+// that already know where the original lives.
+func ExtractTo(filePath string, target Target, opts Options) error {
+	preview, err := openPreview(filePath, opts)
+	if err != nil {
+		return err
+	}
+	defer preview.Close()
+
+	return extractPreview(filePath, preview.Preview, target, opts)
+}
+
+func openPreview(filePath string, opts Options) (*lrprev.File, error) {
+	opts.logf(report.Debug, filePath, "Reading file: %s", filePath)
+	if _, err := os.Stat(filePath); err != nil {
+		return nil, fmt.Errorf("error reading file: %v", err)
+	}
+
+	opts.logf(report.Debug, filePath, "Parsing AgHg sections")
+	preview, err := lrprev.OpenFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("no valid JPEG found in file: %v", err)
+	}
+	return preview, nil
+}
+
+func extractPreview(filePath string, preview *lrprev.Preview, target Target, opts Options) error {
+	levels, err := selectLevels(preview, opts)
+	if err != nil {
+		return err
+	}
+
+	orientation := previewOrientation(filePath, preview, opts)
+
+	if opts.Template == nil {
+		opts.logf(report.Debug, filePath, "Creating output directory: %s", target.Dir)
+		err = opts.mkdirAll(target.Dir)
+		if err != nil {
+			return fmt.Errorf("error creating output directory: %v", err)
+		}
+	}
+	out := opts.Output
+	if out == nil {
+		out, _ = output.NewWriter(ConflictPolicy(opts.Template))
+	}
+
+	for _, level := range levels {
+		jpegData, err := preview.OpenLevel(level.Number)
+		if err != nil {
+			return err
+		}
+		var soi [2]byte
+		if _, err := jpegData.ReadAt(soi[:], 0); err != nil && err != io.EOF {
+			return fmt.Errorf("error reading %s: %v", level.Section.Name, err)
+		}
+		if soi != [2]byte{0xFF, 0xD8} {
+			return fmt.Errorf("no valid JPEG found in file: %s does not start with a JPEG marker", level.Section.Name)
+		}
+
+		err = writeJPEG(filePath, level.Section.Name, jpegData, orientation, target, out, opts, func(jpegData *io.SectionReader) (string, error) {
+			return outputPath(filePath, target, level, jpegData, opts)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeJPEG writes one JPEG, applying the orientation and catalog metadata
+// under opts, to the path returned for the final image data.
+func writeJPEG(filePath, name string, jpegData *io.SectionReader, orientation int, target Target, out *output.Writer, opts Options, path func(*io.SectionReader) (string, error)) error {
+	tag := orientation
+	if opts.Orient == OrientRotate && tag > 1 {
+		// Lossless rotation needs the whole image; everything else is
+		// streamed from the preview to the output file.
+		opts.logf(report.Debug, filePath, "Rotating JPEG for orientation %d", tag)
+		jpegContents, err := io.ReadAll(jpegData)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %v", name, err)
+		}
+		rotated, err := jpegtran.Transform(jpegContents, tag)
+		switch {
+		case errors.Is(err, jpegtran.ErrUnsupported):
+			opts.logf(report.Warning, filePath, "Cannot rotate losslessly (%v), setting the EXIF Orientation tag instead", err)
+		case err != nil:
+			return fmt.Errorf("error rotating JPEG: %v", err)
+		default:
+			jpegData = io.NewSectionReader(bytes.NewReader(rotated), 0, int64(len(rotated)))
+			tag = 1
+		}
+	}
+
+	jpegPath, err := path(jpegData)
+	if err != nil {
+		return err
+	}
+
+	var m metadata.Metadata
+	if opts.WriteMetadata && target.Metadata != nil {
+		m = *target.Metadata
+	}
+	if tag > 1 {
+		m.Orientation = tag
+	}
+	var segments [][]byte
+	if opts.WriteMetadata && target.Metadata != nil {
+		opts.logf(report.Debug, filePath, "Writing EXIF and XMP metadata")
+		segments, err = metadata.Segments(m)
+	} else if tag > 1 {
+		opts.logf(report.Debug, filePath, "Setting EXIF orientation %d", tag)
+		segments, err = metadata.EXIFSegments(m)
+	}
+	if err != nil {
+		return fmt.Errorf("error writing metadata: %v", err)
+	}
+
+	opts.logf(report.Debug, filePath, "Writing JPEG file: %s", jpegPath)
+	written, err := out.WriteStream(jpegPath, filePath, func(w io.Writer) error {
+		r := io.NewSectionReader(jpegData, 0, jpegData.Size())
+		if segments == nil {
+			_, err := io.Copy(w, r)
+			return err
+		}
+		if err := metadata.Write(w, r, segments); err != nil {
+			return fmt.Errorf("error writing metadata: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("error writing JPEG file: %v", err)
+	}
+	if written == "" {
+		opts.logf(report.Info, filePath, "Skipped %s: file already exists", jpegPath)
+		return nil
+	}
+
+	opts.logf(report.Debug, filePath, "JPEG image extracted and saved to %s", written)
+	return writeSidecar(filePath, written, target, out, opts)
+}
+
+func writeSidecar(filePath, imagePath string, target Target, out *output.Writer, opts Options) error {
+	if !opts.WriteSidecar || target.Metadata == nil {
+		return nil
+	}
+	sidecarPath := metadata.SidecarPath(imagePath)
+	opts.logf(report.Debug, filePath, "Writing XMP sidecar: %s", sidecarPath)
+	if err := out.WriteAlongside(sidecarPath, filePath, metadata.EncodeSidecar(*target.Metadata)); err != nil {
+		return fmt.Errorf("error writing XMP sidecar: %v", err)
+	}
+	return nil
+}
+
+// previewOrientation returns the EXIF orientation to apply, or 1 when
+// orientation is not handled or the header has no usable code.
+func previewOrientation(filePath string, preview *lrprev.Preview, opts Options) int {
+	if opts.Orient == "" || opts.Orient == OrientNone {
+		return 1
+	}
+	header, err := preview.Header()
+	if err != nil {
+		opts.logf(report.Warning, filePath, "Error reading preview header: %v", err)
+		return 1
+	}
+	orientation, ok := lrprev.ExifOrientation(header.Orientation)
+	if !ok {
+		opts.logf(report.Warning, filePath, "Unknown preview orientation %q, leaving the image as stored", header.Orientation)
+		return 1
+	}
+	return orientation
+}
+
+func resolveOriginal(filePath string, catalog *lrprev.Catalog, uuid string, opts Options) (string, string, error) {
+	dir, baseName, err := catalog.ResolvePath(uuid)
+	if err == nil || opts.Previews == nil {
+		return dir, baseName, err
+	}
+
+	entry, ok := opts.Previews.Lookup(uuid)
+	if !ok {
+		return "", "", err
+	}
+
+	opts.logf(report.Debug, filePath, "Resolving image %d from previews.db", entry.ImageID)
+	location, idErr := catalog.ResolveImageID(entry.ImageID)
+	if idErr != nil {
+		return "", "", fmt.Errorf("%v; %v", err, idErr)
+	}
+	return location.Dir, location.BaseName, nil
+}
+
+// PreviewUUID returns the uuid Extract resolves the preview at filePath by.
+func PreviewUUID(filePath string, opts Options) (string, error) {
+	preview, err := openPreview(filePath, opts)
+	if err != nil {
+		return "", err
+	}
+	defer preview.Close()
+	return previewUUID(filePath, preview.Preview, opts)
+}
+
+// previewUUID is Preview.UUID, warning when the header cannot be read.
+func previewUUID(filePath string, preview *lrprev.Preview, opts Options) (string, error) {
+	opts.logf(report.Debug, filePath, "Reading preview header")
+	if _, err := preview.Header(); err != nil {
+		opts.logf(report.Warning, filePath, "Error reading preview header: %v", err)
+	}
+	return preview.UUID(filePath)
+}
+
+func selectLevels(preview *lrprev.Preview, opts Options) ([]lrprev.Level, error) {
+	if !opts.multiLevel() {
+		largest, ok := preview.Largest()
+		if !ok {
+			return nil, fmt.Errorf("no valid JPEG found in file: no level sections")
+		}
+		return []lrprev.Level{largest}, nil
+	}
+
+	all := preview.Levels()
+	if opts.AllLevels {
+		if len(all) == 0 {
+			return nil, fmt.Errorf("no valid JPEG found in file: no level sections")
+		}
+		return all, nil
+	}
+
+	wanted := make(map[int]bool, len(opts.Levels))
+	for _, n := range opts.Levels {
+		wanted[n] = true
+	}
+
+	var selected []lrprev.Level
+	for _, level := range all {
+		if wanted[level.Number] {
+			selected = append(selected, level)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("none of the requested levels %v found in file (available: %d)", opts.Levels, len(all))
+	}
+	return selected, nil
+}
+
+func outputPath(filePath string, target Target, level lrprev.Level, jpegData *io.SectionReader, opts Options) (string, error) {
+	if opts.Template == nil {
+		newFilename, err := outputFilename(filePath, target.BaseName, level, jpegData, opts)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(target.Dir, newFilename), nil
+	}
+
+	opts.logf(report.Debug, filePath, "Decoding JPEG dimensions")
+	config, err := jpeg.DecodeConfig(io.NewSectionReader(jpegData, 0, jpegData.Size()))
+	if err != nil {
+		return "", fmt.Errorf("error decoding JPEG dimensions: %v", err)
+	}
+	fields := target.Fields
+	fields.Width, fields.Height, fields.Level = config.Width, config.Height, level.Number
+	jpegPath := filepath.Join(target.Root, opts.Template.Render(fields))
+
+	opts.logf(report.Debug, filePath, "Creating output directory: %s", filepath.Dir(jpegPath))
+	if err := opts.mkdirAll(filepath.Dir(jpegPath)); err != nil {
+		return "", fmt.Errorf("error creating output directory: %v", err)
+	}
+	return jpegPath, nil
+}
+
+func outputFilename(filePath, baseName string, level lrprev.Level, jpegData *io.SectionReader, opts Options) (string, error) {
+	if !opts.IncludeSize && !opts.multiLevel() {
+		return fmt.Sprintf("%s.jpg", baseName), nil
+	}
+
+	opts.logf(report.Debug, filePath, "Decoding JPEG dimensions")
+	config, err := jpeg.DecodeConfig(io.NewSectionReader(jpegData, 0, jpegData.Size()))
+	if err != nil {
+		return "", fmt.Errorf("error decoding JPEG dimensions: %v", err)
+	}
+
+	if opts.multiLevel() {
+		return fmt.Sprintf("%s_level%d_%dx%d.jpg", baseName, level.Number, config.Width, config.Height), nil
+	}
+	return fmt.Sprintf("%s_%dx%d.jpg", baseName, config.Width, config.Height), nil
+}
@@ -0,0 +1,791 @@
+package extractor
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"lrprev-extract-go/pkg/lrprev"
+	"lrprev-extract-go/pkg/metadata"
+	"lrprev-extract-go/pkg/naming"
+	"lrprev-extract-go/pkg/output"
+	"lrprev-extract-go/pkg/report"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+// buildLRPREV wraps jpegContent as the largest level of a minimal AgHg container,
+// preceded by a header section and a smaller decoy level.
+func buildLRPREV(t *testing.T, jpegContent []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	assert.NoError(t, lrprev.WriteSection(&buf, "header", []byte("preview = {}"), 4))
+	assert.NoError(t, lrprev.WriteSection(&buf, "level_1", []byte{0xFF, 0xD8, 0x00, 0xFF, 0xD9}, 3))
+	assert.NoError(t, lrprev.WriteSection(&buf, "level_2", jpegContent, 0))
+	return buf.Bytes()
+}
+
+func TestExtractLargestJPEGFromLRPREV_Success(t *testing.T) {
+	// Create a temporary directory for the test
+	tempDir, err := os.MkdirTemp("", "lrprev_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Create a mock LRPREV file
+	uuid := "12345678-1234-1234-1234-123456789012"
+	lrprevPath := filepath.Join(tempDir, "test-"+uuid+".lrprev")
+	jpegContent := []byte{0xFF, 0xD8, 0xFF, 0xD9} // Minimal valid JPEG
+	err = os.WriteFile(lrprevPath, buildLRPREV(t, jpegContent), 0644)
+	assert.NoError(t, err)
+
+	// Run the extraction
+	err = ExtractLargestJPEGFromLRPREV(lrprevPath, tempDir, "", false)
+	assert.NoError(t, err)
+
+	// Check if the JPEG was extracted correctly - note we're now checking for just the UUID in the output filename
+	extractedPath := filepath.Join(tempDir, uuid+".jpg")
+	_, err = os.Stat(extractedPath)
+	assert.NoError(t, err)
+
+	extractedContent, err := os.ReadFile(extractedPath)
+	assert.NoError(t, err)
+	assert.Equal(t, jpegContent, extractedContent)
+}
+
+func TestExtractLargestJPEGFromLRPREV_InvalidFilePath(t *testing.T) {
+	err := ExtractLargestJPEGFromLRPREV("non_existent_file.lrprev", "output", "", false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "error reading file")
+}
+
+func TestExtractLargestJPEGFromLRPREV_NoValidJPEG(t *testing.T) {
+	// Create a temporary directory for the test
+	tempDir, err := os.MkdirTemp("", "lrprev_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Create a mock LRPREV file without a valid JPEG
+	uuid := "12345678-1234-1234-1234-123456789012"
+	lrprevPath := filepath.Join(tempDir, "test-"+uuid+".lrprev")
+	err = os.WriteFile(lrprevPath, []byte("not a valid JPEG"), 0644)
+	assert.NoError(t, err)
+
+	// Run the extraction
+	err = ExtractLargestJPEGFromLRPREV(lrprevPath, tempDir, "", false)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no valid JPEG found in file")
+}
+
+func TestExtractLargestJPEGFromLRPREV_EmbeddedThumbnail(t *testing.T) {
+	// Create a temporary directory for the test
+	tempDir, err := os.MkdirTemp("", "lrprev_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// The largest level carries its own embedded thumbnail, which used to fool marker scanning
+	uuid := "12345678-1234-1234-1234-123456789012"
+	lrprevPath := filepath.Join(tempDir, "test-"+uuid+".lrprev")
+	jpegContent := []byte{0xFF, 0xD8, 0xFF, 0xE1, 0xFF, 0xD8, 0xFF, 0xD9, 0x00, 0xFF, 0xD9}
+	err = os.WriteFile(lrprevPath, buildLRPREV(t, jpegContent), 0644)
+	assert.NoError(t, err)
+
+	err = ExtractLargestJPEGFromLRPREV(lrprevPath, tempDir, "", false)
+	assert.NoError(t, err)
+
+	extractedContent, err := os.ReadFile(filepath.Join(tempDir, uuid+".jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, jpegContent, extractedContent)
+}
+
+func TestExtractLargestJPEGFromLRPREV_WithDatabase(t *testing.T) {
+	// Create a temporary directory for the test
+	tempDir, err := os.MkdirTemp("", "lrprev_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Create a mock SQLite database
+	dbPath := filepath.Join(tempDir, "test.db")
+	db, err := sql.Open("sqlite3", dbPath)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE TABLE AgLibraryFile (id_global TEXT, folder INTEGER, baseName TEXT);
+		CREATE TABLE AgLibraryFolder (id_local INTEGER, rootFolder INTEGER, pathFromRoot TEXT);
+		CREATE TABLE AgLibraryRootFolder (id_local INTEGER, absolutePath TEXT);
+		INSERT INTO AgLibraryFile (id_global, folder, baseName) VALUES ('12345678-1234-1234-1234-123456789012', 1, 'test');
+		INSERT INTO AgLibraryFolder (id_local, rootFolder, pathFromRoot) VALUES (1, 1, 'path/from/root');
+		INSERT INTO AgLibraryRootFolder (id_local, absolutePath) VALUES (1, '/absolute/path');
+	`)
+	assert.NoError(t, err)
+
+	// Create a mock LRPREV file
+	uuid := "12345678-1234-1234-1234-123456789012"
+	lrprevPath := filepath.Join(tempDir, "test-"+uuid+".lrprev")
+	jpegContent := []byte{0xFF, 0xD8, 0xFF, 0xD9} // Minimal valid JPEG
+	err = os.WriteFile(lrprevPath, buildLRPREV(t, jpegContent), 0644)
+	assert.NoError(t, err)
+
+	// Run the extraction
+	err = ExtractLargestJPEGFromLRPREV(lrprevPath, tempDir, dbPath, false)
+	assert.NoError(t, err)
+
+	// Check if the JPEG was extracted to the correct path
+	extractedPath := filepath.Join(tempDir, "absolute", "path", "path", "from", "root", "test.jpg")
+	_, err = os.Stat(extractedPath)
+	assert.NoError(t, err)
+}
+
+func TestExtract_SharedCatalog(t *testing.T) {
+	tempDir := t.TempDir()
+
+	dbPath := filepath.Join(tempDir, "test.lrcat")
+	db, err := sql.Open("sqlite3", dbPath)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE TABLE AgLibraryFile (id_global TEXT, folder INTEGER, baseName TEXT);
+		CREATE TABLE AgLibraryFolder (id_local INTEGER, rootFolder INTEGER, pathFromRoot TEXT);
+		CREATE TABLE AgLibraryRootFolder (id_local INTEGER, absolutePath TEXT);
+		INSERT INTO AgLibraryFile VALUES ('12345678-1234-1234-1234-123456789012', 1, 'first');
+		INSERT INTO AgLibraryFile VALUES ('87654321-4321-4321-4321-210987654321', 1, 'second');
+		INSERT INTO AgLibraryFolder VALUES (1, 1, 'shoot/');
+		INSERT INTO AgLibraryRootFolder VALUES (1, '/photos/');
+	`)
+	assert.NoError(t, err)
+
+	catalog, err := lrprev.OpenCatalog(dbPath)
+	assert.NoError(t, err)
+	defer catalog.Close()
+	assert.NoError(t, catalog.Preload())
+
+	for _, uuid := range []string{"12345678-1234-1234-1234-123456789012", "87654321-4321-4321-4321-210987654321"} {
+		lrprevPath := filepath.Join(tempDir, uuid+".lrprev")
+		writePyramid(t, lrprevPath, minimalJPEG(16, 16))
+		assert.NoError(t, Extract(lrprevPath, tempDir, "", Options{Catalog: catalog}))
+	}
+
+	for _, name := range []string{"first.jpg", "second.jpg"} {
+		_, err = os.Stat(filepath.Join(tempDir, "photos", "shoot", name))
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestExtractLargestJPEGFromLRPREV_WithoutDatabase(t *testing.T) {
+	// Create a temporary directory for the test
+	tempDir, err := os.MkdirTemp("", "lrprev_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Create a mock LRPREV file
+	uuid := "12345678-1234-1234-1234-123456789012"
+	lrprevPath := filepath.Join(tempDir, "test-"+uuid+".lrprev")
+	jpegContent := []byte{0xFF, 0xD8, 0xFF, 0xD9} // Minimal valid JPEG
+	err = os.WriteFile(lrprevPath, buildLRPREV(t, jpegContent), 0644)
+	assert.NoError(t, err)
+
+	// Run the extraction
+	err = ExtractLargestJPEGFromLRPREV(lrprevPath, tempDir, "", false)
+	assert.NoError(t, err)
+
+	// Check if the JPEG was extracted to the correct path - note we're checking for just the UUID
+	extractedPath := filepath.Join(tempDir, uuid+".jpg")
+	_, err = os.Stat(extractedPath)
+	assert.NoError(t, err)
+}
+
+func TestExtractLargestJPEGFromLRPREV_IncludeSize(t *testing.T) {
+	// Create a temporary directory for the test
+	tempDir, err := os.MkdirTemp("", "lrprev_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Create a mock LRPREV file with a valid JPEG (including JPEG header with dimensions)
+	uuid := "12345678-1234-1234-1234-123456789012"
+	lrprevPath := filepath.Join(tempDir, "test-"+uuid+".lrprev")
+	jpegContent := []byte{
+		0xFF, 0xD8, // SOI marker
+		0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00, 0x01, 0x01, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, // JFIF header
+		0xFF, 0xC0, 0x00, 0x11, 0x08, 0x00, 0x10, 0x00, 0x10, 0x03, 0x01, 0x22, 0x00, 0x02, 0x11, 0x01, 0x03, 0x11, 0x01, // SOF marker (16x16 image)
+		0xFF, 0xD9, // EOI marker
+	}
+	err = os.WriteFile(lrprevPath, buildLRPREV(t, jpegContent), 0644)
+	assert.NoError(t, err)
+
+	// Run the extraction
+	err = ExtractLargestJPEGFromLRPREV(lrprevPath, tempDir, "", true)
+	assert.NoError(t, err)
+
+	// Check if the JPEG was extracted with the correct filename (including dimensions)
+	extractedPath := filepath.Join(tempDir, uuid+"_16x16.jpg")
+	_, err = os.Stat(extractedPath)
+	assert.NoError(t, err)
+}
+
+func TestExtractLargestJPEGFromLRPREV_ExcludeSize(t *testing.T) {
+	// Create a temporary directory for the test
+	tempDir, err := os.MkdirTemp("", "lrprev_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(tempDir)
+
+	// Create a mock LRPREV file
+	uuid := "12345678-1234-1234-1234-123456789012"
+	lrprevPath := filepath.Join(tempDir, "test-"+uuid+".lrprev")
+	jpegContent := []byte{0xFF, 0xD8, 0xFF, 0xD9} // Minimal valid JPEG
+	err = os.WriteFile(lrprevPath, buildLRPREV(t, jpegContent), 0644)
+	assert.NoError(t, err)
+
+	// Run the extraction
+	err = ExtractLargestJPEGFromLRPREV(lrprevPath, tempDir, "", false)
+	assert.NoError(t, err)
+
+	// Check if the JPEG was extracted with the correct filename (without dimensions)
+	extractedPath := filepath.Join(tempDir, uuid+".jpg")
+	_, err = os.Stat(extractedPath)
+	assert.NoError(t, err)
+}
+
+// minimalJPEG returns a JPEG header whose SOF marker declares the given dimensions.
+func minimalJPEG(width, height int) []byte {
+	return []byte{
+		0xFF, 0xD8, // SOI marker
+		0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00, 0x01, 0x01, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00, // JFIF header
+		0xFF, 0xC0, 0x00, 0x11, 0x08, byte(height >> 8), byte(height), byte(width >> 8), byte(width), 0x03, 0x01, 0x22, 0x00, 0x02, 0x11, 0x01, 0x03, 0x11, 0x01, // SOF marker
+		0xFF, 0xD9, // EOI marker
+	}
+}
+
+func writePyramid(t *testing.T, path string, levels ...[]byte) {
+	t.Helper()
+	writePyramidWithHeader(t, path, "preview = {}", levels...)
+}
+
+func writePyramidWithHeader(t *testing.T, path, header string, levels ...[]byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	assert.NoError(t, lrprev.WriteSection(&buf, "header", []byte(header), 0))
+	for i, level := range levels {
+		assert.NoError(t, lrprev.WriteSection(&buf, fmt.Sprintf("level_%d", i+1), level, 2))
+	}
+	assert.NoError(t, os.WriteFile(path, buf.Bytes(), 0644))
+}
+
+func TestExtract_AllLevels(t *testing.T) {
+	tempDir := t.TempDir()
+
+	uuid := "12345678-1234-1234-1234-123456789012"
+	lrprevPath := filepath.Join(tempDir, uuid+".lrprev")
+	writePyramid(t, lrprevPath, minimalJPEG(160, 120), minimalJPEG(320, 240), minimalJPEG(640, 480))
+
+	err := Extract(lrprevPath, tempDir, "", Options{AllLevels: true})
+	assert.NoError(t, err)
+
+	for _, name := range []string{"_level1_160x120.jpg", "_level2_320x240.jpg", "_level3_640x480.jpg"} {
+		_, err = os.Stat(filepath.Join(tempDir, uuid+name))
+		assert.NoError(t, err, name)
+	}
+}
+
+func TestExtract_SelectedLevels(t *testing.T) {
+	tempDir := t.TempDir()
+
+	uuid := "12345678-1234-1234-1234-123456789012"
+	lrprevPath := filepath.Join(tempDir, uuid+".lrprev")
+	writePyramid(t, lrprevPath, minimalJPEG(160, 120), minimalJPEG(320, 240), minimalJPEG(640, 480))
+
+	err := Extract(lrprevPath, tempDir, "", Options{Levels: []int{1, 3, 7}})
+	assert.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(tempDir, uuid+"_level1_160x120.jpg"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(tempDir, uuid+"_level3_640x480.jpg"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(tempDir, uuid+"_level2_320x240.jpg"))
+	assert.True(t, os.IsNotExist(err))
+
+	err = Extract(lrprevPath, tempDir, "", Options{Levels: []int{9}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "none of the requested levels")
+}
+
+func TestExtract_UUIDFromHeader(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// The preview was renamed, so only the header knows its uuid
+	uuid := "12345678-1234-1234-1234-123456789012"
+	lrprevPath := filepath.Join(tempDir, "copy of preview.lrprev")
+	var buf bytes.Buffer
+	assert.NoError(t, lrprev.WriteSection(&buf, "header", []byte(`pyramid = { uuid = "`+uuid+`", digest = "abc" }`), 0))
+	assert.NoError(t, lrprev.WriteSection(&buf, "level_1", []byte{0xFF, 0xD8, 0xFF, 0xD9}, 0))
+	assert.NoError(t, os.WriteFile(lrprevPath, buf.Bytes(), 0644))
+
+	err := Extract(lrprevPath, tempDir, "", Options{})
+	assert.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(tempDir, uuid+".jpg"))
+	assert.NoError(t, err)
+}
+
+func TestPreviewUUID(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// A copy named after another preview still has its own uuid
+	uuid := "12345678-1234-1234-1234-123456789012"
+	lrprevPath := filepath.Join(tempDir, "ABCDEFAB-1234-1234-1234-123456789012-abc.lrprev")
+	writePyramidWithHeader(t, lrprevPath, `pyramid = { uuid = "`+uuid+`" }`, minimalJPEG(16, 16))
+	got, err := PreviewUUID(lrprevPath, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, uuid, got)
+
+	writePyramid(t, lrprevPath, minimalJPEG(16, 16))
+	got, err = PreviewUUID(lrprevPath, Options{})
+	assert.NoError(t, err)
+	assert.Equal(t, "ABCDEFAB-1234-1234-1234-123456789012", got)
+
+	_, err = PreviewUUID(filepath.Join(tempDir, "missing.lrprev"), Options{})
+	assert.Error(t, err)
+}
+
+func TestExtract_NoUUID(t *testing.T) {
+	tempDir := t.TempDir()
+
+	lrprevPath := filepath.Join(tempDir, "preview.lrprev")
+	writePyramid(t, lrprevPath, minimalJPEG(16, 16))
+
+	err := Extract(lrprevPath, tempDir, "", Options{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "UUID could not be extracted")
+}
+
+func TestExtract_PreviewIndexFallback(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// The catalog does not know the preview UUID, but previews.db links it to image 7
+	dbPath := filepath.Join(tempDir, "test.lrcat")
+	db, err := sql.Open("sqlite3", dbPath)
+	assert.NoError(t, err)
+	_, err = db.Exec(`
+		CREATE TABLE AgLibraryFile (id_local INTEGER, id_global TEXT, folder INTEGER, baseName TEXT);
+		CREATE TABLE AgLibraryFolder (id_local INTEGER, rootFolder INTEGER, pathFromRoot TEXT);
+		CREATE TABLE AgLibraryRootFolder (id_local INTEGER, absolutePath TEXT);
+		CREATE TABLE Adobe_images (id_local INTEGER, id_global TEXT, rootFile INTEGER, copyName TEXT);
+		INSERT INTO AgLibraryFile VALUES (3, 'FILE-UUID', 1, 'linked');
+		INSERT INTO AgLibraryFolder VALUES (1, 1, 'shoot/');
+		INSERT INTO AgLibraryRootFolder VALUES (1, '/photos/');
+		INSERT INTO Adobe_images VALUES (7, 'IMAGE-UUID', 3, NULL);
+	`)
+	assert.NoError(t, err)
+	db.Close()
+
+	uuid := "12345678-1234-1234-1234-123456789012"
+	indexPath := filepath.Join(tempDir, "previews.db")
+	db, err = sql.Open("sqlite3", indexPath)
+	assert.NoError(t, err)
+	_, err = db.Exec(`
+		CREATE TABLE ImageCacheEntry (imageId INTEGER PRIMARY KEY, uuid NOT NULL, digest NOT NULL, orientation);
+		CREATE TABLE Pyramid (uuid UNIQUE NOT NULL, digest NOT NULL);
+		INSERT INTO ImageCacheEntry VALUES (7, '` + uuid + `', 'digest', 'AB');
+	`)
+	assert.NoError(t, err)
+	db.Close()
+
+	previews, err := lrprev.OpenPreviewIndex(indexPath)
+	assert.NoError(t, err)
+
+	lrprevPath := filepath.Join(tempDir, uuid+".lrprev")
+	writePyramid(t, lrprevPath, minimalJPEG(16, 16))
+
+	err = Extract(lrprevPath, tempDir, dbPath, Options{Previews: previews})
+	assert.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(tempDir, "photos", "shoot", "linked.jpg"))
+	assert.NoError(t, err)
+}
+
+func createTaggedCatalog(t *testing.T, dir, uuid string) string {
+	t.Helper()
+	dbPath := filepath.Join(dir, "test.lrcat")
+	db, err := sql.Open("sqlite3", dbPath)
+	assert.NoError(t, err)
+	_, err = db.Exec(`
+		CREATE TABLE AgLibraryFile (id_local INTEGER, id_global TEXT, folder INTEGER, baseName TEXT);
+		CREATE TABLE AgLibraryFolder (id_local INTEGER, rootFolder INTEGER, pathFromRoot TEXT);
+		CREATE TABLE AgLibraryRootFolder (id_local INTEGER, absolutePath TEXT);
+		CREATE TABLE Adobe_images (id_local INTEGER, id_global TEXT, rootFile INTEGER, rating REAL, pick REAL, captureTime TEXT, colorLabels TEXT, copyName TEXT);
+		CREATE TABLE AgLibraryKeyword (id_local INTEGER, name TEXT, parent INTEGER);
+		CREATE TABLE AgLibraryKeywordImage (image INTEGER, tag INTEGER);
+		INSERT INTO AgLibraryFile VALUES (1, '` + uuid + `', 1, 'tagged');
+		INSERT INTO AgLibraryFolder VALUES (1, 1, '');
+		INSERT INTO AgLibraryRootFolder VALUES (1, '/photos/');
+		INSERT INTO Adobe_images VALUES (5, 'IMAGE-UUID', 1, 3, 1, '2025-06-14T15:32:11', '', NULL);
+		INSERT INTO AgLibraryKeyword VALUES (1, 'ceremony', NULL);
+		INSERT INTO AgLibraryKeywordImage VALUES (5, 1);
+	`)
+	assert.NoError(t, err)
+	db.Close()
+	return dbPath
+}
+
+func TestExtract_WriteMetadata(t *testing.T) {
+	tempDir := t.TempDir()
+
+	uuid := "12345678-1234-1234-1234-123456789012"
+	dbPath := createTaggedCatalog(t, tempDir, uuid)
+
+	lrprevPath := filepath.Join(tempDir, uuid+".lrprev")
+	writePyramid(t, lrprevPath, minimalJPEG(16, 16))
+
+	err := Extract(lrprevPath, tempDir, dbPath, Options{WriteMetadata: true})
+	assert.NoError(t, err)
+
+	extracted, err := os.ReadFile(filepath.Join(tempDir, "photos", "tagged.jpg"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(extracted), "Exif\x00\x00")
+	assert.Contains(t, string(extracted), "2025:06:14 15:32:11")
+	assert.Contains(t, string(extracted), `xmp:Rating="3"`)
+	assert.Contains(t, string(extracted), "<rdf:li>ceremony</rdf:li>")
+	assert.NoFileExists(t, filepath.Join(tempDir, "photos", "tagged.xmp"))
+}
+
+func TestExtract_WriteSidecar(t *testing.T) {
+	tempDir := t.TempDir()
+
+	uuid := "12345678-1234-1234-1234-123456789012"
+	dbPath := createTaggedCatalog(t, tempDir, uuid)
+
+	jpegData := minimalJPEG(16, 16)
+	lrprevPath := filepath.Join(tempDir, uuid+".lrprev")
+	writePyramid(t, lrprevPath, jpegData)
+
+	err := Extract(lrprevPath, tempDir, dbPath, Options{WriteSidecar: true})
+	assert.NoError(t, err)
+
+	// The JPEG is written unchanged
+	extracted, err := os.ReadFile(filepath.Join(tempDir, "photos", "tagged.jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, jpegData, extracted)
+
+	sidecar, err := os.ReadFile(filepath.Join(tempDir, "photos", "tagged.xmp"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(sidecar), `xmp:Rating="3"`)
+	assert.Contains(t, string(sidecar), `xmpDM:pick="1"`)
+	assert.Contains(t, string(sidecar), "<lr:hierarchicalSubject>")
+}
+
+func TestExtract_Orient(t *testing.T) {
+	var encoded bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&encoded, image.NewGray(image.Rect(0, 0, 32, 16)), nil))
+	progressive := minimalJPEG(32, 16)
+	progressive[21] = 0xC2
+
+	tests := []struct {
+		name        string
+		orient      string
+		jpeg        []byte
+		wantName    string
+		wantExif    bool
+		wantRotated bool
+	}{
+		{"none", OrientNone, encoded.Bytes(), "_32x16.jpg", false, false},
+		{"exif", OrientEXIF, encoded.Bytes(), "_32x16.jpg", true, false},
+		{"rotate", OrientRotate, encoded.Bytes(), "_16x32.jpg", false, true},
+		{"rotate fallback", OrientRotate, progressive, "_32x16.jpg", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			uuid := "12345678-1234-1234-1234-123456789012"
+			lrprevPath := filepath.Join(tempDir, uuid+".lrprev")
+			writePyramidWithHeader(t, lrprevPath, `pyramid = { orientation = "BC", }`, tt.jpeg)
+
+			err := Extract(lrprevPath, tempDir, "", Options{IncludeSize: true, Orient: tt.orient})
+			assert.NoError(t, err)
+
+			extracted, err := os.ReadFile(filepath.Join(tempDir, uuid+tt.wantName))
+			assert.NoError(t, err)
+			// Orientation 6 as a little-endian SHORT entry in IFD0
+			orientationTag := []byte{0x12, 0x01, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x00}
+			assert.Equal(t, tt.wantExif, bytes.Contains(extracted, orientationTag))
+			assert.Equal(t, !tt.wantExif && !tt.wantRotated, bytes.Equal(extracted, tt.jpeg))
+		})
+	}
+}
+
+func TestExtract_OrientKeepsXMP(t *testing.T) {
+	tempDir := t.TempDir()
+	withXMP, err := metadata.Insert(minimalJPEG(32, 16), metadata.Metadata{Title: "First dance"})
+	assert.NoError(t, err)
+	uuid := "12345678-1234-1234-1234-123456789012"
+	lrprevPath := filepath.Join(tempDir, uuid+".lrprev")
+	writePyramidWithHeader(t, lrprevPath, `pyramid = { orientation = "BC", }`, withXMP)
+
+	err = Extract(lrprevPath, tempDir, "", Options{Orient: OrientEXIF})
+	assert.NoError(t, err)
+
+	extracted, err := os.ReadFile(filepath.Join(tempDir, uuid+".jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, 1, bytes.Count(extracted, []byte(metadata.ExifHeader)))
+	assert.Equal(t, 1, bytes.Count(extracted, []byte(metadata.XMPHeader)))
+	assert.Contains(t, string(extracted), "First dance")
+}
+
+func TestExtract_Template(t *testing.T) {
+	tempDir := t.TempDir()
+
+	uuid := "12345678-1234-1234-1234-123456789012"
+	dbPath := createTaggedCatalog(t, tempDir, uuid)
+	lrprevPath := filepath.Join(tempDir, uuid+".lrprev")
+	writePyramid(t, lrprevPath, minimalJPEG(160, 120), minimalJPEG(320, 240))
+
+	tmpl, err := naming.Parse("{capture:2006/01}/{basename}_{width}x{height}")
+	assert.NoError(t, err)
+	outputDir := filepath.Join(tempDir, "out")
+	err = Extract(lrprevPath, outputDir, dbPath, Options{Template: tmpl})
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(outputDir, "2025", "06", "tagged_320x240.jpg"))
+
+	// Levels rendering to the same path get numbered suffixes
+	tmpl, err = naming.Parse("flat/{uuid}")
+	assert.NoError(t, err)
+	writer, err := output.NewWriter(output.Suffix)
+	assert.NoError(t, err)
+	err = Extract(lrprevPath, outputDir, "", Options{Template: tmpl, AllLevels: true, Output: writer})
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(outputDir, "flat", uuid+".jpg"))
+	assert.FileExists(t, filepath.Join(outputDir, "flat", uuid+"-2.jpg"))
+}
+
+func TestExtract_OnConflict(t *testing.T) {
+	tempDir := t.TempDir()
+
+	uuid := "12345678-1234-1234-1234-123456789012"
+	dbPath := createTaggedCatalog(t, tempDir, uuid)
+	lrprevPath := filepath.Join(tempDir, uuid+".lrprev")
+	writePyramid(t, lrprevPath, minimalJPEG(16, 16))
+
+	outputDir := filepath.Join(tempDir, "out")
+	existing := filepath.Join(outputDir, "photos", "tagged.jpg")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(existing), os.ModePerm))
+	assert.NoError(t, os.WriteFile(existing, []byte("existing"), 0644))
+
+	// Skipped JPEGs get no sidecar either
+	writer, err := output.NewWriter(output.Skip)
+	assert.NoError(t, err)
+	err = Extract(lrprevPath, outputDir, dbPath, Options{WriteSidecar: true, Output: writer})
+	assert.NoError(t, err)
+	data, err := os.ReadFile(existing)
+	assert.NoError(t, err)
+	assert.Equal(t, "existing", string(data))
+	assert.NoFileExists(t, filepath.Join(outputDir, "photos", "tagged.xmp"))
+	assert.Len(t, writer.Conflicts(), 1)
+	assert.Equal(t, lrprevPath, writer.Conflicts()[0].Source)
+
+	// Renamed JPEGs take their sidecar along
+	writer, err = output.NewWriter(output.Suffix)
+	assert.NoError(t, err)
+	err = Extract(lrprevPath, outputDir, dbPath, Options{WriteSidecar: true, Output: writer})
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(outputDir, "photos", "tagged-2.jpg"))
+	assert.FileExists(t, filepath.Join(outputDir, "photos", "tagged-2.xmp"))
+
+	// Without a writer existing files are overwritten
+	err = Extract(lrprevPath, outputDir, dbPath, Options{})
+	assert.NoError(t, err)
+	data, err = os.ReadFile(existing)
+	assert.NoError(t, err)
+	assert.Equal(t, minimalJPEG(16, 16), data)
+}
+
+func TestExtract_TemplateCollision(t *testing.T) {
+	tempDir := t.TempDir()
+	outputDir := filepath.Join(tempDir, "out")
+	tmpl, err := naming.Parse("photo")
+	assert.NoError(t, err)
+
+	// Both previews render to photo.jpg; without a writer the second is
+	// numbered rather than replacing the first
+	first := filepath.Join(tempDir, "11111111-1234-1234-1234-123456789012.lrprev")
+	second := filepath.Join(tempDir, "22222222-1234-1234-1234-123456789012.lrprev")
+	writePyramid(t, first, minimalJPEG(8, 8))
+	writePyramid(t, second, minimalJPEG(16, 16))
+	assert.NoError(t, Extract(first, outputDir, "", Options{Template: tmpl}))
+	assert.NoError(t, Extract(second, outputDir, "", Options{Template: tmpl}))
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "photo.jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, minimalJPEG(8, 8), data)
+	data, err = os.ReadFile(filepath.Join(outputDir, "photo-2.jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, minimalJPEG(16, 16), data)
+}
+
+func TestOptions_CheckTemplate(t *testing.T) {
+	flat, err := naming.Parse("{basename}_{width}")
+	assert.NoError(t, err)
+	leveled, err := naming.Parse("{basename}_l{level}")
+	assert.NoError(t, err)
+
+	assert.NoError(t, Options{Template: flat}.CheckTemplate())
+	assert.NoError(t, Options{Template: flat, Levels: []int{2}}.CheckTemplate())
+	assert.NoError(t, Options{Template: leveled, AllLevels: true}.CheckTemplate())
+	assert.NoError(t, Options{AllLevels: true}.CheckTemplate())
+	assert.EqualError(t, Options{Template: flat, Levels: []int{1, 3}}.CheckTemplate(),
+		`template "{basename}_{width}" must contain {level} to extract several levels`)
+	assert.Error(t, Options{Template: flat, AllLevels: true}.CheckTemplate())
+}
+
+func TestExtract_DryRun(t *testing.T) {
+	tempDir := t.TempDir()
+
+	uuid := "12345678-1234-1234-1234-123456789012"
+	dbPath := createTaggedCatalog(t, tempDir, uuid)
+	lrprevPath := filepath.Join(tempDir, uuid+".lrprev")
+	writePyramid(t, lrprevPath, minimalJPEG(8, 8), minimalJPEG(16, 16))
+
+	outputDir := filepath.Join(tempDir, "out")
+	writer, err := output.NewDryRunWriter(output.Suffix)
+	assert.NoError(t, err)
+	opts := Options{AllLevels: true, IncludeSize: true, WriteSidecar: true, Orient: OrientRotate, Output: writer}
+	assert.NoError(t, Extract(lrprevPath, outputDir, dbPath, opts))
+	assert.NoError(t, Extract(lrprevPath, outputDir, dbPath, opts))
+	assert.NoDirExists(t, outputDir)
+
+	files := writer.Files()
+	assert.Len(t, files, 8)
+	assert.Equal(t, filepath.Join(outputDir, "photos", "tagged_level1_8x8.jpg"), files[0].Path)
+	assert.Equal(t, int64(len(minimalJPEG(8, 8))), files[0].Size)
+	assert.Equal(t, filepath.Join(outputDir, "photos", "tagged_level1_8x8.xmp"), files[1].Path)
+	assert.Equal(t, filepath.Join(outputDir, "photos", "tagged_level1_8x8-2.jpg"), files[4].Path)
+	assert.Len(t, writer.Conflicts(), 2)
+}
+
+func TestExtract_VirtualCopy(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Previews are named after the image id_global; both images share a file
+	masterUUID := "11111111-1111-1111-1111-111111111111"
+	copyUUID := "22222222-2222-2222-2222-222222222222"
+	dbPath := filepath.Join(tempDir, "test.lrcat")
+	db, err := sql.Open("sqlite3", dbPath)
+	assert.NoError(t, err)
+	_, err = db.Exec(`
+		CREATE TABLE AgLibraryFile (id_local INTEGER, id_global TEXT, folder INTEGER, baseName TEXT);
+		CREATE TABLE AgLibraryFolder (id_local INTEGER, rootFolder INTEGER, pathFromRoot TEXT);
+		CREATE TABLE AgLibraryRootFolder (id_local INTEGER, absolutePath TEXT);
+		CREATE TABLE Adobe_images (id_local INTEGER, id_global TEXT, rootFile INTEGER, copyName TEXT);
+		INSERT INTO AgLibraryFile VALUES (1, 'FILE-UUID', 1, 'IMG_0001');
+		INSERT INTO AgLibraryFolder VALUES (1, 1, 'shoot/');
+		INSERT INTO AgLibraryRootFolder VALUES (1, '/photos/');
+		INSERT INTO Adobe_images VALUES (5, '` + masterUUID + `', 1, NULL);
+		INSERT INTO Adobe_images VALUES (6, '` + copyUUID + `', 1, 'Copy 1');
+	`)
+	assert.NoError(t, err)
+	db.Close()
+
+	for _, uuid := range []string{masterUUID, copyUUID} {
+		lrprevPath := filepath.Join(tempDir, uuid+".lrprev")
+		writePyramid(t, lrprevPath, minimalJPEG(16, 16))
+		assert.NoError(t, Extract(lrprevPath, tempDir, dbPath, Options{}))
+	}
+
+	assert.FileExists(t, filepath.Join(tempDir, "photos", "shoot", "IMG_0001.jpg"))
+	assert.FileExists(t, filepath.Join(tempDir, "photos", "shoot", "IMG_0001_Copy 1.jpg"))
+}
+
+func TestExtract_Reporter(t *testing.T) {
+	tempDir := t.TempDir()
+
+	uuid := "12345678-1234-1234-1234-123456789012"
+	lrprevPath := filepath.Join(tempDir, uuid+".lrprev")
+	writePyramid(t, lrprevPath, minimalJPEG(16, 16))
+	outputDir := filepath.Join(tempDir, "out")
+
+	var buf bytes.Buffer
+	err := Extract(lrprevPath, outputDir, "", Options{Reporter: report.NewJSON(&buf)})
+	assert.NoError(t, err)
+
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var event report.Event
+		assert.NoError(t, json.Unmarshal([]byte(line), &event))
+		assert.Equal(t, report.EventLog, event.Event)
+		assert.Equal(t, lrprevPath, event.File)
+		messages = append(messages, string(event.Level)+": "+event.Message)
+	}
+	assert.Contains(t, messages, "debug: Reading file: "+lrprevPath)
+	assert.Contains(t, messages, "debug: JPEG image extracted and saved to "+filepath.Join(outputDir, uuid+".jpg"))
+}
+
+func TestExtract_NilReporterIsSilent(t *testing.T) {
+	tempDir := t.TempDir()
+	lrprevPath := filepath.Join(tempDir, "12345678-1234-1234-1234-123456789012.lrprev")
+	writePyramid(t, lrprevPath, minimalJPEG(16, 16))
+
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	stdout := os.Stdout
+	os.Stdout = w
+	err = Extract(lrprevPath, filepath.Join(tempDir, "out"), "", Options{})
+	os.Stdout = stdout
+	w.Close()
+	assert.NoError(t, err)
+
+	printed, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Empty(t, string(printed))
+}
+
+func TestExtract_BoundedMemory(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// A 32 MB level: headers, then scan data the extractor must not hold.
+	const scanSize = 32 << 20
+	jpegHeaders := minimalJPEG(6000, 4000)
+	level := append(jpegHeaders[:len(jpegHeaders)-2:len(jpegHeaders)-2], 0xFF, 0xDA, 0x00, 0x02)
+	level = append(level, make([]byte, scanSize)...)
+	level = append(level, 0xFF, 0xD9)
+
+	uuid := "12345678-1234-1234-1234-123456789012"
+	lrprevPath := filepath.Join(tempDir, uuid+".lrprev")
+	writePyramidWithHeader(t, lrprevPath, `pyramid = { orientation = "BC", }`, level)
+	level = nil
+
+	tests := []struct {
+		name string
+		opts Options
+		want string
+	}{
+		{"copy", Options{IncludeSize: true}, uuid + "_6000x4000.jpg"},
+		{"exif orientation", Options{Orient: OrientEXIF}, uuid + ".jpg"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputDir := filepath.Join(tempDir, tt.name)
+			tt.opts.Reporter = report.NewPlain(io.Discard)
+
+			runtime.GC()
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			err := Extract(lrprevPath, outputDir, "", tt.opts)
+			runtime.ReadMemStats(&after)
+			assert.NoError(t, err)
+
+			info, err := os.Stat(filepath.Join(outputDir, tt.want))
+			assert.NoError(t, err)
+			assert.Greater(t, info.Size(), int64(scanSize))
+			allocated := after.TotalAlloc - before.TotalAlloc
+			assert.Less(t, allocated, uint64(2<<20), "allocated %d bytes", allocated)
+		})
+	}
+}
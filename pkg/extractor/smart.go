@@ -0,0 +1,174 @@
+package extractor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image/jpeg"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"lrprev-extract-go/internal/utils"
+	"lrprev-extract-go/pkg/dng"
+	"lrprev-extract-go/pkg/output"
+	"lrprev-extract-go/pkg/report"
+)
+
+// Smart preview conversions for Options.Smart.
+const (
+	// SmartEmbedded writes the JPEG preview embedded in the DNG, decoding
+	// the DNG to a JPEG when it has none.
+	SmartEmbedded = "embedded"
+	// SmartJPEG decodes the lossy DNG to a full size JPEG.
+	SmartJPEG = "jpeg"
+	// SmartTIFF decodes the lossy DNG to a 16-bit TIFF.
+	SmartTIFF = "tiff"
+)
+
+const smartJPEGQuality = 95
+
+// ExtractSmartPreview writes a Smart Preview (a lossy DNG in Smart
+// Previews.lrdata, named by UUID) under the same catalog-based name as
+// Extract. opts.Smart selects the embedded preview or a decoded image;
+// multiple levels do not apply.
+func ExtractSmartPreview(filePath, outputDir, dbPath string, opts Options) error {
+	opts.logf(report.Debug, filePath, "Reading smart preview: %s", filePath)
+	f, err := dng.OpenFile(filePath)
+	if err != nil {
+		return fmt.Errorf("error reading smart preview: %v", err)
+	}
+	defer f.Close()
+
+	opts.logf(report.Debug, filePath, "Extracting UUID from filename")
+	uuid, err := utils.ExtractUUIDFromFilename(filePath)
+	if err != nil {
+		return err
+	}
+	target := resolveTarget(filePath, uuid, outputDir, dbPath, opts)
+	return extractSmartPreview(filePath, f, target, opts)
+}
+
+// ExtractSmartPreviewTo writes a Smart Preview to target, for callers that
+// already know where the original lives.
+func ExtractSmartPreviewTo(filePath string, target Target, opts Options) error {
+	opts.logf(report.Debug, filePath, "Reading smart preview: %s", filePath)
+	f, err := dng.OpenFile(filePath)
+	if err != nil {
+		return fmt.Errorf("error reading smart preview: %v", err)
+	}
+	defer f.Close()
+
+	return extractSmartPreview(filePath, f, target, opts)
+}
+
+func extractSmartPreview(filePath string, f *dng.File, target Target, opts Options) error {
+	if opts.Template == nil {
+		opts.logf(report.Debug, filePath, "Creating output directory: %s", target.Dir)
+		if err := opts.mkdirAll(target.Dir); err != nil {
+			return fmt.Errorf("error creating output directory: %v", err)
+		}
+	}
+	out := opts.Output
+	if out == nil {
+		out, _ = output.NewWriter(ConflictPolicy(opts.Template))
+	}
+
+	orientation := 1
+	if opts.Orient != "" && opts.Orient != OrientNone {
+		orientation = f.Orientation()
+	}
+
+	mode := opts.Smart
+	if mode == "" || mode == SmartEmbedded {
+		preview, err := f.Preview()
+		if err == nil {
+			opts.logf(report.Debug, filePath, "Writing embedded JPEG preview")
+			return writeJPEG(filePath, "embedded preview", preview, orientation, target, out, opts, func(jpegData *io.SectionReader) (string, error) {
+				width, height := 0, 0
+				if opts.IncludeSize || opts.Template != nil {
+					opts.logf(report.Debug, filePath, "Decoding JPEG dimensions")
+					config, err := jpeg.DecodeConfig(io.NewSectionReader(jpegData, 0, jpegData.Size()))
+					if err != nil {
+						return "", fmt.Errorf("error decoding JPEG dimensions: %v", err)
+					}
+					width, height = config.Width, config.Height
+				}
+				return smartOutputPath(filePath, target, width, height, ".jpg", opts)
+			})
+		}
+		if !errors.Is(err, dng.ErrNoPreview) {
+			return err
+		}
+		opts.logf(report.Warning, filePath, "No embedded preview, decoding the smart preview to JPEG instead")
+		mode = SmartJPEG
+	}
+
+	opts.logf(report.Debug, filePath, "Decoding lossy DNG")
+	img, err := f.Decode()
+	if err != nil {
+		return fmt.Errorf("error decoding smart preview: %v", err)
+	}
+	if opts.Orient == OrientRotate && orientation > 1 {
+		opts.logf(report.Debug, filePath, "Rotating image for orientation %d", orientation)
+		img = dng.Orient(img, orientation)
+		orientation = 1
+	}
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	if mode == SmartJPEG {
+		opts.logf(report.Debug, filePath, "Encoding JPEG")
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: smartJPEGQuality}); err != nil {
+			return fmt.Errorf("error encoding JPEG: %v", err)
+		}
+		data := io.NewSectionReader(bytes.NewReader(buf.Bytes()), 0, int64(buf.Len()))
+		return writeJPEG(filePath, "decoded image", data, orientation, target, out, opts, func(*io.SectionReader) (string, error) {
+			return smartOutputPath(filePath, target, width, height, ".jpg", opts)
+		})
+	}
+
+	tiffPath, err := smartOutputPath(filePath, target, width, height, ".tif", opts)
+	if err != nil {
+		return err
+	}
+	opts.logf(report.Debug, filePath, "Writing TIFF file: %s", tiffPath)
+	written, err := out.WriteStream(tiffPath, filePath, func(w io.Writer) error {
+		return dng.EncodeTIFF(w, img, orientation)
+	})
+	if err != nil {
+		return fmt.Errorf("error writing TIFF file: %v", err)
+	}
+	if written == "" {
+		opts.logf(report.Info, filePath, "Skipped %s: file already exists", tiffPath)
+		return nil
+	}
+	opts.logf(report.Debug, filePath, "TIFF image saved to %s", written)
+	return writeSidecar(filePath, written, target, out, opts)
+}
+
+// smartOutputPath names a smart preview output like outputPath names the
+// largest level, with the given extension.
+func smartOutputPath(filePath string, target Target, width, height int, ext string, opts Options) (string, error) {
+	if opts.Template == nil {
+		name := target.BaseName
+		if opts.IncludeSize {
+			name = fmt.Sprintf("%s_%dx%d", name, width, height)
+		}
+		return filepath.Join(target.Dir, name+ext), nil
+	}
+
+	fields := target.Fields
+	fields.Width, fields.Height = width, height
+	rendered := opts.Template.Render(fields)
+	if ext != ".jpg" {
+		rendered = strings.TrimSuffix(rendered, filepath.Ext(rendered)) + ext
+	}
+	path := filepath.Join(target.Root, rendered)
+
+	opts.logf(report.Debug, filePath, "Creating output directory: %s", filepath.Dir(path))
+	if err := opts.mkdirAll(filepath.Dir(path)); err != nil {
+		return "", fmt.Errorf("error creating output directory: %v", err)
+	}
+	return path, nil
+}
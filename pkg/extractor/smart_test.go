@@ -0,0 +1,179 @@
+package extractor
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"lrprev-extract-go/pkg/naming"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type tiffEntry struct {
+	tag, typ uint16
+	value    uint32
+}
+
+func appendIFD(buf []byte, next uint32, entries ...tiffEntry) []byte {
+	le := binary.LittleEndian
+	buf = le.AppendUint16(buf, uint16(len(entries)))
+	for _, e := range entries {
+		buf = le.AppendUint16(buf, e.tag)
+		buf = le.AppendUint16(buf, e.typ)
+		buf = le.AppendUint32(buf, 1)
+		if e.typ == 3 {
+			buf = le.AppendUint16(buf, uint16(e.value))
+			buf = le.AppendUint16(buf, 0)
+		} else {
+			buf = le.AppendUint32(buf, e.value)
+		}
+	}
+	return le.AppendUint32(buf, next)
+}
+
+func grayJPEG(t *testing.T, width, height int, y uint8) []byte {
+	t.Helper()
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = y
+	}
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 100}))
+	return buf.Bytes()
+}
+
+// writeSmartPreview writes a smart preview DNG: IFD0 holds the JPEG preview,
+// when given, and the orientation; its SubIFD is a 32x16 linear image stored
+// as one lossy JPEG tile.
+func writeSmartPreview(t *testing.T, path string, preview []byte, orientation int) {
+	t.Helper()
+	tile := grayJPEG(t, 32, 16, 100)
+	buf := []byte{'I', 'I', 42, 0, 0, 0, 0, 0}
+	previewOffset := len(buf)
+	buf = append(buf, preview...)
+	if len(buf)%2 == 1 {
+		buf = append(buf, 0)
+	}
+	tileOffset := len(buf)
+	buf = append(buf, tile...)
+	if len(buf)%2 == 1 {
+		buf = append(buf, 0)
+	}
+
+	rawOffset := len(buf)
+	buf = appendIFD(buf, 0,
+		tiffEntry{254, 4, 0}, tiffEntry{256, 4, 32}, tiffEntry{257, 4, 16},
+		tiffEntry{259, 3, 34892}, tiffEntry{262, 3, 34892}, tiffEntry{277, 3, 3},
+		tiffEntry{322, 4, 32}, tiffEntry{323, 4, 16},
+		tiffEntry{324, 4, uint32(tileOffset)}, tiffEntry{325, 4, uint32(len(tile))})
+
+	ifd0 := len(buf)
+	entries := []tiffEntry{{254, 4, 1}, {256, 4, 32}, {257, 4, 16}}
+	if preview != nil {
+		entries = append(entries, tiffEntry{259, 3, 7}, tiffEntry{262, 3, 6}, tiffEntry{273, 4, uint32(previewOffset)})
+	}
+	entries = append(entries, tiffEntry{274, 3, uint32(orientation)})
+	if preview != nil {
+		entries = append(entries, tiffEntry{279, 4, uint32(len(preview))})
+	}
+	entries = append(entries, tiffEntry{330, 4, uint32(rawOffset)})
+	buf = appendIFD(buf, 0, entries...)
+	binary.LittleEndian.PutUint32(buf[4:], uint32(ifd0))
+	assert.NoError(t, os.WriteFile(path, buf, 0644))
+}
+
+func TestExtractSmartPreview_Embedded(t *testing.T) {
+	tempDir := t.TempDir()
+	uuid := "12345678-1234-1234-1234-123456789012"
+	dbPath := createTaggedCatalog(t, tempDir, uuid)
+	preview := grayJPEG(t, 32, 16, 200)
+	dngPath := filepath.Join(tempDir, uuid+".dng")
+	writeSmartPreview(t, dngPath, preview, 6)
+
+	err := ExtractSmartPreview(dngPath, tempDir, dbPath, Options{WriteSidecar: true})
+	assert.NoError(t, err)
+	extracted, err := os.ReadFile(filepath.Join(tempDir, "photos", "tagged.jpg"))
+	assert.NoError(t, err)
+	assert.Equal(t, preview, extracted)
+	assert.FileExists(t, filepath.Join(tempDir, "photos", "tagged.xmp"))
+
+	err = ExtractSmartPreview(dngPath, tempDir, dbPath, Options{Orient: OrientEXIF, IncludeSize: true})
+	assert.NoError(t, err)
+	extracted, err = os.ReadFile(filepath.Join(tempDir, "photos", "tagged_32x16.jpg"))
+	assert.NoError(t, err)
+	orientationTag := []byte{0x12, 0x01, 0x03, 0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x00}
+	assert.True(t, bytes.Contains(extracted, orientationTag))
+}
+
+func TestExtractSmartPreview_Decode(t *testing.T) {
+	tempDir := t.TempDir()
+	uuid := "12345678-1234-1234-1234-123456789012"
+	dngPath := filepath.Join(tempDir, uuid+".dng")
+	writeSmartPreview(t, dngPath, nil, 6)
+
+	// Without an embedded preview the image is decoded to a JPEG.
+	err := ExtractSmartPreview(dngPath, tempDir, "", Options{IncludeSize: true})
+	assert.NoError(t, err)
+	f, err := os.Open(filepath.Join(tempDir, uuid+"_32x16.jpg"))
+	assert.NoError(t, err)
+	decoded, err := jpeg.Decode(f)
+	f.Close()
+	assert.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 32, 16), decoded.Bounds())
+	r, _, _, _ := decoded.At(5, 5).RGBA()
+	assert.Greater(t, r, uint32(0))
+
+	err = ExtractSmartPreview(dngPath, tempDir, "", Options{Smart: SmartTIFF, IncludeSize: true, Orient: OrientRotate})
+	assert.NoError(t, err)
+	tiff, err := os.ReadFile(filepath.Join(tempDir, uuid+"_16x32.tif"))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{'I', 'I', 42, 0}, tiff[:4])
+	assert.Len(t, tiff, 8+2+10*12+4+6+16*32*6)
+}
+
+func TestExtractSmartPreview_Template(t *testing.T) {
+	tempDir := t.TempDir()
+	uuid := "12345678-1234-1234-1234-123456789012"
+	dbPath := createTaggedCatalog(t, tempDir, uuid)
+	dngPath := filepath.Join(tempDir, uuid+".dng")
+	writeSmartPreview(t, dngPath, grayJPEG(t, 32, 16, 200), 1)
+
+	tmpl, err := naming.Parse("{capture:2006}/{basename}_{width}")
+	assert.NoError(t, err)
+	outputDir := filepath.Join(tempDir, "out")
+	err = ExtractSmartPreview(dngPath, outputDir, dbPath, Options{Template: tmpl, Smart: SmartTIFF})
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(outputDir, "2025", "tagged_32.tif"))
+
+	err = ExtractSmartPreview(dngPath, outputDir, dbPath, Options{Template: tmpl})
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(outputDir, "2025", "tagged_32.jpg"))
+}
+
+func TestExtractSmartPreviewTo(t *testing.T) {
+	tempDir := t.TempDir()
+	dngPath := filepath.Join(tempDir, "12345678-1234-1234-1234-123456789012.dng")
+	writeSmartPreview(t, dngPath, nil, 1)
+
+	target := Target{Dir: filepath.Join(tempDir, "photos", "2024"), BaseName: "IMG_0001"}
+	err := ExtractSmartPreviewTo(dngPath, target, Options{Smart: SmartJPEG})
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(tempDir, "photos", "2024", "IMG_0001.jpg"))
+
+	err = ExtractSmartPreviewTo(filepath.Join(tempDir, "missing.dng"), target, Options{})
+	assert.ErrorContains(t, err, "error reading smart preview")
+}
+
+func TestExtractSmartPreview_Invalid(t *testing.T) {
+	tempDir := t.TempDir()
+	dngPath := filepath.Join(tempDir, "12345678-1234-1234-1234-123456789012.dng")
+	assert.NoError(t, os.WriteFile(dngPath, []byte("not a DNG"), 0644))
+
+	err := ExtractSmartPreview(dngPath, tempDir, "", Options{})
+	assert.ErrorContains(t, err, "error reading smart preview")
+}
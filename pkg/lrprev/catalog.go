@@ -0,0 +1,113 @@
+package lrprev
+
+import (
+	"lrprev-extract-go/internal/database"
+	"lrprev-extract-go/pkg/metadata"
+)
+
+// Catalog resolves preview UUIDs to the location of their originals in a
+// Lightroom catalog (.lrcat). The catalog is opened read-only once and is safe
+// for concurrent use.
+type Catalog struct {
+	catalog *database.Catalog
+}
+
+// Location is where the original of a preview lives. Dir is relative to the
+// filesystem root so it can be nested under an output directory.
+type Location struct {
+	UUID string
+	Dir  string
+	// BaseName includes the copy name for virtual copies, e.g.
+	// "IMG_0001_Copy 1", so each copy gets its own output file.
+	BaseName string
+	CopyName string
+}
+
+// ImageInfo holds catalog details used to name output files.
+type ImageInfo struct {
+	// Extension is the original's file extension without the dot.
+	Extension string
+	// Collections lists the collections holding the image, sorted.
+	Collections []string
+}
+
+func OpenCatalog(path string) (*Catalog, error) {
+	catalog, err := database.OpenCatalog(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Catalog{catalog: catalog}, nil
+}
+
+// ResolvePath returns the directory of the original relative to the
+// filesystem root and its base name without extension.
+func (c *Catalog) ResolvePath(uuid string) (string, string, error) {
+	location, err := c.catalog.Lookup(uuid)
+	if err != nil {
+		return "", "", err
+	}
+	return location.Dir, location.BaseName, nil
+}
+
+// ResolveImageID resolves an image by its Adobe_images id_local, as stored
+// in the imageId column of previews.db.
+func (c *Catalog) ResolveImageID(id int64) (Location, error) {
+	location, err := c.catalog.LookupImageID(id)
+	if err != nil {
+		return Location{}, err
+	}
+	return Location(location), nil
+}
+
+// ImageIDs returns the id_local of every image in the catalog.
+func (c *Catalog) ImageIDs() (map[int64]bool, error) {
+	return c.catalog.ImageIDs()
+}
+
+// Metadata returns the capture, camera, GPS and IPTC metadata the catalog
+// holds for the image of a preview UUID. Unreadable develop settings give
+// an error wrapping metadata.ErrDevelop along with the rest of the metadata.
+func (c *Catalog) Metadata(uuid string) (metadata.Metadata, error) {
+	return c.catalog.Metadata(uuid)
+}
+
+// ImageInfo returns the original's extension and the collections of the
+// image of a preview UUID.
+func (c *Catalog) ImageInfo(uuid string) (ImageInfo, error) {
+	info, err := c.catalog.ImageInfo(uuid)
+	if err != nil {
+		return ImageInfo{}, err
+	}
+	return ImageInfo(info), nil
+}
+
+// ResolvePaths resolves many UUIDs with batched queries. UUIDs that are not in
+// the catalog are absent from the result.
+func (c *Catalog) ResolvePaths(uuids []string) (map[string]Location, error) {
+	found, err := c.catalog.LookupMany(uuids)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]Location, len(found))
+	for uuid, location := range found {
+		result[uuid] = Location(location)
+	}
+	return result, nil
+}
+
+// Preload reads every location into memory so later lookups do not query the
+// database. It suits runs that touch most of the catalog.
+func (c *Catalog) Preload() error {
+	return c.catalog.LoadAll()
+}
+
+// Unload lets lookups of locations Preload did not see query the database
+// again, for images imported after it ran.
+func (c *Catalog) Unload() {
+	c.catalog.Unload()
+}
+
+func (c *Catalog) Close() error {
+	return c.catalog.Close()
+}
@@ -0,0 +1,132 @@
+package lrprev
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"lrprev-extract-go/internal/lua"
+)
+
+// maxHeaderSize guards against reading a corrupt length into memory.
+const maxHeaderSize = 1 << 20
+
+type LevelInfo struct {
+	Width   int
+	Height  int
+	Quality string
+}
+
+// Header is the Lua table stored in the "header" section of a preview.
+type Header struct {
+	UUID          string
+	Digest        string
+	Orientation   string
+	ColorProfile  string
+	Quality       string
+	FromProxy     bool
+	CroppedWidth  int
+	CroppedHeight int
+	FileTimeStamp float64
+	FormatVersion int
+	Levels        []LevelInfo
+	// Fields holds the raw table, including keys not mapped above.
+	Fields map[string]interface{}
+}
+
+func ParseHeader(data []byte) (*Header, error) {
+	values, err := lua.Parse(string(bytes.TrimRight(data, "\x00")))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing preview header: %v", err)
+	}
+
+	var table *lua.Table
+	for _, name := range []string{"pyramid", "preview", "return"} {
+		if t, ok := values[name].(*lua.Table); ok {
+			table = t
+			break
+		}
+	}
+	if table == nil {
+		for _, v := range values {
+			if t, ok := v.(*lua.Table); ok {
+				table = t
+				break
+			}
+		}
+	}
+	if table == nil {
+		return nil, fmt.Errorf("error parsing preview header: no table found")
+	}
+
+	header := &Header{
+		UUID:          table.String("uuid"),
+		Digest:        table.String("digest"),
+		Orientation:   table.String("orientation"),
+		ColorProfile:  table.String("colorProfile"),
+		Quality:       table.String("quality"),
+		FromProxy:     table.Bool("fromProxy"),
+		CroppedWidth:  table.Int("croppedWidth"),
+		CroppedHeight: table.Int("croppedHeight"),
+		FileTimeStamp: table.Number("fileTimeStamp"),
+		FormatVersion: table.Int("formatVersion"),
+		Fields:        table.Fields,
+	}
+
+	if levels := table.Table("levels"); levels != nil {
+		for _, v := range levels.Array {
+			level, ok := v.(*lua.Table)
+			if !ok {
+				continue
+			}
+			header.Levels = append(header.Levels, LevelInfo{
+				Width:   level.Int("width"),
+				Height:  level.Int("height"),
+				Quality: level.String("quality"),
+			})
+		}
+	}
+	return header, nil
+}
+
+// exifOrientations maps Lightroom orientation codes to EXIF Orientation
+// values. AB is upright; BC, CD and DA are turned by 90, 180 and 270 degrees
+// and the reversed codes are their mirror images.
+var exifOrientations = map[string]int{
+	"AB": 1,
+	"BA": 2,
+	"CD": 3,
+	"DC": 4,
+	"AD": 5,
+	"BC": 6,
+	"CB": 7,
+	"DA": 8,
+}
+
+// ExifOrientation returns the EXIF Orientation value for a Lightroom
+// orientation code, and false for codes it does not know. An empty code means
+// upright.
+func ExifOrientation(code string) (int, bool) {
+	if code == "" {
+		return 1, true
+	}
+	value, ok := exifOrientations[strings.ToUpper(code)]
+	return value, ok
+}
+
+func ReadHeader(r io.ReaderAt, sections Sections) (*Header, error) {
+	section, ok := sections.Header()
+	if !ok {
+		return nil, fmt.Errorf("no header section found")
+	}
+	if section.Length > maxHeaderSize {
+		return nil, fmt.Errorf("header section too large: %d bytes", section.Length)
+	}
+
+	data := make([]byte, section.Length)
+	if _, err := r.ReadAt(data, section.DataOffset); err != nil {
+		return nil, fmt.Errorf("error reading header section: %v", err)
+	}
+	return ParseHeader(data)
+}
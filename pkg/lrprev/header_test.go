@@ -0,0 +1,90 @@
+package lrprev
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const sampleHeader = `pyramid = {
+	colorProfile = "AgColorProfileCode 1fec4f0e",
+	croppedHeight = 4000,
+	croppedWidth = 6000,
+	digest = "7a8d5a2ed05f0d59c9b2e5b4c0e2b0a8",
+	fileTimeStamp = 591826357.25,
+	formatVersion = 3,
+	fromProxy = false,
+	levels = {
+		{
+			height = 80,
+			width = 120,
+		},
+		{
+			height = 2000,
+			quality = "standard",
+			width = 3000,
+		},
+	},
+	orientation = "BC",
+	quality = "standard",
+	uuid = "A1B2C3D4-1234-5678-9ABC-DEF012345678",
+}
+`
+
+func TestParseHeader(t *testing.T) {
+	header, err := ParseHeader([]byte(sampleHeader + "\x00\x00"))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "A1B2C3D4-1234-5678-9ABC-DEF012345678", header.UUID)
+	assert.Equal(t, "7a8d5a2ed05f0d59c9b2e5b4c0e2b0a8", header.Digest)
+	assert.Equal(t, "BC", header.Orientation)
+	assert.Equal(t, "AgColorProfileCode 1fec4f0e", header.ColorProfile)
+	assert.Equal(t, "standard", header.Quality)
+	assert.False(t, header.FromProxy)
+	assert.Equal(t, 6000, header.CroppedWidth)
+	assert.Equal(t, 4000, header.CroppedHeight)
+	assert.Equal(t, 591826357.25, header.FileTimeStamp)
+	assert.Equal(t, 3, header.FormatVersion)
+	assert.Equal(t, []LevelInfo{
+		{Width: 120, Height: 80},
+		{Width: 3000, Height: 2000, Quality: "standard"},
+	}, header.Levels)
+}
+
+func TestParseHeader_Errors(t *testing.T) {
+	_, err := ParseHeader([]byte(`version = 3`))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no table found")
+
+	_, err = ParseHeader([]byte(`pyramid = {`))
+	assert.Error(t, err)
+}
+
+func TestExifOrientation(t *testing.T) {
+	for code, want := range map[string]int{"": 1, "AB": 1, "BC": 6, "CD": 3, "DA": 8, "BA": 2, "dc": 4} {
+		got, ok := ExifOrientation(code)
+		assert.True(t, ok, code)
+		assert.Equal(t, want, got, code)
+	}
+	_, ok := ExifOrientation("XY")
+	assert.False(t, ok)
+}
+
+func TestReadHeader(t *testing.T) {
+	var buf bytes.Buffer
+	assert.NoError(t, WriteSection(&buf, "header", []byte(sampleHeader), 5))
+	assert.NoError(t, WriteSection(&buf, "level_1", []byte{0xFF, 0xD8, 0xFF, 0xD9}, 0))
+
+	r := bytes.NewReader(buf.Bytes())
+	sections, err := ParseSections(r, int64(buf.Len()))
+	assert.NoError(t, err)
+
+	header, err := ReadHeader(r, sections)
+	assert.NoError(t, err)
+	assert.Equal(t, "A1B2C3D4-1234-5678-9ABC-DEF012345678", header.UUID)
+
+	_, err = ReadHeader(r, sections.Levels())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no header section found")
+}
@@ -0,0 +1,193 @@
+// Package lrprev reads Adobe Lightroom preview files (.lrprev) and resolves
+// them against a Lightroom catalog.
+//
+//	f, err := lrprev.OpenFile("A1B2C3D4-....lrprev")
+//	if err != nil { ... }
+//	defer f.Close()
+//	largest, _ := f.Largest()
+//	_, err = f.WriteLevel(w, largest.Number)
+package lrprev
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// A .lrprev file is a sequence of sections, each introduced by an AgHg header:
+//
+//	magic       [4]byte "AgHg"
+//	headerLen   uint16  length of the whole header, name included
+//	version     uint8
+//	kind        uint8
+//	dataLen     uint64  length of the section payload
+//	paddingLen  uint64  zero bytes following the payload
+//	name        [headerLen-24]byte, NUL padded
+//
+// All integers are big-endian. The first section is normally "header" (a Lua
+// table describing the preview) followed by "level_1".."level_N" JPEG payloads
+// in increasing resolution.
+const (
+	Magic          = "AgHg"
+	fixedHeaderLen = 24
+)
+
+type Section struct {
+	Name       string
+	Version    uint8
+	Kind       uint8
+	Offset     int64
+	DataOffset int64
+	Length     int64
+	Padding    int64
+}
+
+// Level returns the pyramid level of a "level_N" section.
+func (s Section) Level() (int, bool) {
+	if !strings.HasPrefix(s.Name, "level_") {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(s.Name, "level_"))
+	if err != nil || n < 1 {
+		return 0, false
+	}
+	return n, true
+}
+
+func (s Section) End() int64 {
+	return s.DataOffset + s.Length + s.Padding
+}
+
+func (s Section) Reader(r io.ReaderAt) *io.SectionReader {
+	return io.NewSectionReader(r, s.DataOffset, s.Length)
+}
+
+type Sections []Section
+
+func (ss Sections) Find(name string) (Section, bool) {
+	for _, s := range ss {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return Section{}, false
+}
+
+func (ss Sections) Header() (Section, bool) {
+	return ss.Find("header")
+}
+
+// Levels returns the level sections ordered from smallest to largest.
+func (ss Sections) Levels() Sections {
+	var levels Sections
+	for _, s := range ss {
+		if _, ok := s.Level(); ok {
+			levels = append(levels, s)
+		}
+	}
+	sort.SliceStable(levels, func(i, j int) bool {
+		a, _ := levels[i].Level()
+		b, _ := levels[j].Level()
+		return a < b
+	})
+	return levels
+}
+
+func (ss Sections) Largest() (Section, bool) {
+	levels := ss.Levels()
+	if len(levels) == 0 {
+		return Section{}, false
+	}
+	return levels[len(levels)-1], true
+}
+
+func ParseSections(r io.ReaderAt, size int64) (Sections, error) {
+	var sections Sections
+	var offset int64
+	for offset < size {
+		section, err := readSection(r, offset, size)
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, section)
+		offset = section.End()
+	}
+	if len(sections) == 0 {
+		return nil, fmt.Errorf("no AgHg sections found")
+	}
+	return sections, nil
+}
+
+func readSection(r io.ReaderAt, offset, size int64) (Section, error) {
+	if size-offset < fixedHeaderLen {
+		return Section{}, fmt.Errorf("truncated section header at offset %d", offset)
+	}
+
+	fixed := make([]byte, fixedHeaderLen)
+	if _, err := r.ReadAt(fixed, offset); err != nil {
+		return Section{}, fmt.Errorf("error reading section header at offset %d: %v", offset, err)
+	}
+	if string(fixed[0:4]) != Magic {
+		return Section{}, fmt.Errorf("missing AgHg magic at offset %d", offset)
+	}
+
+	headerLen := int64(binary.BigEndian.Uint16(fixed[4:6]))
+	if headerLen < fixedHeaderLen || offset+headerLen > size {
+		return Section{}, fmt.Errorf("invalid section header length %d at offset %d", headerLen, offset)
+	}
+
+	dataLen := binary.BigEndian.Uint64(fixed[8:16])
+	paddingLen := binary.BigEndian.Uint64(fixed[16:24])
+	remaining := uint64(size - offset - headerLen)
+	if dataLen > remaining || paddingLen > remaining-dataLen {
+		return Section{}, fmt.Errorf("section at offset %d extends past end of file", offset)
+	}
+
+	name := make([]byte, headerLen-fixedHeaderLen)
+	if len(name) > 0 {
+		if _, err := r.ReadAt(name, offset+fixedHeaderLen); err != nil {
+			return Section{}, fmt.Errorf("error reading section name at offset %d: %v", offset, err)
+		}
+	}
+	if i := strings.IndexByte(string(name), 0); i >= 0 {
+		name = name[:i]
+	}
+
+	return Section{
+		Name:       string(name),
+		Version:    fixed[6],
+		Kind:       fixed[7],
+		Offset:     offset,
+		DataOffset: offset + headerLen,
+		Length:     int64(dataLen),
+		Padding:    int64(paddingLen),
+	}, nil
+}
+
+// WriteSection writes a single AgHg section with a 32 byte header.
+func WriteSection(w io.Writer, name string, data []byte, padding int64) error {
+	const headerLen = 32
+	if len(name) > headerLen-fixedHeaderLen {
+		return fmt.Errorf("section name too long: %s", name)
+	}
+
+	header := make([]byte, headerLen)
+	copy(header[0:4], Magic)
+	binary.BigEndian.PutUint16(header[4:6], headerLen)
+	header[6] = 1
+	binary.BigEndian.PutUint64(header[8:16], uint64(len(data)))
+	binary.BigEndian.PutUint64(header[16:24], uint64(padding))
+	copy(header[fixedHeaderLen:], name)
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	_, err := w.Write(make([]byte, padding))
+	return err
+}
@@ -0,0 +1,92 @@
+package lrprev
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func buildFile(t *testing.T, sections ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	for i, s := range sections {
+		err := WriteSection(&buf, s[0], []byte(s[1]), int64(i))
+		assert.NoError(t, err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseSections(t *testing.T) {
+	data := buildFile(t,
+		[2]string{"header", "preview = {}"},
+		[2]string{"level_2", "\xFF\xD8second\xFF\xD9"},
+		[2]string{"level_1", "\xFF\xD8first\xFF\xD9"},
+	)
+
+	sections, err := ParseSections(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+	assert.Len(t, sections, 3)
+
+	header, ok := sections.Header()
+	assert.True(t, ok)
+	assert.Equal(t, int64(0), header.Offset)
+	assert.Equal(t, int64(32), header.DataOffset)
+	assert.Equal(t, int64(len("preview = {}")), header.Length)
+
+	levels := sections.Levels()
+	assert.Len(t, levels, 2)
+	assert.Equal(t, "level_1", levels[0].Name)
+	assert.Equal(t, "level_2", levels[1].Name)
+	assert.Equal(t, int64(2), levels[0].Padding)
+
+	largest, ok := sections.Largest()
+	assert.True(t, ok)
+	payload, err := io.ReadAll(largest.Reader(bytes.NewReader(data)))
+	assert.NoError(t, err)
+	assert.Equal(t, "\xFF\xD8second\xFF\xD9", string(payload))
+}
+
+func TestSectionLevel(t *testing.T) {
+	tests := []struct {
+		name  string
+		level int
+		ok    bool
+	}{
+		{"level_1", 1, true},
+		{"level_12", 12, true},
+		{"level_0", 0, false},
+		{"level_x", 0, false},
+		{"header", 0, false},
+	}
+
+	for _, tt := range tests {
+		level, ok := Section{Name: tt.name}.Level()
+		assert.Equal(t, tt.level, level, tt.name)
+		assert.Equal(t, tt.ok, ok, tt.name)
+	}
+}
+
+func TestParseSections_Errors(t *testing.T) {
+	valid := buildFile(t, [2]string{"header", "preview = {}"})
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr string
+	}{
+		{"empty", nil, "no AgHg sections found"},
+		{"bad magic", []byte("not an lrprev file with enough bytes"), "missing AgHg magic"},
+		{"truncated header", valid[:10], "truncated section header"},
+		{"truncated data", valid[:len(valid)-3], "extends past end of file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSections(bytes.NewReader(tt.data), int64(len(tt.data)))
+			assert.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
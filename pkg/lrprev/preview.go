@@ -0,0 +1,180 @@
+package lrprev
+
+import (
+	"fmt"
+	"image"
+	"image/jpeg"
+	"io"
+	"os"
+	"path/filepath"
+
+	"lrprev-extract-go/internal/utils"
+)
+
+// Preview is an opened .lrprev file backed by an io.ReaderAt. Levels are read
+// on demand, so a Preview never holds image data in memory; only the header
+// and level table parsed by Open are kept.
+type Preview struct {
+	r         io.ReaderAt
+	size      int64
+	sections  Sections
+	header    *Header
+	headerErr error
+	levels    []Level
+}
+
+// Level is one JPEG in the preview pyramid. Width and Height come from the
+// preview header and are zero when the header does not list the level.
+type Level struct {
+	Number  int
+	Width   int
+	Height  int
+	Section Section
+}
+
+func (l Level) Size() int64 {
+	return l.Section.Length
+}
+
+// Open parses the section table and header of the preview stored in r. A
+// missing or malformed header is not an error here; it is returned by Header.
+func Open(r io.ReaderAt, size int64) (*Preview, error) {
+	sections, err := ParseSections(r, size)
+	if err != nil {
+		return nil, err
+	}
+	p := &Preview{r: r, size: size, sections: sections}
+	p.header, p.headerErr = ReadHeader(r, sections)
+	p.levels = p.readLevels()
+	return p, nil
+}
+
+func (p *Preview) Sections() Sections {
+	return p.sections
+}
+
+// Header returns the Lua header section parsed by Open.
+func (p *Preview) Header() (*Header, error) {
+	return p.header, p.headerErr
+}
+
+// UUID returns the uuid recorded in the header, so renamed or copied previews
+// still resolve, and falls back to the one in the file name.
+func (p *Preview) UUID(name string) (string, error) {
+	if p.header != nil && p.header.UUID != "" {
+		return p.header.UUID, nil
+	}
+	return utils.ExtractUUIDFromFilename(filepath.Base(name))
+}
+
+// Levels lists the pyramid levels from smallest to largest.
+func (p *Preview) Levels() []Level {
+	return append([]Level(nil), p.levels...)
+}
+
+func (p *Preview) readLevels() []Level {
+	var infos []LevelInfo
+	if p.header != nil {
+		infos = p.header.Levels
+	}
+
+	var levels []Level
+	for _, s := range p.sections.Levels() {
+		n, _ := s.Level()
+		level := Level{Number: n, Section: s}
+		if n <= len(infos) {
+			level.Width = infos[n-1].Width
+			level.Height = infos[n-1].Height
+		}
+		levels = append(levels, level)
+	}
+	return levels
+}
+
+func (p *Preview) Level(n int) (Level, bool) {
+	for _, level := range p.levels {
+		if level.Number == n {
+			return level, true
+		}
+	}
+	return Level{}, false
+}
+
+func (p *Preview) Largest() (Level, bool) {
+	if len(p.levels) == 0 {
+		return Level{}, false
+	}
+	return p.levels[len(p.levels)-1], true
+}
+
+// OpenLevel returns a reader over the JPEG payload of level n.
+func (p *Preview) OpenLevel(n int) (*io.SectionReader, error) {
+	level, ok := p.Level(n)
+	if !ok {
+		return nil, fmt.Errorf("level %d not found", n)
+	}
+	return level.Section.Reader(p.r), nil
+}
+
+// WriteLevel streams the JPEG payload of level n to w.
+func (p *Preview) WriteLevel(w io.Writer, n int) (int64, error) {
+	r, err := p.OpenLevel(n)
+	if err != nil {
+		return 0, err
+	}
+	return io.Copy(w, r)
+}
+
+// LevelConfig decodes the dimensions of level n from its JPEG headers.
+func (p *Preview) LevelConfig(n int) (image.Config, error) {
+	r, err := p.OpenLevel(n)
+	if err != nil {
+		return image.Config{}, err
+	}
+	config, err := jpeg.DecodeConfig(r)
+	if err != nil {
+		return image.Config{}, fmt.Errorf("error decoding JPEG dimensions: %v", err)
+	}
+	return config, nil
+}
+
+// File is a Preview read from disk. Close releases the underlying file.
+type File struct {
+	*Preview
+	f *os.File
+}
+
+func OpenFile(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	preview, err := Open(f, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &File{Preview: preview, f: f}, nil
+}
+
+// FileUUID is Preview.UUID for the file at path. Files that cannot be read as
+// previews, such as smart preview DNGs, fall back to the file name.
+func FileUUID(path string) (string, error) {
+	f, err := OpenFile(path)
+	if err != nil {
+		return utils.ExtractUUIDFromFilename(filepath.Base(path))
+	}
+	defer f.Close()
+	return f.UUID(path)
+}
+
+func (f *File) Close() error {
+	return f.f.Close()
+}
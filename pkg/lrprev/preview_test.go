@@ -0,0 +1,156 @@
+package lrprev
+
+import (
+	"bytes"
+	"database/sql"
+	"image"
+	"image/jpeg"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+)
+
+func encodeJPEG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height)), nil))
+	return buf.Bytes()
+}
+
+func buildPreview(t *testing.T) ([]byte, []byte) {
+	t.Helper()
+	tinyJPEG := encodeJPEG(t, 48, 32)
+	var buf bytes.Buffer
+	assert.NoError(t, WriteSection(&buf, "header", []byte(`pyramid = { uuid = "U", levels = { { width = 24, height = 16 }, { width = 48, height = 32 } } }`), 3))
+	assert.NoError(t, WriteSection(&buf, "level_1", []byte{0xFF, 0xD8, 0x01, 0xFF, 0xD9}, 1))
+	assert.NoError(t, WriteSection(&buf, "level_2", tinyJPEG, 0))
+	return buf.Bytes(), tinyJPEG
+}
+
+func TestPreview(t *testing.T) {
+	data, tinyJPEG := buildPreview(t)
+	p, err := Open(bytes.NewReader(data), int64(len(data)))
+	assert.NoError(t, err)
+
+	header, err := p.Header()
+	assert.NoError(t, err)
+	assert.Equal(t, "U", header.UUID)
+
+	levels := p.Levels()
+	assert.Len(t, levels, 2)
+	assert.Equal(t, Level{Number: 1, Width: 24, Height: 16, Section: levels[0].Section}, levels[0])
+	assert.Equal(t, int64(5), levels[0].Size())
+
+	largest, ok := p.Largest()
+	assert.True(t, ok)
+	assert.Equal(t, 2, largest.Number)
+
+	var out bytes.Buffer
+	n, err := p.WriteLevel(&out, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(len(tinyJPEG)), n)
+	assert.Equal(t, tinyJPEG, out.Bytes())
+
+	config, err := p.LevelConfig(2)
+	assert.NoError(t, err)
+	assert.Equal(t, 48, config.Width)
+	assert.Equal(t, 32, config.Height)
+
+	_, err = p.WriteLevel(&out, 3)
+	assert.Error(t, err)
+}
+
+func TestFileUUID(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	assert.NoError(t, WriteSection(&buf, "header", []byte(`pyramid = { uuid = "A1B2C3D4-0000-0000-0000-000000000001" }`), 0))
+	renamed := filepath.Join(dir, "B9F01234-0000-0000-0000-000000000002-copy.lrprev")
+	assert.NoError(t, os.WriteFile(renamed, buf.Bytes(), 0644))
+	smart := filepath.Join(dir, "C0FFEE00-0000-0000-0000-000000000003.dng")
+	assert.NoError(t, os.WriteFile(smart, []byte("II*\x00"), 0644))
+
+	uuid, err := FileUUID(renamed)
+	assert.NoError(t, err)
+	assert.Equal(t, "A1B2C3D4-0000-0000-0000-000000000001", uuid)
+
+	uuid, err = FileUUID(smart)
+	assert.NoError(t, err)
+	assert.Equal(t, "C0FFEE00-0000-0000-0000-000000000003", uuid)
+
+	_, err = FileUUID(filepath.Join(dir, "missing.lrprev"))
+	assert.Error(t, err)
+}
+
+type countingReader struct {
+	r     *bytes.Reader
+	reads int
+}
+
+func (c *countingReader) ReadAt(p []byte, off int64) (int, error) {
+	c.reads++
+	return c.r.ReadAt(p, off)
+}
+
+func TestPreview_ParsedOnce(t *testing.T) {
+	data, _ := buildPreview(t)
+	r := &countingReader{r: bytes.NewReader(data)}
+	p, err := Open(r, int64(len(data)))
+	assert.NoError(t, err)
+
+	reads := r.reads
+	for i := 0; i < 3; i++ {
+		_, err := p.Header()
+		assert.NoError(t, err)
+		assert.Len(t, p.Levels(), 2)
+		_, ok := p.Largest()
+		assert.True(t, ok)
+		_, ok = p.Level(1)
+		assert.True(t, ok)
+	}
+	assert.Equal(t, reads, r.reads)
+
+	// Callers cannot change the cached levels
+	p.Levels()[0].Width = 1
+	level, _ := p.Level(1)
+	assert.Equal(t, 24, level.Width)
+}
+
+func TestCatalog(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "catalog.lrcat")
+	db, err := sql.Open("sqlite3", dbPath)
+	assert.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec(`
+		CREATE TABLE AgLibraryFile (id_global TEXT, folder INTEGER, baseName TEXT);
+		CREATE TABLE AgLibraryFolder (id_local INTEGER, rootFolder INTEGER, pathFromRoot TEXT);
+		CREATE TABLE AgLibraryRootFolder (id_local INTEGER, absolutePath TEXT);
+		INSERT INTO AgLibraryFile VALUES ('U', 1, 'IMG_0001');
+		INSERT INTO AgLibraryFolder VALUES (1, 1, '2024/');
+		INSERT INTO AgLibraryRootFolder VALUES (1, '/photos/');
+	`)
+	assert.NoError(t, err)
+
+	catalog, err := OpenCatalog(dbPath)
+	assert.NoError(t, err)
+	defer catalog.Close()
+
+	dir, baseName, err := catalog.ResolvePath("U")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join("photos", "2024"), dir)
+	assert.Equal(t, "IMG_0001", baseName)
+
+	found, err := catalog.ResolvePaths([]string{"U", "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]Location{"U": {UUID: "U", Dir: filepath.Join("photos", "2024"), BaseName: "IMG_0001"}}, found)
+
+	assert.NoError(t, catalog.Preload())
+	_, _, err = catalog.ResolvePath("missing")
+	assert.Error(t, err)
+
+	_, err = OpenCatalog(filepath.Join(t.TempDir(), "missing.lrcat"))
+	assert.Error(t, err)
+}
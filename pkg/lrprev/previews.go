@@ -0,0 +1,57 @@
+package lrprev
+
+import (
+	"lrprev-extract-go/internal/database"
+)
+
+// PreviewIndex is the content of a Previews.lrdata/previews.db, which links
+// preview UUIDs to the images of the catalog.
+type PreviewIndex struct {
+	index *database.PreviewIndex
+}
+
+// PreviewEntry is the previews.db record of a preview. ImageID is the
+// id_local of its image in the catalog.
+type PreviewEntry struct {
+	ImageID        int64
+	UUID           string
+	Digest         string
+	Orientation    string
+	PyramidDigest  string
+	HasPyramidInfo bool
+}
+
+func OpenPreviewIndex(path string) (*PreviewIndex, error) {
+	index, err := database.OpenPreviewIndex(path)
+	if err != nil {
+		return nil, err
+	}
+	return &PreviewIndex{index: index}, nil
+}
+
+// FindPreviewIndex looks for the previews.db of the previews at path.
+func FindPreviewIndex(path string) (string, bool) {
+	return database.FindPreviewIndex(path)
+}
+
+func (p *PreviewIndex) Lookup(uuid string) (PreviewEntry, bool) {
+	entry, ok := p.index.Lookup(uuid)
+	return PreviewEntry(entry), ok
+}
+
+// Entries returns every entry ordered by image id.
+func (p *PreviewIndex) Entries() []PreviewEntry {
+	entries := p.index.Entries()
+	result := make([]PreviewEntry, len(entries))
+	for i, entry := range entries {
+		result[i] = PreviewEntry(entry)
+	}
+	return result
+}
+
+// IsOrphan reports whether no image refers to the preview with this uuid.
+// When imageIDs from the catalog are given, entries pointing at an image
+// that no longer exists count as orphans too.
+func (p *PreviewIndex) IsOrphan(uuid string, imageIDs map[int64]bool) bool {
+	return p.index.IsOrphan(uuid, imageIDs)
+}
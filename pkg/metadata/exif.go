@@ -0,0 +1,223 @@
+package metadata
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// ExifHeader prefixes the TIFF structure inside an APP1 segment.
+const ExifHeader = "Exif\x00\x00"
+
+const (
+	typeByte      = 1
+	typeASCII     = 2
+	typeShort     = 3
+	typeLong      = 4
+	typeRational  = 5
+	typeUndefined = 7
+)
+
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagDateTime         = 0x0132
+	tagArtist           = 0x013B
+	tagCopyright        = 0x8298
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagExposureTime     = 0x829A
+	tagFNumber          = 0x829D
+	tagISO              = 0x8827
+	tagExifVersion      = 0x9000
+	tagDateTimeOriginal = 0x9003
+	tagFocalLength      = 0x920A
+	tagLensModel        = 0xA434
+	tagGPSVersionID     = 0x0000
+	tagGPSLatitudeRef   = 0x0001
+	tagGPSLatitude      = 0x0002
+	tagGPSLongitudeRef  = 0x0003
+	tagGPSLongitude     = 0x0004
+)
+
+var byteOrder = binary.LittleEndian
+
+type ifdEntry struct {
+	tag   uint16
+	typ   uint16
+	count uint32
+	data  []byte
+}
+
+type ifd []ifdEntry
+
+func (d ifd) size() uint32 {
+	size := uint32(2 + 12*len(d) + 4)
+	for _, e := range d {
+		if len(e.data) > 4 {
+			size += uint32(len(e.data) + len(e.data)%2)
+		}
+	}
+	return size
+}
+
+// encode lays out the directory at offset (relative to the TIFF header) with
+// its out-of-line values directly after it.
+func (d ifd) encode(offset uint32) []byte {
+	sort.Slice(d, func(i, j int) bool { return d[i].tag < d[j].tag })
+
+	buf := make([]byte, 0, d.size())
+	buf = byteOrder.AppendUint16(buf, uint16(len(d)))
+	dataOffset := offset + uint32(2+12*len(d)+4)
+	var data []byte
+
+	for _, e := range d {
+		buf = byteOrder.AppendUint16(buf, e.tag)
+		buf = byteOrder.AppendUint16(buf, e.typ)
+		buf = byteOrder.AppendUint32(buf, e.count)
+		if len(e.data) <= 4 {
+			value := make([]byte, 4)
+			copy(value, e.data)
+			buf = append(buf, value...)
+			continue
+		}
+		buf = byteOrder.AppendUint32(buf, dataOffset+uint32(len(data)))
+		data = append(data, e.data...)
+		if len(e.data)%2 == 1 {
+			data = append(data, 0)
+		}
+	}
+	buf = byteOrder.AppendUint32(buf, 0)
+	return append(buf, data...)
+}
+
+func asciiEntry(tag uint16, s string) ifdEntry {
+	data := append([]byte(s), 0)
+	return ifdEntry{tag: tag, typ: typeASCII, count: uint32(len(data)), data: data}
+}
+
+func shortEntry(tag uint16, v uint16) ifdEntry {
+	return ifdEntry{tag: tag, typ: typeShort, count: 1, data: byteOrder.AppendUint16(nil, v)}
+}
+
+func longEntry(tag uint16, v uint32) ifdEntry {
+	return ifdEntry{tag: tag, typ: typeLong, count: 1, data: byteOrder.AppendUint32(nil, v)}
+}
+
+func rationalEntry(tag uint16, values ...[2]uint32) ifdEntry {
+	var data []byte
+	for _, v := range values {
+		data = byteOrder.AppendUint32(data, v[0])
+		data = byteOrder.AppendUint32(data, v[1])
+	}
+	return ifdEntry{tag: tag, typ: typeRational, count: uint32(len(values)), data: data}
+}
+
+func rational(v float64, denominator uint32) [2]uint32 {
+	return [2]uint32{uint32(math.Round(v * float64(denominator))), denominator}
+}
+
+// exposureRational writes fractions of a second as 1/N, as cameras do.
+func exposureRational(seconds float64) [2]uint32 {
+	if seconds >= 1 {
+		return rational(seconds, 10)
+	}
+	return [2]uint32{1, uint32(math.Round(1 / seconds))}
+}
+
+func degreesRational(v float64) [][2]uint32 {
+	v = math.Abs(v)
+	degrees := math.Floor(v)
+	minutes := math.Floor((v - degrees) * 60)
+	seconds := ((v-degrees)*60 - minutes) * 60
+	return [][2]uint32{{uint32(degrees), 1}, {uint32(minutes), 1}, rational(seconds, 1000)}
+}
+
+// EncodeEXIF returns the payload of an EXIF APP1 segment, starting with
+// ExifHeader. Fields left at their zero value are omitted.
+func EncodeEXIF(m Metadata) []byte {
+	var ifd0, exif, gps ifd
+
+	if m.Make != "" {
+		ifd0 = append(ifd0, asciiEntry(tagMake, m.Make))
+	}
+	if m.Model != "" {
+		ifd0 = append(ifd0, asciiEntry(tagModel, m.Model))
+	}
+	if m.Orientation > 0 {
+		ifd0 = append(ifd0, shortEntry(tagOrientation, uint16(m.Orientation)))
+	}
+	if m.Creator != "" {
+		ifd0 = append(ifd0, asciiEntry(tagArtist, m.Creator))
+	}
+	if m.Copyright != "" {
+		ifd0 = append(ifd0, asciiEntry(tagCopyright, m.Copyright))
+	}
+
+	exif = append(exif, ifdEntry{tag: tagExifVersion, typ: typeUndefined, count: 4, data: []byte("0232")})
+	if !m.CaptureTime.IsZero() {
+		stamp := m.CaptureTime.Format("2006:01:02 15:04:05")
+		ifd0 = append(ifd0, asciiEntry(tagDateTime, stamp))
+		exif = append(exif, asciiEntry(tagDateTimeOriginal, stamp))
+	}
+	if m.ExposureTime > 0 {
+		exif = append(exif, rationalEntry(tagExposureTime, exposureRational(m.ExposureTime)))
+	}
+	if m.FNumber > 0 {
+		exif = append(exif, rationalEntry(tagFNumber, rational(m.FNumber, 10)))
+	}
+	if m.ISO > 0 {
+		exif = append(exif, shortEntry(tagISO, uint16(min(m.ISO, math.MaxUint16))))
+	}
+	if m.FocalLength > 0 {
+		exif = append(exif, rationalEntry(tagFocalLength, rational(m.FocalLength, 10)))
+	}
+	if m.Lens != "" {
+		exif = append(exif, asciiEntry(tagLensModel, m.Lens))
+	}
+
+	if m.GPS != nil {
+		latRef, lonRef := "N", "E"
+		if m.GPS.Latitude < 0 {
+			latRef = "S"
+		}
+		if m.GPS.Longitude < 0 {
+			lonRef = "W"
+		}
+		gps = ifd{
+			{tag: tagGPSVersionID, typ: typeByte, count: 4, data: []byte{2, 3, 0, 0}},
+			asciiEntry(tagGPSLatitudeRef, latRef),
+			rationalEntry(tagGPSLatitude, degreesRational(m.GPS.Latitude)...),
+			asciiEntry(tagGPSLongitudeRef, lonRef),
+			rationalEntry(tagGPSLongitude, degreesRational(m.GPS.Longitude)...),
+		}
+	}
+
+	// Pointer entries have a fixed size, so offsets can be computed up front.
+	ifd0 = append(ifd0, longEntry(tagExifIFD, 0))
+	if gps != nil {
+		ifd0 = append(ifd0, longEntry(tagGPSIFD, 0))
+	}
+	exifOffset := 8 + ifd0.size()
+	gpsOffset := exifOffset + exif.size()
+	for i := range ifd0 {
+		switch ifd0[i].tag {
+		case tagExifIFD:
+			ifd0[i] = longEntry(tagExifIFD, exifOffset)
+		case tagGPSIFD:
+			ifd0[i] = longEntry(tagGPSIFD, gpsOffset)
+		}
+	}
+
+	buf := []byte(ExifHeader)
+	buf = append(buf, 'I', 'I')
+	buf = byteOrder.AppendUint16(buf, 42)
+	buf = byteOrder.AppendUint32(buf, 8)
+	buf = append(buf, ifd0.encode(8)...)
+	buf = append(buf, exif.encode(exifOffset)...)
+	if gps != nil {
+		buf = append(buf, gps.encode(gpsOffset)...)
+	}
+	return buf
+}
@@ -0,0 +1,187 @@
+package metadata
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+const (
+	markerSOI  = 0xD8
+	markerSOS  = 0xDA
+	markerEOI  = 0xD9
+	markerAPP0 = 0xE0
+	markerAPP1 = 0xE1
+
+	// maxSegmentPayload is the largest payload a JPEG marker segment can hold.
+	maxSegmentPayload = 0xFFFF - 2
+)
+
+// Segments returns the APP1 payloads for m: EXIF when any EXIF field is set,
+// and XMP.
+func Segments(m Metadata) ([][]byte, error) {
+	var segments [][]byte
+	if m.hasEXIF() {
+		segments = append(segments, EncodeEXIF(m))
+	}
+	segments = append(segments, EncodeXMP(m))
+
+	for _, s := range segments {
+		if len(s) > maxSegmentPayload {
+			return nil, fmt.Errorf("metadata segment too large: %d bytes", len(s))
+		}
+	}
+	return segments, nil
+}
+
+// Write copies the JPEG from r to w, inserting the given APP1 payloads after
+// the SOI and any JFIF APP0 segment. Existing EXIF or XMP APP1 segments of a
+// kind among app1 are dropped so the new ones take their place; the others
+// are kept, so an EXIF-only write leaves the XMP packet alone. Image data is
+// copied unchanged.
+func Write(w io.Writer, r io.Reader, app1 [][]byte) error {
+	br := bufio.NewReader(r)
+	bw := bufio.NewWriter(w)
+
+	var soi [2]byte
+	if _, err := io.ReadFull(br, soi[:]); err != nil || soi[0] != 0xFF || soi[1] != markerSOI {
+		return fmt.Errorf("not a JPEG: missing SOI marker")
+	}
+	bw.Write(soi[:])
+
+	replaced := func(payload []byte) bool {
+		for _, header := range []string{ExifHeader, XMPHeader} {
+			if bytes.HasPrefix(payload, []byte(header)) {
+				for _, p := range app1 {
+					if bytes.HasPrefix(p, []byte(header)) {
+						return true
+					}
+				}
+			}
+		}
+		return false
+	}
+
+	inserted := false
+	insert := func() {
+		if inserted {
+			return
+		}
+		inserted = true
+		for _, payload := range app1 {
+			writeSegment(bw, markerAPP1, payload)
+		}
+	}
+
+	for {
+		marker, payload, err := readSegment(br)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case marker == markerAPP0 && !inserted:
+			writeSegment(bw, marker, payload)
+			continue
+		case marker == markerAPP1 && replaced(payload):
+			continue
+		}
+
+		insert()
+		if marker == markerSOS || marker == markerEOI {
+			bw.Write([]byte{0xFF, marker})
+			if marker == markerSOS {
+				bw.Write(segmentLength(len(payload)))
+				bw.Write(payload)
+				if _, err := io.Copy(bw, br); err != nil {
+					return err
+				}
+			}
+			return bw.Flush()
+		}
+		writeSegment(bw, marker, payload)
+	}
+}
+
+// Insert is Write for in-memory JPEGs.
+func Insert(jpeg []byte, m Metadata) ([]byte, error) {
+	segments, err := Segments(m)
+	if err != nil {
+		return nil, err
+	}
+	return insert(jpeg, segments)
+}
+
+// EXIFSegments is Segments without the XMP packet, for setting EXIF fields
+// such as the orientation on their own.
+func EXIFSegments(m Metadata) ([][]byte, error) {
+	exif := EncodeEXIF(m)
+	if len(exif) > maxSegmentPayload {
+		return nil, fmt.Errorf("metadata segment too large: %d bytes", len(exif))
+	}
+	return [][]byte{exif}, nil
+}
+
+// InsertEXIF is Insert with EXIFSegments.
+func InsertEXIF(jpeg []byte, m Metadata) ([]byte, error) {
+	segments, err := EXIFSegments(m)
+	if err != nil {
+		return nil, err
+	}
+	return insert(jpeg, segments)
+}
+
+func insert(jpeg []byte, segments [][]byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(len(jpeg) + 4096)
+	if err := Write(&buf, bytes.NewReader(jpeg), segments); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func segmentLength(payloadLen int) []byte {
+	n := payloadLen + 2
+	return []byte{byte(n >> 8), byte(n)}
+}
+
+func writeSegment(w io.Writer, marker byte, payload []byte) {
+	w.Write([]byte{0xFF, marker})
+	w.Write(segmentLength(len(payload)))
+	w.Write(payload)
+}
+
+// readSegment reads the next marker and, for markers with a length, its payload.
+func readSegment(r *bufio.Reader) (byte, []byte, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, fmt.Errorf("error reading JPEG marker: %v", err)
+	}
+	if b != 0xFF {
+		return 0, nil, fmt.Errorf("invalid JPEG marker 0x%02X", b)
+	}
+	marker := byte(0xFF)
+	for marker == 0xFF {
+		if marker, err = r.ReadByte(); err != nil {
+			return 0, nil, fmt.Errorf("error reading JPEG marker: %v", err)
+		}
+	}
+	if marker == markerEOI || (marker >= 0xD0 && marker <= 0xD7) || marker == 0x01 {
+		return marker, nil, nil
+	}
+
+	var length [2]byte
+	if _, err := io.ReadFull(r, length[:]); err != nil {
+		return 0, nil, fmt.Errorf("error reading JPEG segment: %v", err)
+	}
+	n := int(length[0])<<8 | int(length[1])
+	if n < 2 {
+		return 0, nil, fmt.Errorf("invalid JPEG segment length %d", n)
+	}
+	payload := make([]byte, n-2)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, fmt.Errorf("error reading JPEG segment: %v", err)
+	}
+	return marker, payload, nil
+}
@@ -0,0 +1,81 @@
+// Package metadata encodes image metadata as EXIF and XMP and inserts it into
+// JPEG files without re-encoding the image data.
+package metadata
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+type GPS struct {
+	Latitude  float64
+	Longitude float64
+}
+
+type Metadata struct {
+	CaptureTime time.Time
+	Make        string
+	Model       string
+	Lens        string
+	// ExposureTime is in seconds.
+	ExposureTime float64
+	FNumber      float64
+	ISO          int
+	// FocalLength is in millimetres.
+	FocalLength float64
+	GPS         *GPS
+	// Orientation is the EXIF Orientation value, 0 when unknown.
+	Orientation int
+
+	Rating int
+	// Pick is 1 for picked, -1 for rejected and 0 for unflagged.
+	Pick      int
+	Label     string
+	Title     string
+	Caption   string
+	Copyright string
+	Creator   string
+	Keywords  []string
+	// HierarchicalKeywords lists each keyword with its ancestors, as in
+	// "Places|Europe|Paris".
+	HierarchicalKeywords []string
+	// Develop summarises the adjustments applied in Lightroom. It is only
+	// written to sidecars.
+	Develop []Setting
+}
+
+// ErrDevelop is returned with otherwise complete metadata when the develop
+// settings of an image cannot be read; Develop is left empty.
+var ErrDevelop = errors.New("unreadable develop settings")
+
+type Setting struct {
+	Name  string
+	Value string
+}
+
+func (m Metadata) hasEXIF() bool {
+	return !m.CaptureTime.IsZero() || m.Make != "" || m.Model != "" || m.Lens != "" ||
+		m.ExposureTime > 0 || m.FNumber > 0 || m.ISO > 0 || m.FocalLength > 0 ||
+		m.GPS != nil || m.Copyright != "" || m.Creator != "" || m.Orientation > 0
+}
+
+// ParseCaptureTime parses the capture times stored by Lightroom, such as
+// "2025-06-14T15:32:11", "2025-06-14T15:32:11.25+02:00" or "2025-06-14".
+func ParseCaptureTime(value string) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	layouts := []string{
+		time.RFC3339Nano,
+		"2006-01-02T15:04:05.999999999",
+		"2006-01-02T15:04",
+		"2006-01-02",
+		"2006-01",
+		"2006",
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,269 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/xml"
+	"image"
+	"image/jpeg"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type tiffEntry struct {
+	typ   uint16
+	count uint32
+	value []byte
+}
+
+// readIFD decodes the directory at offset of a little-endian TIFF structure.
+func readIFD(t *testing.T, tiff []byte, offset uint32) map[uint16]tiffEntry {
+	t.Helper()
+	sizes := map[uint16]uint32{typeByte: 1, typeASCII: 1, typeShort: 2, typeLong: 4, typeRational: 8, typeUndefined: 1}
+	entries := make(map[uint16]tiffEntry)
+	n := binary.LittleEndian.Uint16(tiff[offset:])
+	for i := uint32(0); i < uint32(n); i++ {
+		e := tiff[offset+2+12*i:]
+		tag := binary.LittleEndian.Uint16(e[0:])
+		typ := binary.LittleEndian.Uint16(e[2:])
+		count := binary.LittleEndian.Uint32(e[4:])
+		size := sizes[typ] * count
+		value := e[8:12]
+		if size > 4 {
+			start := binary.LittleEndian.Uint32(e[8:])
+			value = tiff[start : start+size]
+		}
+		entries[tag] = tiffEntry{typ: typ, count: count, value: value[:min(size, uint32(len(value)))]}
+	}
+	return entries
+}
+
+func rationals(v []byte) [][2]uint32 {
+	var out [][2]uint32
+	for i := 0; i+8 <= len(v); i += 8 {
+		out = append(out, [2]uint32{binary.LittleEndian.Uint32(v[i:]), binary.LittleEndian.Uint32(v[i+4:])})
+	}
+	return out
+}
+
+func sample() Metadata {
+	return Metadata{
+		CaptureTime:          time.Date(2025, 6, 14, 15, 32, 11, 0, time.UTC),
+		Make:                 "Canon",
+		Model:                "Canon EOS R5",
+		Lens:                 "RF24-70mm F2.8 L IS USM",
+		ExposureTime:         1.0 / 250,
+		FNumber:              2.8,
+		ISO:                  400,
+		FocalLength:          50,
+		GPS:                  &GPS{Latitude: 41.8781, Longitude: -87.6298},
+		Rating:               4,
+		Label:                "Red",
+		Title:                "First dance",
+		Caption:              "Anna & Ben <3",
+		Copyright:            "© 2025 Studio",
+		Keywords:             []string{"wedding", "dance"},
+		Pick:                 1,
+		HierarchicalKeywords: []string{"Events|wedding", "dance"},
+		Develop:              []Setting{{Name: "Exposure2012", Value: "0.35"}},
+	}
+}
+
+func TestEncodeEXIF(t *testing.T) {
+	payload := EncodeEXIF(sample())
+	assert.True(t, bytes.HasPrefix(payload, []byte(ExifHeader)))
+
+	tiff := payload[len(ExifHeader):]
+	assert.Equal(t, []byte("II*\x00"), tiff[:4])
+
+	ifd0 := readIFD(t, tiff, binary.LittleEndian.Uint32(tiff[4:]))
+	assert.Equal(t, "Canon\x00", string(ifd0[tagMake].value))
+	assert.Equal(t, "Canon EOS R5\x00", string(ifd0[tagModel].value))
+	assert.Equal(t, "2025:06:14 15:32:11\x00", string(ifd0[tagDateTime].value))
+	assert.Equal(t, "© 2025 Studio\x00", string(ifd0[tagCopyright].value))
+
+	exif := readIFD(t, tiff, binary.LittleEndian.Uint32(ifd0[tagExifIFD].value))
+	assert.Equal(t, [][2]uint32{{1, 250}}, rationals(exif[tagExposureTime].value))
+	assert.Equal(t, [][2]uint32{{28, 10}}, rationals(exif[tagFNumber].value))
+	assert.Equal(t, uint16(400), binary.LittleEndian.Uint16(exif[tagISO].value))
+	assert.Equal(t, [][2]uint32{{500, 10}}, rationals(exif[tagFocalLength].value))
+	assert.Equal(t, "RF24-70mm F2.8 L IS USM\x00", string(exif[tagLensModel].value))
+	assert.Equal(t, "2025:06:14 15:32:11\x00", string(exif[tagDateTimeOriginal].value))
+
+	gps := readIFD(t, tiff, binary.LittleEndian.Uint32(ifd0[tagGPSIFD].value))
+	assert.Equal(t, "N\x00", string(gps[tagGPSLatitudeRef].value))
+	assert.Equal(t, "W\x00", string(gps[tagGPSLongitudeRef].value))
+	assert.Equal(t, [][2]uint32{{41, 1}, {52, 1}, {41160, 1000}}, rationals(gps[tagGPSLatitude].value))
+	assert.Equal(t, [][2]uint32{{87, 1}, {37, 1}, {47280, 1000}}, rationals(gps[tagGPSLongitude].value))
+}
+
+func TestEncodeEXIF_Minimal(t *testing.T) {
+	payload := EncodeEXIF(Metadata{ExposureTime: 2})
+	tiff := payload[len(ExifHeader):]
+
+	ifd0 := readIFD(t, tiff, 8)
+	_, hasGPS := ifd0[tagGPSIFD]
+	assert.False(t, hasGPS)
+	assert.Len(t, ifd0, 1)
+
+	exif := readIFD(t, tiff, binary.LittleEndian.Uint32(ifd0[tagExifIFD].value))
+	assert.Equal(t, [][2]uint32{{20, 10}}, rationals(exif[tagExposureTime].value))
+}
+
+func TestEncodeXMP(t *testing.T) {
+	payload := string(EncodeXMP(sample()))
+	assert.True(t, strings.HasPrefix(payload, XMPHeader))
+	assert.Contains(t, payload, `xmp:Rating="4"`)
+	assert.Contains(t, payload, `xmp:Label="Red"`)
+	assert.Contains(t, payload, `xmp:CreateDate="2025-06-14T15:32:11"`)
+	assert.Contains(t, payload, `<rdf:li xml:lang="x-default">First dance</rdf:li>`)
+	assert.Contains(t, payload, `<rdf:li xml:lang="x-default">Anna &amp; Ben &lt;3</rdf:li>`)
+	assert.Contains(t, payload, "<rdf:li>wedding</rdf:li>")
+	assert.Contains(t, payload, `xmpDM:pick="1"`)
+	assert.Contains(t, payload, "<lr:hierarchicalSubject>")
+	assert.Contains(t, payload, "<rdf:li>Events|wedding</rdf:li>")
+	assert.NotContains(t, payload, "lrdev:Exposure2012")
+	assert.Contains(t, payload, `<?xpacket end="w"?>`)
+}
+
+func TestXMPTitle(t *testing.T) {
+	assert.Equal(t, "First dance", XMPTitle(string(EncodeSidecar(sample()))))
+	assert.Empty(t, XMPTitle(string(EncodeSidecar(Metadata{Caption: "x"}))))
+	assert.Empty(t, XMPTitle("<unterminated"))
+}
+
+func TestEncodeSidecar(t *testing.T) {
+	sidecar := EncodeSidecar(sample())
+	assert.False(t, bytes.HasPrefix(sidecar, []byte(XMPHeader)))
+	assert.Contains(t, string(sidecar), `lrdev:Exposure2012="0.35"`)
+	assert.Contains(t, string(sidecar), `xmp:Rating="4"`)
+	assert.Contains(t, string(sidecar), `<rdf:li xml:lang="x-default">Anna &amp; Ben &lt;3</rdf:li>`)
+
+	var doc struct {
+		RDF struct {
+			Description struct {
+				Pick     string   `xml:"pick,attr"`
+				Subjects []string `xml:"hierarchicalSubject>Bag>li"`
+			} `xml:"Description"`
+		} `xml:"RDF"`
+	}
+	assert.NoError(t, xml.Unmarshal(sidecar, &doc))
+	assert.Equal(t, "1", doc.RDF.Description.Pick)
+	assert.Equal(t, []string{"Events|wedding", "dance"}, doc.RDF.Description.Subjects)
+}
+
+func TestSidecarPath(t *testing.T) {
+	assert.Equal(t, filepath.Join("out", "IMG_0001.xmp"), SidecarPath(filepath.Join("out", "IMG_0001.jpg")))
+	assert.Equal(t, "IMG_0001_level2_256x170.xmp", SidecarPath("IMG_0001_level2_256x170.jpg"))
+}
+
+func encodeJPEG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	assert.NoError(t, jpeg.Encode(&buf, image.NewGray(image.Rect(0, 0, 24, 16)), nil))
+	return buf.Bytes()
+}
+
+func TestInsert(t *testing.T) {
+	original := encodeJPEG(t)
+
+	out, err := Insert(original, sample())
+	assert.NoError(t, err)
+
+	// The image still decodes and keeps its dimensions
+	config, err := jpeg.DecodeConfig(bytes.NewReader(out))
+	assert.NoError(t, err)
+	assert.Equal(t, 24, config.Width)
+
+	// EXIF comes right after SOI, XMP after it, and the scan data is untouched
+	assert.Equal(t, []byte{0xFF, 0xD8, 0xFF, 0xE1}, out[:4])
+	assert.Equal(t, ExifHeader, string(out[6:12]))
+	sos := bytes.Index(original, []byte{0xFF, 0xDA})
+	assert.True(t, bytes.HasSuffix(out, original[sos:]))
+
+	// Inserting again replaces rather than duplicates the XMP packet, and
+	// keeps the EXIF segment it does not rewrite
+	again, err := Insert(out, Metadata{Rating: 2})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, bytes.Count(again, []byte(ExifHeader)))
+	assert.Equal(t, 1, bytes.Count(again, []byte(XMPHeader)))
+	assert.Contains(t, string(again), `xmp:Rating="2"`)
+	assert.NotContains(t, string(again), `xmp:Rating="4"`)
+}
+
+func TestInsert_KeepsJFIF(t *testing.T) {
+	jfif := []byte{0xFF, 0xE0, 0x00, 0x10, 'J', 'F', 'I', 'F', 0x00, 0x01, 0x01, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00, 0x00}
+	original := encodeJPEG(t)
+	withJFIF := append(append([]byte{0xFF, 0xD8}, jfif...), original[2:]...)
+
+	out, err := Insert(withJFIF, Metadata{Title: "x"})
+	assert.NoError(t, err)
+	assert.Equal(t, jfif, out[2:2+len(jfif)])
+	assert.Equal(t, []byte{0xFF, 0xE1}, out[2+len(jfif):4+len(jfif)])
+}
+
+func TestInsertEXIF(t *testing.T) {
+	out, err := InsertEXIF(encodeJPEG(t), Metadata{Orientation: 6})
+	assert.NoError(t, err)
+	assert.NotContains(t, string(out), XMPHeader)
+
+	start := bytes.Index(out, []byte(ExifHeader)) + len(ExifHeader)
+	tiff := out[start:]
+	ifd0 := readIFD(t, tiff, 8)
+	assert.Len(t, ifd0, 2)
+	assert.Equal(t, uint16(6), binary.LittleEndian.Uint16(ifd0[tagOrientation].value))
+
+	_, err = jpeg.DecodeConfig(bytes.NewReader(out))
+	assert.NoError(t, err)
+}
+
+func TestInsertEXIF_KeepsXMP(t *testing.T) {
+	withXMP, err := Insert(encodeJPEG(t), Metadata{Title: "First dance"})
+	assert.NoError(t, err)
+	assert.NotContains(t, string(withXMP), ExifHeader)
+
+	out, err := InsertEXIF(withXMP, Metadata{Orientation: 6})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, bytes.Count(out, []byte(ExifHeader)))
+	assert.Equal(t, 1, bytes.Count(out, []byte(XMPHeader)))
+	assert.Contains(t, string(out), `<rdf:li xml:lang="x-default">First dance</rdf:li>`)
+	assert.Less(t, bytes.Index(out, []byte(ExifHeader)), bytes.Index(out, []byte(XMPHeader)))
+
+	again, err := InsertEXIF(out, Metadata{Orientation: 3})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, bytes.Count(again, []byte(ExifHeader)))
+	assert.Equal(t, 1, bytes.Count(again, []byte(XMPHeader)))
+}
+
+func TestInsert_Errors(t *testing.T) {
+	_, err := Insert([]byte("not a jpeg"), Metadata{})
+	assert.Error(t, err)
+
+	_, err = Insert([]byte{0xFF, 0xD8, 0xFF, 0xC0, 0x00}, Metadata{})
+	assert.Error(t, err)
+
+	_, err = Insert(encodeJPEG(t), Metadata{Keywords: []string{strings.Repeat("k", 70000)}})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "too large")
+}
+
+func TestParseCaptureTime(t *testing.T) {
+	tests := map[string]time.Time{
+		"2025-06-14T15:32:11":       time.Date(2025, 6, 14, 15, 32, 11, 0, time.UTC),
+		"2025-06-14T15:32:11.5":     time.Date(2025, 6, 14, 15, 32, 11, 500000000, time.UTC),
+		"2025-06-14T15:32:11+02:00": time.Date(2025, 6, 14, 15, 32, 11, 0, time.FixedZone("", 7200)),
+		"2025-06-14":                time.Date(2025, 6, 14, 0, 0, 0, 0, time.UTC),
+	}
+	for value, want := range tests {
+		got, ok := ParseCaptureTime(value)
+		assert.True(t, ok, value)
+		assert.True(t, want.Equal(got), value)
+	}
+
+	_, ok := ParseCaptureTime("yesterday")
+	assert.False(t, ok)
+}
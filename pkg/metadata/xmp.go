@@ -0,0 +1,142 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// XMPHeader prefixes the XMP packet inside an APP1 segment.
+const XMPHeader = "http://ns.adobe.com/xap/1.0/\x00"
+
+func escape(s string) string {
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+// XMPTitle returns the first dc:title of an XMP packet, or "" when it has
+// none or cannot be parsed.
+func XMPTitle(packet string) string {
+	dec := xml.NewDecoder(strings.NewReader(packet))
+	inTitle := false
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return ""
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space == "http://purl.org/dc/elements/1.1/" && t.Name.Local == "title" {
+				inTitle = true
+			} else if inTitle && t.Name.Local == "li" {
+				var title string
+				if err := dec.DecodeElement(&title, &t); err != nil {
+					return ""
+				}
+				return title
+			}
+		case xml.EndElement:
+			if inTitle && t.Name.Local == "title" {
+				return ""
+			}
+		}
+	}
+}
+
+// xmpDescription builds the rdf:Description shared by embedded packets and
+// sidecars.
+func xmpDescription(m Metadata) string {
+	var attrs, elems strings.Builder
+
+	if m.Rating != 0 {
+		fmt.Fprintf(&attrs, "\n   xmp:Rating=\"%d\"", m.Rating)
+	}
+	if m.Label != "" {
+		fmt.Fprintf(&attrs, "\n   xmp:Label=\"%s\"", escape(m.Label))
+	}
+	if m.Pick != 0 {
+		fmt.Fprintf(&attrs, "\n   xmpDM:pick=\"%d\"", m.Pick)
+	}
+	if !m.CaptureTime.IsZero() {
+		stamp := m.CaptureTime.Format("2006-01-02T15:04:05")
+		fmt.Fprintf(&attrs, "\n   xmp:CreateDate=\"%s\"", stamp)
+		fmt.Fprintf(&attrs, "\n   photoshop:DateCreated=\"%s\"", stamp)
+	}
+	if m.Lens != "" {
+		fmt.Fprintf(&attrs, "\n   aux:Lens=\"%s\"", escape(m.Lens))
+	}
+	for _, setting := range m.Develop {
+		fmt.Fprintf(&attrs, "\n   lrdev:%s=\"%s\"", setting.Name, escape(setting.Value))
+	}
+
+	writeAlt := func(name, value string) {
+		if value == "" {
+			return
+		}
+		fmt.Fprintf(&elems, "   <%s>\n    <rdf:Alt>\n     <rdf:li xml:lang=\"x-default\">%s</rdf:li>\n    </rdf:Alt>\n   </%s>\n", name, escape(value), name)
+	}
+	writeAlt("dc:title", m.Title)
+	writeAlt("dc:description", m.Caption)
+	writeAlt("dc:rights", m.Copyright)
+
+	if m.Creator != "" {
+		fmt.Fprintf(&elems, "   <dc:creator>\n    <rdf:Seq>\n     <rdf:li>%s</rdf:li>\n    </rdf:Seq>\n   </dc:creator>\n", escape(m.Creator))
+	}
+	writeBag := func(name string, values []string) {
+		if len(values) == 0 {
+			return
+		}
+		fmt.Fprintf(&elems, "   <%s>\n    <rdf:Bag>\n", name)
+		for _, value := range values {
+			fmt.Fprintf(&elems, "     <rdf:li>%s</rdf:li>\n", escape(value))
+		}
+		fmt.Fprintf(&elems, "    </rdf:Bag>\n   </%s>\n", name)
+	}
+	writeBag("dc:subject", m.Keywords)
+	writeBag("lr:hierarchicalSubject", m.HierarchicalKeywords)
+
+	return fmt.Sprintf(`  <rdf:Description rdf:about=""
+   xmlns:xmp="http://ns.adobe.com/xap/1.0/"
+   xmlns:dc="http://purl.org/dc/elements/1.1/"
+   xmlns:photoshop="http://ns.adobe.com/photoshop/1.0/"
+   xmlns:aux="http://ns.adobe.com/exif/1.0/aux/"
+   xmlns:xmpDM="http://ns.adobe.com/xmp/1.0/DynamicMedia/"
+   xmlns:lr="http://ns.adobe.com/lightroom/1.0/"
+   xmlns:lrdev="https://github.com/harperreed/lrprev-extract-go/ns/develop/1.0/"%s>
+%s  </rdf:Description>
+`, attrs.String(), elems.String())
+}
+
+func xmpPacket(description string) []byte {
+	return []byte(`<?xpacket begin="` + "\ufeff" + `" id="W5M0MpCehiHzreSzNTczkc9d"?>
+<x:xmpmeta xmlns:x="adobe:ns:meta/">
+ <rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#">
+` + description + ` </rdf:RDF>
+</x:xmpmeta>
+<?xpacket end="w"?>`)
+}
+
+// EncodeXMP returns the payload of an XMP APP1 segment, starting with
+// XMPHeader. IPTC Core fields (caption, copyright, keywords) are carried in
+// the dc namespace.
+func EncodeXMP(m Metadata) []byte {
+	m.Develop = nil
+	return append([]byte(XMPHeader), xmpPacket(xmpDescription(m))...)
+}
+
+// EncodeSidecar returns an XMP sidecar document for tools that must not have
+// the JPEG bytes changed. Unlike EncodeXMP it includes the develop summary,
+// which uses its own namespace rather than crs so that Camera Raw does not
+// apply the adjustments a second time to the already rendered preview.
+func EncodeSidecar(m Metadata) []byte {
+	return append(xmpPacket(xmpDescription(m)), '\n')
+}
+
+// SidecarPath returns the sidecar path for an output file: the same name
+// with an .xmp extension.
+func SidecarPath(path string) string {
+	return strings.TrimSuffix(path, filepath.Ext(path)) + ".xmp"
+}
@@ -0,0 +1,255 @@
+// Package naming renders output paths from templates such as
+// "{capture:2006/01/02}/{camera}/{basename}_{width}x{height}.jpg".
+package naming
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Unknown is rendered for fields the catalog does not provide.
+const Unknown = "unknown"
+
+// Fields are the values available to a template.
+type Fields struct {
+	UUID string
+	// BaseName is the original's name without extension, Ext its extension.
+	BaseName string
+	Ext      string
+	Width    int
+	Height   int
+	Level    int
+	// CaptureTime is zero when unknown.
+	CaptureTime time.Time
+	Camera      string
+	Rating      int
+	// Folder is the original's directory, possibly several levels deep.
+	Folder     string
+	Collection string
+}
+
+type part struct {
+	literal string
+	token   string
+	arg     string
+}
+
+// Template is a parsed output path template.
+type Template struct {
+	source string
+	parts  []part
+}
+
+var tokens = map[string]bool{
+	"uuid":       true,
+	"basename":   true,
+	"ext":        true,
+	"width":      true,
+	"height":     true,
+	"level":      true,
+	"capture":    true,
+	"camera":     true,
+	"rating":     true,
+	"folder":     true,
+	"collection": true,
+}
+
+// Tokens lists the token names a template may use.
+func Tokens() []string {
+	return []string{"uuid", "basename", "ext", "width", "height", "level", "capture[:layout]", "camera", "rating", "folder", "collection"}
+}
+
+// Parse parses a template. Tokens are written {name}; {capture} takes an
+// optional Go time layout as in {capture:2006/01/02}. "{{" and "}}" stand for
+// literal braces and "/" separates directories.
+func Parse(source string) (*Template, error) {
+	t := &Template{source: source}
+	var literal strings.Builder
+	flush := func() {
+		if literal.Len() > 0 {
+			t.parts = append(t.parts, part{literal: literal.String()})
+			literal.Reset()
+		}
+	}
+
+	for i := 0; i < len(source); i++ {
+		c := source[i]
+		switch {
+		case c == '{' && strings.HasPrefix(source[i:], "{{"):
+			literal.WriteByte('{')
+			i++
+		case c == '}' && strings.HasPrefix(source[i:], "}}"):
+			literal.WriteByte('}')
+			i++
+		case c == '}':
+			return nil, fmt.Errorf("invalid template %q: unmatched '}'", source)
+		case c == '{':
+			end := strings.IndexByte(source[i:], '}')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid template %q: unclosed '{'", source)
+			}
+			name, arg, hasArg := strings.Cut(source[i+1:i+end], ":")
+			if !tokens[name] {
+				return nil, fmt.Errorf("invalid template %q: unknown token {%s}", source, name)
+			}
+			if hasArg && name != "capture" {
+				return nil, fmt.Errorf("invalid template %q: {%s} takes no argument", source, name)
+			}
+			flush()
+			t.parts = append(t.parts, part{token: name, arg: arg})
+			i += end
+		default:
+			literal.WriteByte(c)
+		}
+	}
+	flush()
+
+	if len(t.parts) == 0 {
+		return nil, fmt.Errorf("invalid template: empty")
+	}
+	if strings.HasPrefix(source, "/") || filepath.IsAbs(source) {
+		return nil, fmt.Errorf("invalid template %q: must be relative to the output directory", source)
+	}
+	for _, segment := range strings.Split(source, "/") {
+		if segment == ".." {
+			return nil, fmt.Errorf("invalid template %q: must not contain '..'", source)
+		}
+	}
+	return t, nil
+}
+
+// Uses reports whether the template contains the token name.
+func (t *Template) Uses(name string) bool {
+	for _, p := range t.parts {
+		if p.token == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *Template) String() string {
+	return t.source
+}
+
+// Render returns the output path for f, relative to the output directory and
+// using the OS path separator. Values are sanitised so they cannot add
+// directories or unsafe characters, and ".jpg" is appended unless the result
+// already ends in .jpg or .jpeg.
+func (t *Template) Render(f Fields) string {
+	var out strings.Builder
+	for _, p := range t.parts {
+		if p.token == "" {
+			out.WriteString(p.literal)
+			continue
+		}
+		out.WriteString(f.value(p.token, p.arg))
+	}
+
+	var segments []string
+	for _, segment := range strings.Split(out.String(), "/") {
+		if segment = cleanSegment(segment); segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) == 0 {
+		segments = []string{Sanitize(f.UUID)}
+	}
+
+	rendered := filepath.Join(segments...)
+	switch strings.ToLower(path.Ext(segments[len(segments)-1])) {
+	case ".jpg", ".jpeg":
+		return rendered
+	}
+	return rendered + ".jpg"
+}
+
+func (f Fields) value(token, arg string) string {
+	orUnknown := func(s string) string {
+		if s == "" {
+			return Unknown
+		}
+		return Sanitize(s)
+	}
+
+	switch token {
+	case "uuid":
+		return orUnknown(f.UUID)
+	case "basename":
+		return orUnknown(f.BaseName)
+	case "ext":
+		return orUnknown(strings.ToLower(f.Ext))
+	case "width":
+		return strconv.Itoa(f.Width)
+	case "height":
+		return strconv.Itoa(f.Height)
+	case "level":
+		return strconv.Itoa(f.Level)
+	case "capture":
+		if f.CaptureTime.IsZero() {
+			return Unknown
+		}
+		if arg == "" {
+			arg = "2006-01-02"
+		}
+		// The layout may contain "/" to create directories, values may not.
+		var parts []string
+		for _, s := range strings.Split(f.CaptureTime.Format(arg), "/") {
+			parts = append(parts, Sanitize(s))
+		}
+		return strings.Join(parts, "/")
+	case "camera":
+		return orUnknown(f.Camera)
+	case "rating":
+		return strconv.Itoa(f.Rating)
+	case "folder":
+		var parts []string
+		for _, s := range strings.Split(filepath.ToSlash(f.Folder), "/") {
+			if s = cleanSegment(Sanitize(s)); s != "" {
+				parts = append(parts, s)
+			}
+		}
+		if len(parts) == 0 {
+			return Unknown
+		}
+		return strings.Join(parts, "/")
+	case "collection":
+		return orUnknown(f.Collection)
+	}
+	return ""
+}
+
+// Sanitize replaces characters that are unsafe in file names on common
+// filesystems, including path separators, with "_".
+func Sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20 || r == 0x7F:
+			return '_'
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, s)
+}
+
+// cleanSegment trims what Windows strips from names and drops segments that
+// would refer to the current or parent directory.
+func cleanSegment(s string) string {
+	s = strings.TrimRight(strings.TrimSpace(s), ". ")
+	if s == "" || s == "." || s == ".." {
+		return ""
+	}
+	base, _, _ := strings.Cut(s, ".")
+	switch strings.ToUpper(base) {
+	case "CON", "PRN", "AUX", "NUL",
+		"COM1", "COM2", "COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9",
+		"LPT1", "LPT2", "LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9":
+		return "_" + s
+	}
+	return s
+}
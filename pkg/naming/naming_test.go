@@ -0,0 +1,88 @@
+package naming
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func sampleFields() Fields {
+	return Fields{
+		UUID:        "12345678-1234-1234-1234-123456789012",
+		BaseName:    "IMG_0001",
+		Ext:         "CR3",
+		Width:       2048,
+		Height:      1365,
+		Level:       5,
+		CaptureTime: time.Date(2025, 6, 14, 15, 32, 11, 0, time.UTC),
+		Camera:      "Canon EOS R5",
+		Rating:      4,
+		Folder:      "photos/2025/wedding",
+		Collection:  "2025 Wedding",
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"{basename}", "IMG_0001.jpg"},
+		{"{basename}.jpg", "IMG_0001.jpg"},
+		{"{basename}.JPEG", "IMG_0001.JPEG"},
+		{"{basename}_{ext}_{width}x{height}", "IMG_0001_cr3_2048x1365.jpg"},
+		{"{capture:2006/01/02}/{basename}", "2025/06/14/IMG_0001.jpg"},
+		{"{capture}/{camera}/{rating}-{basename}", "2025-06-14/Canon EOS R5/4-IMG_0001.jpg"},
+		{"{collection}/{folder}/{uuid}_l{level}", "2025 Wedding/photos/2025/wedding/12345678-1234-1234-1234-123456789012_l5.jpg"},
+		{"{{{basename}}}", "{IMG_0001}.jpg"},
+	}
+	for _, tt := range tests {
+		tmpl, err := Parse(tt.template)
+		assert.NoError(t, err, tt.template)
+		assert.Equal(t, filepath.FromSlash(tt.want), tmpl.Render(sampleFields()), tt.template)
+	}
+}
+
+func TestTemplate_Uses(t *testing.T) {
+	tmpl, err := Parse("{capture:2006}/{basename}_l{level}")
+	assert.NoError(t, err)
+	assert.True(t, tmpl.Uses("level"))
+	assert.True(t, tmpl.Uses("capture"))
+	assert.False(t, tmpl.Uses("width"))
+
+	tmpl, err = Parse("{{level}}")
+	assert.NoError(t, err)
+	assert.False(t, tmpl.Uses("level"))
+}
+
+func TestRender_Sanitize(t *testing.T) {
+	tmpl, err := Parse("{camera}/{collection}/{basename}")
+	assert.NoError(t, err)
+
+	f := Fields{UUID: "u", BaseName: "a/b:c*", Camera: "..", Collection: " CON "}
+	assert.Equal(t, filepath.Join("unknown", "_CON", "a_b_c_.jpg"), tmpl.Render(Fields{UUID: "u", BaseName: "a/b:c*", Collection: " CON "}))
+	assert.Equal(t, filepath.Join("_CON", "a_b_c_.jpg"), tmpl.Render(f))
+
+	tmpl, err = Parse("{capture:2006}/{folder}/{ext}")
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join("unknown", "unknown", "unknown.jpg"), tmpl.Render(Fields{UUID: "u"}))
+	assert.Equal(t, filepath.Join("unknown", "x", "y", "unknown.jpg"), tmpl.Render(Fields{UUID: "u", Folder: "/x/../y/"}))
+}
+
+func TestParse_Errors(t *testing.T) {
+	for template, want := range map[string]string{
+		"":                   "invalid template: empty",
+		"{nope}":             `invalid template "{nope}": unknown token {nope}`,
+		"{basename":          `invalid template "{basename": unclosed '{'`,
+		"basename}":          `invalid template "basename}": unmatched '}'`,
+		"{rating:2}":         `invalid template "{rating:2}": {rating} takes no argument`,
+		"/abs/{basename}":    `invalid template "/abs/{basename}": must be relative to the output directory`,
+		"../{basename}":      `invalid template "../{basename}": must not contain '..'`,
+		"a/../../{uuid}.jpg": `invalid template "a/../../{uuid}.jpg": must not contain '..'`,
+	} {
+		_, err := Parse(template)
+		assert.EqualError(t, err, want, template)
+	}
+}
@@ -0,0 +1,400 @@
+// Package output writes extracted files under a conflict policy and records
+// every collision for the run summary.
+package output
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Conflict policies.
+const (
+	// Overwrite replaces the existing file.
+	Overwrite = "overwrite"
+	// Skip keeps the existing file and drops the new one.
+	Skip = "skip"
+	// Suffix writes the new file as name-2.jpg, name-3.jpg, and so on.
+	Suffix = "suffix"
+	// Identical skips the new file when it matches the existing one byte for
+	// byte, and otherwise writes it with a suffix.
+	Identical = "identical"
+)
+
+// Policies lists the accepted conflict policies.
+var Policies = []string{Overwrite, Skip, Suffix, Identical}
+
+// Conflict actions.
+const (
+	ActionOverwritten = "overwritten"
+	ActionSkipped     = "skipped"
+	ActionRenamed     = "renamed"
+	ActionIdentical   = "identical"
+)
+
+// Conflict records a file whose path was already taken, either by a file on
+// disk or by another source earlier in the run.
+type Conflict struct {
+	Path   string `json:"path"`
+	Source string `json:"source"`
+	// Previous is the source that wrote Path earlier in this run, or empty
+	// when Path already existed on disk.
+	Previous string `json:"previous,omitempty"`
+	Action   string `json:"action"`
+	// RenamedTo is where the file was written for ActionRenamed.
+	RenamedTo string `json:"renamed_to,omitempty"`
+}
+
+func (c Conflict) String() string {
+	previous := "an existing file"
+	if c.Previous != "" {
+		previous = c.Previous
+	}
+	switch c.Action {
+	case ActionRenamed:
+		return fmt.Sprintf("%s (from %s) collides with %s: written as %s", c.Path, c.Source, previous, c.RenamedTo)
+	case ActionIdentical:
+		return fmt.Sprintf("%s (from %s) is identical to %s: skipped", c.Path, c.Source, previous)
+	}
+	return fmt.Sprintf("%s (from %s) collides with %s: %s", c.Path, c.Source, previous, c.Action)
+}
+
+type claim struct {
+	source string
+	digest [sha256.Size]byte
+	// released marks a file its source may replace, see Release.
+	released bool
+}
+
+// File is an output file written, or planned, during a run.
+type File struct {
+	Path   string `json:"path"`
+	Source string `json:"source"`
+	Size   int64  `json:"bytes"`
+}
+
+// Writer writes files under a conflict policy. It is safe for concurrent use;
+// one Writer should be shared by all workers of a run so collisions between
+// them are detected.
+type Writer struct {
+	policy string
+	// dryRun resolves names and conflicts as usual but leaves the disk alone.
+	dryRun bool
+
+	mu        sync.Mutex
+	claims    map[string]claim
+	conflicts []Conflict
+	written   map[string][]string
+	files     []File
+}
+
+func NewWriter(policy string) (*Writer, error) {
+	switch policy {
+	case Overwrite, Skip, Suffix, Identical:
+	default:
+		return nil, fmt.Errorf("invalid conflict policy %q: must be one of %s", policy, strings.Join(Policies, ", "))
+	}
+	return &Writer{policy: policy, claims: make(map[string]claim), written: make(map[string][]string)}, nil
+}
+
+// NewDryRunWriter returns a Writer that goes through every step of a real
+// run, producing the data, choosing the final names and recording conflicts
+// and sizes, without creating any file or directory.
+func NewDryRunWriter(policy string) (*Writer, error) {
+	w, err := NewWriter(policy)
+	if err != nil {
+		return nil, err
+	}
+	w.dryRun = true
+	return w, nil
+}
+
+// DryRun reports whether the Writer only plans its files.
+func (w *Writer) DryRun() bool {
+	return w.dryRun
+}
+
+// MkdirAll creates an output directory, unless this is a dry run.
+func (w *Writer) MkdirAll(dir string) error {
+	if w.dryRun {
+		return nil
+	}
+	return os.MkdirAll(dir, os.ModePerm)
+}
+
+// key compares paths case-insensitively, as on macOS and Windows.
+func key(path string) string {
+	return strings.ToLower(filepath.Clean(path))
+}
+
+// Write copies r to path, or to another path when the policy renames it, and
+// returns the path written. It returns "" when the file was skipped. The data
+// goes to a temporary file in the same directory first, so readers never see
+// a partial file.
+func (w *Writer) Write(path, source string, r io.Reader) (string, error) {
+	return w.WriteStream(path, source, func(dst io.Writer) error {
+		_, err := io.Copy(dst, r)
+		return err
+	})
+}
+
+// WriteStream is Write for data produced by write, which receives a buffered
+// writer. write is not called when the file is skipped up front.
+func (w *Writer) WriteStream(path, source string, write func(io.Writer) error) (string, error) {
+	if w.policy == Skip {
+		w.mu.Lock()
+		if previous, taken := w.taken(path, source); taken {
+			w.record(Conflict{Path: path, Source: source, Previous: previous, Action: ActionSkipped})
+			w.mu.Unlock()
+			return "", nil
+		}
+		w.mu.Unlock()
+	}
+
+	tmp, digest, size, err := w.writeTemp(path, write)
+	if err != nil {
+		return "", err
+	}
+	if tmp != "" {
+		defer os.Remove(tmp)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	final := path
+	if previous, taken := w.taken(path, source); taken {
+		conflict := Conflict{Path: path, Source: source, Previous: previous}
+		switch w.policy {
+		case Overwrite:
+			conflict.Action = ActionOverwritten
+		case Skip:
+			conflict.Action = ActionSkipped
+			w.record(conflict)
+			return "", nil
+		case Identical:
+			if w.identical(path, digest) {
+				conflict.Action = ActionIdentical
+				w.record(conflict)
+				return "", nil
+			}
+			fallthrough
+		case Suffix:
+			final = w.free(path, source)
+			conflict.Action = ActionRenamed
+			conflict.RenamedTo = final
+		}
+		w.record(conflict)
+	}
+
+	if err := w.commit(tmp, final, source, digest, size); err != nil {
+		return "", err
+	}
+	return final, nil
+}
+
+// WriteAlongside writes a file that accompanies one written by Write, such
+// as its sidecar. It replaces any existing file without applying the
+// conflict policy, since the policy already decided the name.
+func (w *Writer) WriteAlongside(path, source string, data []byte) error {
+	tmp, digest, size, err := w.writeTemp(path, func(dst io.Writer) error {
+		_, err := dst.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if tmp != "" {
+		defer os.Remove(tmp)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.commit(tmp, path, source, digest, size)
+}
+
+// commit moves tmp to its final path and records it. It must be called with
+// mu held.
+func (w *Writer) commit(tmp, path, source string, digest [sha256.Size]byte, size int64) error {
+	if !w.dryRun {
+		if err := os.Rename(tmp, path); err != nil {
+			return fmt.Errorf("error writing output file: %v", err)
+		}
+	}
+	w.claims[key(path)] = claim{source: source, digest: digest}
+	w.written[source] = append(w.written[source], path)
+	w.files = append(w.files, File{Path: path, Source: source, Size: size})
+	return nil
+}
+
+// writeTemp lets write fill a temporary file next to path and returns its
+// name, the SHA-256 of the data and its size. In a dry run the data is only
+// hashed and counted, and the name is empty.
+func (w *Writer) writeTemp(path string, write func(io.Writer) error) (string, [sha256.Size]byte, int64, error) {
+	var digest [sha256.Size]byte
+	hash := sha256.New()
+	counter := &countingWriter{w: hash}
+	if w.dryRun {
+		buf := bufio.NewWriterSize(counter, 64*1024)
+		err := write(buf)
+		if err == nil {
+			err = buf.Flush()
+		}
+		if err != nil {
+			return "", digest, 0, fmt.Errorf("error writing output file: %v", err)
+		}
+		copy(digest[:], hash.Sum(nil))
+		return "", digest, counter.n, nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".lrprev-extract-*.tmp")
+	if err != nil {
+		return "", digest, 0, fmt.Errorf("error creating output file: %v", err)
+	}
+
+	buf := bufio.NewWriterSize(io.MultiWriter(tmp, counter), 64*1024)
+	err = write(buf)
+	if err == nil {
+		err = buf.Flush()
+	}
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", digest, 0, fmt.Errorf("error writing output file: %v", err)
+	}
+	copy(digest[:], hash.Sum(nil))
+	return tmp.Name(), digest, counter.n, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// Written returns the files written for source so far, in order.
+func (w *Writer) Written(source string) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.written[source]...)
+}
+
+// Release lets source be written again, as when a watched preview is
+// rendered anew: the files it wrote so far no longer collide with its new
+// ones, and Written starts over.
+func (w *Writer) Release(source string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, path := range w.written[source] {
+		if c, ok := w.claims[key(path)]; ok && c.source == source {
+			c.released = true
+			w.claims[key(path)] = c
+		}
+	}
+	delete(w.written, source)
+}
+
+// Files returns every file written so far, in the order they were written.
+func (w *Writer) Files() []File {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]File(nil), w.files...)
+}
+
+// WriteFile is Write for data held in memory.
+func (w *Writer) WriteFile(path, source string, data []byte) (string, error) {
+	return w.Write(path, source, bytes.NewReader(data))
+}
+
+// taken reports whether path was written earlier in the run, and by which
+// source, or exists on disk. A file source wrote before Release is free for
+// it. It must be called with mu held.
+func (w *Writer) taken(path, source string) (string, bool) {
+	if c, ok := w.claims[key(path)]; ok {
+		if c.released && c.source == source {
+			return "", false
+		}
+		return c.source, true
+	}
+	_, err := os.Lstat(path)
+	return "", err == nil
+}
+
+func (w *Writer) identical(path string, digest [sha256.Size]byte) bool {
+	if c, ok := w.claims[key(path)]; ok {
+		return c.digest == digest
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return false
+	}
+	return bytes.Equal(hash.Sum(nil), digest[:])
+}
+
+// free returns the first name-N path that is neither claimed nor on disk.
+func (w *Writer) free(path, source string) string {
+	ext := filepath.Ext(path)
+	stem := strings.TrimSuffix(path, ext)
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s-%d%s", stem, i, ext)
+		if _, taken := w.taken(candidate, source); !taken {
+			return candidate
+		}
+	}
+}
+
+func (w *Writer) record(c Conflict) {
+	w.conflicts = append(w.conflicts, c)
+}
+
+// Conflicts returns the collisions recorded so far, sorted by path.
+func (w *Writer) Conflicts() []Conflict {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	conflicts := append([]Conflict(nil), w.conflicts...)
+	sort.SliceStable(conflicts, func(i, j int) bool { return conflicts[i].Path < conflicts[j].Path })
+	return conflicts
+}
+
+// Summary counts the recorded collisions by action, e.g.
+// "3 output conflicts (2 renamed, 1 skipped)".
+func (w *Writer) Summary() string {
+	conflicts := w.Conflicts()
+	if len(conflicts) == 0 {
+		return "no output conflicts"
+	}
+	counts := make(map[string]int)
+	for _, c := range conflicts {
+		counts[c.Action]++
+	}
+	var parts []string
+	for _, action := range []string{ActionOverwritten, ActionSkipped, ActionRenamed, ActionIdentical} {
+		if counts[action] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[action], action))
+		}
+	}
+	return fmt.Sprintf("%d output conflicts (%s)", len(conflicts), strings.Join(parts, ", "))
+}
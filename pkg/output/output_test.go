@@ -0,0 +1,276 @@
+package output
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	return string(data)
+}
+
+func TestNewWriter(t *testing.T) {
+	for _, policy := range Policies {
+		_, err := NewWriter(policy)
+		assert.NoError(t, err, policy)
+	}
+	_, err := NewWriter("rename")
+	assert.EqualError(t, err, `invalid conflict policy "rename": must be one of overwrite, skip, suffix, identical`)
+}
+
+func TestWriter_NoConflict(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter(Skip)
+	assert.NoError(t, err)
+
+	path := filepath.Join(dir, "IMG_0001.jpg")
+	written, err := w.WriteFile(path, "a.lrprev", []byte("one"))
+	assert.NoError(t, err)
+	assert.Equal(t, path, written)
+	assert.Equal(t, "one", readFile(t, path))
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode().Perm())
+	assert.Empty(t, w.Conflicts())
+	assert.Equal(t, "no output conflicts", w.Summary())
+
+	// No temporary files are left behind
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestWriter_Policies(t *testing.T) {
+	tests := []struct {
+		policy      string
+		data        string
+		wantWritten string
+		wantOnDisk  map[string]string
+		wantAction  string
+	}{
+		{Overwrite, "new", "IMG_0001.jpg", map[string]string{"IMG_0001.jpg": "new"}, ActionOverwritten},
+		{Skip, "new", "", map[string]string{"IMG_0001.jpg": "old"}, ActionSkipped},
+		{Suffix, "new", "IMG_0001-2.jpg", map[string]string{"IMG_0001.jpg": "old", "IMG_0001-2.jpg": "new"}, ActionRenamed},
+		{Identical, "old", "", map[string]string{"IMG_0001.jpg": "old"}, ActionIdentical},
+		{Identical, "new", "IMG_0001-2.jpg", map[string]string{"IMG_0001.jpg": "old", "IMG_0001-2.jpg": "new"}, ActionRenamed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy+"_"+tt.data, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "IMG_0001.jpg")
+			assert.NoError(t, os.WriteFile(path, []byte("old"), 0644))
+
+			w, err := NewWriter(tt.policy)
+			assert.NoError(t, err)
+			written, err := w.WriteFile(path, "a.lrprev", []byte(tt.data))
+			assert.NoError(t, err)
+			if tt.wantWritten == "" {
+				assert.Empty(t, written)
+			} else {
+				assert.Equal(t, filepath.Join(dir, tt.wantWritten), written)
+			}
+
+			entries, err := os.ReadDir(dir)
+			assert.NoError(t, err)
+			assert.Len(t, entries, len(tt.wantOnDisk))
+			for name, content := range tt.wantOnDisk {
+				assert.Equal(t, content, readFile(t, filepath.Join(dir, name)), name)
+			}
+
+			conflicts := w.Conflicts()
+			assert.Len(t, conflicts, 1)
+			assert.Equal(t, path, conflicts[0].Path)
+			assert.Equal(t, "a.lrprev", conflicts[0].Source)
+			assert.Empty(t, conflicts[0].Previous)
+			assert.Equal(t, tt.wantAction, conflicts[0].Action)
+			assert.Equal(t, "1 output conflicts (1 "+tt.wantAction+")", w.Summary())
+		})
+	}
+}
+
+func TestWriter_WithinRun(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter(Identical)
+	assert.NoError(t, err)
+
+	path := filepath.Join(dir, "IMG_0001.jpg")
+	_, err = w.WriteFile(path, "a.lrprev", []byte("one"))
+	assert.NoError(t, err)
+	// Same bytes from another preview are dropped
+	written, err := w.WriteFile(path, "b.lrprev", []byte("one"))
+	assert.NoError(t, err)
+	assert.Empty(t, written)
+	// Different bytes are renamed, comparing names case-insensitively
+	written, err = w.WriteFile(filepath.Join(dir, "img_0001.jpg"), "c.lrprev", []byte("two"))
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "img_0001-2.jpg"), written)
+
+	conflicts := w.Conflicts()
+	assert.Len(t, conflicts, 2)
+	assert.Equal(t, "a.lrprev", conflicts[0].Previous)
+	assert.Equal(t, "a.lrprev", conflicts[1].Previous)
+	assert.Equal(t, "2 output conflicts (1 renamed, 1 identical)", w.Summary())
+	assert.Equal(t, path+" (from b.lrprev) is identical to a.lrprev: skipped", conflicts[0].String())
+	assert.Contains(t, conflicts[1].String(), "written as "+written)
+}
+
+func TestWriter_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter(Suffix)
+	assert.NoError(t, err)
+
+	path := filepath.Join(dir, "IMG_0001.jpg")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := w.Write(path, "a.lrprev", strings.NewReader("data"))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 8)
+	assert.Len(t, w.Conflicts(), 7)
+}
+
+func TestWriter_Errors(t *testing.T) {
+	w, err := NewWriter(Overwrite)
+	assert.NoError(t, err)
+	_, err = w.WriteFile(filepath.Join(t.TempDir(), "missing", "IMG_0001.jpg"), "a.lrprev", []byte("data"))
+	assert.ErrorContains(t, err, "error creating output file")
+}
+
+func TestWriter_Written(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter(Skip)
+	assert.NoError(t, err)
+
+	jpeg := filepath.Join(dir, "IMG_0001.jpg")
+	sidecar := filepath.Join(dir, "IMG_0001.xmp")
+	assert.NoError(t, os.WriteFile(sidecar, []byte("old"), 0644))
+
+	_, err = w.WriteFile(jpeg, "a.lrprev", []byte("jpeg"))
+	assert.NoError(t, err)
+	// Sidecars replace what is there regardless of the policy
+	assert.NoError(t, w.WriteAlongside(sidecar, "a.lrprev", []byte("new")))
+	assert.Equal(t, "new", readFile(t, sidecar))
+	assert.Empty(t, w.Conflicts())
+
+	assert.Equal(t, []string{jpeg, sidecar}, w.Written("a.lrprev"))
+	assert.Empty(t, w.Written("b.lrprev"))
+}
+
+func TestWriter_Release(t *testing.T) {
+	for _, policy := range Policies {
+		dir := t.TempDir()
+		w, err := NewWriter(policy)
+		assert.NoError(t, err)
+
+		path := filepath.Join(dir, "IMG_0001.jpg")
+		_, err = w.WriteFile(path, "a.lrprev", []byte("one"))
+		assert.NoError(t, err)
+
+		// A re-rendered preview replaces its own file
+		w.Release("a.lrprev")
+		assert.Empty(t, w.Written("a.lrprev"), policy)
+		written, err := w.WriteFile(path, "a.lrprev", []byte("two"))
+		assert.NoError(t, err)
+		assert.Equal(t, path, written, policy)
+		assert.Equal(t, "two", readFile(t, path), policy)
+		assert.Equal(t, []string{path}, w.Written("a.lrprev"), policy)
+		assert.Empty(t, w.Conflicts(), policy)
+
+		// Other previews still collide with it
+		_, err = w.WriteFile(path, "b.lrprev", []byte("three"))
+		assert.NoError(t, err)
+		assert.Len(t, w.Conflicts(), 1, policy)
+	}
+}
+
+func TestWriter_WriteStream(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewWriter(Skip)
+	assert.NoError(t, err)
+
+	path := filepath.Join(dir, "IMG_0001.jpg")
+	written, err := w.WriteStream(path, "a.lrprev", func(dst io.Writer) error {
+		_, err := io.WriteString(dst, "streamed")
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, path, written)
+	assert.Equal(t, "streamed", readFile(t, path))
+
+	// A skipped file is never produced
+	written, err = w.WriteStream(path, "b.lrprev", func(io.Writer) error {
+		t.Error("write called for a skipped file")
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Empty(t, written)
+
+	// A failing write leaves nothing behind
+	_, err = w.WriteStream(filepath.Join(dir, "IMG_0002.jpg"), "c.lrprev", func(io.Writer) error {
+		return errors.New("truncated")
+	})
+	assert.EqualError(t, err, "error writing output file: truncated")
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestWriter_DryRun(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "IMG_0001.jpg")
+	assert.NoError(t, os.WriteFile(existing, []byte("same"), 0644))
+
+	w, err := NewDryRunWriter(Identical)
+	assert.NoError(t, err)
+	assert.True(t, w.DryRun())
+	assert.NoError(t, w.MkdirAll(filepath.Join(dir, "new")))
+
+	// Conflicts with the disk and within the run resolve as in a real run
+	written, err := w.WriteFile(existing, "a.lrprev", []byte("same"))
+	assert.NoError(t, err)
+	assert.Empty(t, written)
+	written, err = w.WriteFile(existing, "b.lrprev", []byte("different"))
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "IMG_0001-2.jpg"), written)
+	written, err = w.WriteFile(filepath.Join(dir, "new", "IMG_0002.jpg"), "c.lrprev", []byte("new"))
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "new", "IMG_0002.jpg"), written)
+	written, err = w.WriteFile(filepath.Join(dir, "new", "IMG_0002.jpg"), "d.lrprev", []byte("newer"))
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(dir, "new", "IMG_0002-2.jpg"), written)
+	assert.NoError(t, w.WriteAlongside(filepath.Join(dir, "new", "IMG_0002.xmp"), "c.lrprev", []byte("xmp")))
+
+	assert.Equal(t, []string{filepath.Join(dir, "new", "IMG_0002.jpg"), filepath.Join(dir, "new", "IMG_0002.xmp")}, w.Written("c.lrprev"))
+	assert.Equal(t, "3 output conflicts (2 renamed, 1 identical)", w.Summary())
+	assert.Equal(t, []File{
+		{Path: filepath.Join(dir, "IMG_0001-2.jpg"), Source: "b.lrprev", Size: 9},
+		{Path: filepath.Join(dir, "new", "IMG_0002.jpg"), Source: "c.lrprev", Size: 3},
+		{Path: filepath.Join(dir, "new", "IMG_0002-2.jpg"), Source: "d.lrprev", Size: 5},
+		{Path: filepath.Join(dir, "new", "IMG_0002.xmp"), Source: "c.lrprev", Size: 3},
+	}, w.Files())
+
+	// Nothing was written
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "same", readFile(t, existing))
+}
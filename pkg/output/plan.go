@@ -0,0 +1,100 @@
+package output
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+)
+
+// Folder totals the files of one output directory.
+type Folder struct {
+	Path  string `json:"path"`
+	Files int    `json:"files"`
+	Size  int64  `json:"bytes"`
+}
+
+// Plan describes the files of a run: with NewDryRunWriter, what a real run
+// would write.
+type Plan struct {
+	Files     int        `json:"files"`
+	Size      int64      `json:"bytes"`
+	Folders   []Folder   `json:"folders"`
+	Outputs   []File     `json:"outputs"`
+	Conflicts []Conflict `json:"conflicts"`
+}
+
+// Plan totals the files written so far by output folder, sorted by path.
+func (w *Writer) Plan() Plan {
+	plan := Plan{Folders: []Folder{}, Outputs: w.Files(), Conflicts: w.Conflicts()}
+	if plan.Outputs == nil {
+		plan.Outputs = []File{}
+	}
+	if plan.Conflicts == nil {
+		plan.Conflicts = []Conflict{}
+	}
+
+	folders := make(map[string]*Folder)
+	for _, f := range plan.Outputs {
+		plan.Files++
+		plan.Size += f.Size
+		dir := filepath.Dir(f.Path)
+		folder, ok := folders[dir]
+		if !ok {
+			folder = &Folder{Path: dir}
+			folders[dir] = folder
+		}
+		folder.Files++
+		folder.Size += f.Size
+	}
+	for _, folder := range folders {
+		plan.Folders = append(plan.Folders, *folder)
+	}
+	sort.Slice(plan.Folders, func(i, j int) bool { return plan.Folders[i].Path < plan.Folders[j].Path })
+	return plan
+}
+
+// WriteText writes the totals, one line per folder, and the conflicts.
+func (p Plan) WriteText(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "Plan: %d files, %s in %d folders\n", p.Files, FormatSize(p.Size), len(p.Folders)); err != nil {
+		return err
+	}
+	for _, f := range p.Folders {
+		if _, err := fmt.Fprintf(w, "  %s: %d files, %s\n", f.Path, f.Files, FormatSize(f.Size)); err != nil {
+			return err
+		}
+	}
+	if len(p.Conflicts) > 0 {
+		if _, err := fmt.Fprintf(w, "%d output conflicts:\n", len(p.Conflicts)); err != nil {
+			return err
+		}
+		for _, c := range p.Conflicts {
+			if _, err := fmt.Fprintf(w, "  %s\n", c); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteJSON writes the plan as one indented JSON object.
+func (p Plan) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(p)
+}
+
+// FormatSize formats a byte count with a binary unit, e.g. "1.5 MiB".
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,61 @@
+package output
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriter_Plan(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewDryRunWriter(Suffix)
+	assert.NoError(t, err)
+	for _, name := range []string{"2024/IMG_0001.jpg", "2024/IMG_0001.jpg", "2025/IMG_0002.jpg"} {
+		_, err := w.WriteFile(filepath.Join(dir, name), name, bytes.Repeat([]byte{1}, 1000))
+		assert.NoError(t, err)
+	}
+
+	plan := w.Plan()
+	assert.Equal(t, 3, plan.Files)
+	assert.Equal(t, int64(3000), plan.Size)
+	assert.Equal(t, []Folder{
+		{Path: filepath.Join(dir, "2024"), Files: 2, Size: 2000},
+		{Path: filepath.Join(dir, "2025"), Files: 1, Size: 1000},
+	}, plan.Folders)
+	assert.Len(t, plan.Outputs, 3)
+	assert.Len(t, plan.Conflicts, 1)
+
+	var text bytes.Buffer
+	assert.NoError(t, plan.WriteText(&text))
+	assert.Equal(t, "Plan: 3 files, 2.9 KiB in 2 folders\n"+
+		"  "+filepath.Join(dir, "2024")+": 2 files, 2.0 KiB\n"+
+		"  "+filepath.Join(dir, "2025")+": 1 files, 1000 B\n"+
+		"1 output conflicts:\n"+
+		"  "+plan.Conflicts[0].String()+"\n", text.String())
+
+	var out bytes.Buffer
+	assert.NoError(t, plan.WriteJSON(&out))
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+	assert.Equal(t, float64(3000), decoded["bytes"])
+	assert.Len(t, decoded["folders"], 2)
+	assert.Equal(t, "renamed", decoded["conflicts"].([]interface{})[0].(map[string]interface{})["action"])
+}
+
+func TestWriter_PlanEmpty(t *testing.T) {
+	w, err := NewDryRunWriter(Overwrite)
+	assert.NoError(t, err)
+	var out bytes.Buffer
+	assert.NoError(t, w.Plan().WriteJSON(&out))
+	assert.JSONEq(t, `{"files":0,"bytes":0,"folders":[],"outputs":[],"conflicts":[]}`, out.String())
+}
+
+func TestFormatSize(t *testing.T) {
+	assert.Equal(t, "512 B", FormatSize(512))
+	assert.Equal(t, "1.5 KiB", FormatSize(1536))
+	assert.Equal(t, "3.0 MiB", FormatSize(3<<20))
+	assert.Equal(t, "2.0 GiB", FormatSize(2<<30))
+}
@@ -0,0 +1,72 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// JSON event types.
+const (
+	EventLog       = "log"
+	EventProgress  = "progress"
+	EventProcessed = "processed"
+	EventComplete  = "complete"
+)
+
+// Event is one line of JSON output.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+	Level   Level     `json:"level,omitempty"`
+	File    string    `json:"file,omitempty"`
+	Message string    `json:"message,omitempty"`
+	// Done and Total are set on progress events.
+	Done  int `json:"done,omitempty"`
+	Total int `json:"total,omitempty"`
+	// Status is "done" or "failed" on processed events.
+	Status  string         `json:"status,omitempty"`
+	Outputs []string       `json:"outputs,omitempty"`
+	Error   string         `json:"error,omitempty"`
+	Counts  map[string]int `json:"counts,omitempty"`
+}
+
+// JSON writes every event as a line of JSON.
+type JSON struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func NewJSON(w io.Writer) *JSON {
+	return &JSON{enc: json.NewEncoder(w)}
+}
+
+func (j *JSON) Logf(level Level, file, format string, args ...interface{}) {
+	j.emit(Event{Event: EventLog, Level: level, File: file, Message: fmt.Sprintf(format, args...)})
+}
+
+func (j *JSON) Progress(done, total int) {
+	j.emit(Event{Event: EventProgress, Done: done, Total: total})
+}
+
+func (j *JSON) Processed(file string, outputs []string, err error) {
+	event := Event{Event: EventProcessed, File: file, Status: "done", Outputs: outputs}
+	if err != nil {
+		event.Status = "failed"
+		event.Error = err.Error()
+	}
+	j.emit(event)
+}
+
+func (j *JSON) Complete(summary Summary) {
+	j.emit(Event{Event: EventComplete, Message: summary.Message, Counts: summary.Counts})
+}
+
+func (j *JSON) emit(event Event) {
+	event.Time = time.Now().UTC()
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_ = j.enc.Encode(event)
+}
@@ -0,0 +1,40 @@
+package report
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJSON(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewJSON(&buf)
+	r.Logf(Warning, "a.lrprev", "Unknown preview orientation %q", "XX")
+	r.Progress(1, 2)
+	r.Processed("a.lrprev", []string{"out/a.jpg"}, nil)
+	r.Processed("b.lrprev", nil, errors.New("boom"))
+	r.Complete(Summary{Message: "done", Counts: map[string]int{"extracted": 1, "failed": 1}})
+
+	var events []Event
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		var event Event
+		assert.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+		assert.False(t, event.Time.IsZero())
+		event.Time = time.Time{}
+		events = append(events, event)
+	}
+
+	assert.Equal(t, []Event{
+		{Event: EventLog, Level: Warning, File: "a.lrprev", Message: `Unknown preview orientation "XX"`},
+		{Event: EventProgress, Done: 1, Total: 2},
+		{Event: EventProcessed, File: "a.lrprev", Status: "done", Outputs: []string{"out/a.jpg"}},
+		{Event: EventProcessed, File: "b.lrprev", Status: "failed", Error: "boom"},
+		{Event: EventComplete, Message: "done", Counts: map[string]int{"extracted": 1, "failed": 1}},
+	}, events)
+}
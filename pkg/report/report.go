@@ -0,0 +1,103 @@
+// Package report delivers the progress of a run to the user: a TUI, plain
+// log lines, or newline-delimited JSON events for other programs.
+package report
+
+import (
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Message levels. Debug covers the individual steps of extracting a preview.
+type Level string
+
+const (
+	Debug   Level = "debug"
+	Info    Level = "info"
+	Warning Level = "warning"
+	Error   Level = "error"
+)
+
+// Formats accepted by New.
+const (
+	FormatTUI   = "tui"
+	FormatPlain = "plain"
+	FormatJSON  = "json"
+)
+
+// Reporter receives the events of a run. Logf may be called from several
+// goroutines at once; the other methods are called from one.
+type Reporter interface {
+	// Logf records a message, about the preview file when it is not empty.
+	Logf(level Level, file, format string, args ...interface{})
+	// Progress reports that done of total previews have been handled.
+	Progress(done, total int)
+	// Processed reports the outcome of one preview and the files written
+	// for it.
+	Processed(file string, outputs []string, err error)
+	// Complete ends the run with a one line summary and the counts behind it.
+	Complete(summary Summary)
+}
+
+// Summary describes a finished run.
+type Summary struct {
+	Message string
+	Counts  map[string]int
+}
+
+// New returns the plain or JSON Reporter writing to w. The TUI needs an
+// application and is created with NewTUI.
+func New(format string, w io.Writer) (Reporter, error) {
+	switch format {
+	case FormatPlain:
+		return NewPlain(w), nil
+	case FormatJSON:
+		return NewJSON(w), nil
+	}
+	return nil, fmt.Errorf("unknown report format %q", format)
+}
+
+// Discard is a Reporter that drops every event, for library callers that do
+// not want the steps of a run.
+var Discard Reporter = discard{}
+
+type discard struct{}
+
+func (discard) Logf(level Level, file, format string, args ...interface{}) {}
+func (discard) Progress(done, total int)                                   {}
+func (discard) Processed(file string, outputs []string, err error)         {}
+func (discard) Complete(summary Summary)                                   {}
+
+// Plain writes one line per message, as the tool always has.
+type Plain struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewPlain(w io.Writer) *Plain {
+	return &Plain{w: w}
+}
+
+func (p *Plain) Logf(level Level, file, format string, args ...interface{}) {
+	p.println(fmt.Sprintf(format, args...))
+}
+
+func (p *Plain) Progress(done, total int) {}
+
+func (p *Plain) Processed(file string, outputs []string, err error) {
+	if err != nil {
+		p.println(fmt.Sprintf("Error processing file %s: %v", file, err))
+		return
+	}
+	p.println(fmt.Sprintf("Processed file: %s", file))
+}
+
+func (p *Plain) Complete(summary Summary) {
+	p.println(summary.Message)
+}
+
+func (p *Plain) println(line string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintln(p.w, line)
+}
@@ -0,0 +1,37 @@
+package report
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlain(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewPlain(&buf)
+	r.Logf(Debug, "a.lrprev", "Reading file: %s", "a.lrprev")
+	r.Progress(1, 2)
+	r.Processed("a.lrprev", []string{"out/a.jpg"}, nil)
+	r.Processed("b.lrprev", nil, errors.New("boom"))
+	r.Complete(Summary{Message: "Processing complete: 1 extracted, 1 failed"})
+
+	assert.Equal(t, "Reading file: a.lrprev\n"+
+		"Processed file: a.lrprev\n"+
+		"Error processing file b.lrprev: boom\n"+
+		"Processing complete: 1 extracted, 1 failed\n", buf.String())
+}
+
+func TestNew(t *testing.T) {
+	r, err := New(FormatPlain, &bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.IsType(t, &Plain{}, r)
+
+	r, err = New(FormatJSON, &bytes.Buffer{})
+	assert.NoError(t, err)
+	assert.IsType(t, &JSON{}, r)
+
+	_, err = New(FormatTUI, &bytes.Buffer{})
+	assert.Error(t, err)
+}
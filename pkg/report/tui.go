@@ -0,0 +1,71 @@
+package report
+
+import (
+	"fmt"
+
+	"github.com/rivo/tview"
+)
+
+// TUI shows a progress line above a scrolling log. Debug messages are left
+// out to keep the log readable.
+type TUI struct {
+	app   *tview.Application
+	log   *tview.TextView
+	gauge *tview.TextView
+}
+
+// NewTUI builds the layout; run it with app.SetRoot(t.Root(), true).Run().
+func NewTUI(app *tview.Application) *TUI {
+	t := &TUI{app: app}
+	t.log = tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true).
+		SetChangedFunc(func() {
+			app.Draw()
+		})
+	t.gauge = tview.NewTextView().
+		SetDynamicColors(true).
+		SetTextAlign(tview.AlignCenter)
+	return t
+}
+
+// Root returns the layout: the progress line above the log.
+func (t *TUI) Root() tview.Primitive {
+	return tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(t.gauge, 1, 0, false).
+		AddItem(t.log, 0, 1, false)
+}
+
+var colours = map[Level]string{
+	Warning: "[yellow]",
+	Error:   "[red]",
+}
+
+func (t *TUI) Logf(level Level, file, format string, args ...interface{}) {
+	if level == Debug {
+		return
+	}
+	fmt.Fprintf(t.log, "%s%s\n", colours[level], tview.Escape(fmt.Sprintf(format, args...)))
+}
+
+func (t *TUI) Progress(done, total int) {
+	percent := 100
+	if total > 0 {
+		percent = done * 100 / total
+	}
+	t.gauge.Clear()
+	fmt.Fprintf(t.gauge, "[yellow]Progress: [white]%d%%", percent)
+	t.app.Draw()
+}
+
+func (t *TUI) Processed(file string, outputs []string, err error) {
+	if err != nil {
+		t.Logf(Error, file, "Error processing file %s: %v", file, err)
+		return
+	}
+	t.Logf(Info, file, "Processed file: %s", file)
+}
+
+func (t *TUI) Complete(summary Summary) {
+	fmt.Fprintf(t.log, "[green]%s\n", tview.Escape(summary.Message))
+}